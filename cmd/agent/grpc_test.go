@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	grpcMetric "github.com/dip96/metrics/internal/grpcservices/metric"
+	"github.com/dip96/metrics/internal/model/metric"
+	memStorage "github.com/dip96/metrics/internal/storage/mem"
+	pbBase "github.com/dip96/metrics/protobuf/protos/metric/base"
+	pbV1 "github.com/dip96/metrics/protobuf/protos/metric/v1"
+	pbV2 "github.com/dip96/metrics/protobuf/protos/metric/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"sync"
+	"testing"
+)
+
+// startBufconnServer запускает gRPC сервер поверх bufconn и возвращает соединение с ним.
+// Сервисы регистрируются функцией register.
+func startBufconnServer(t *testing.T, register func(server *grpc.Server)) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	register(server)
+
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return conn
+}
+
+// registerMetricService возвращает функцию регистрации всех сервисов метрик поверх хранилища store.
+func registerMetricService(store *memStorage.Storage) func(server *grpc.Server) {
+	return func(server *grpc.Server) {
+		grpcMetric.Register(server, grpcMetric.NewMetricService(store))
+	}
+}
+
+func TestSendMetricsGRPCIntegration(t *testing.T) {
+	store := memStorage.NewStorage()
+	conn := startBufconnServer(t, registerMetricService(store))
+
+	batch := applyLabels([]metric.Metric{
+		{ID: "Alloc", MType: metric.MetricTypeGauge, Value: Float64Ptr(1.5)},
+		{ID: "PollCount", MType: metric.MetricTypeCounter, Delta: Int64Ptr(2)},
+	}, map[string]string{"host": "agent"})
+
+	// Отправляем пачку дважды, чтобы проверить накопление счетчика
+	require.NoError(t, sendMetricsGRPC(conn, batch))
+	require.NoError(t, sendMetricsGRPC(conn, batch))
+
+	gauge, err := store.Get(metric.SeriesKey("Alloc", map[string]string{"host": "agent"}))
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *gauge.Value)
+
+	counter, err := store.Get(metric.SeriesKey("PollCount", map[string]string{"host": "agent"}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *counter.Delta)
+
+	// Сервис metrics.v1 зарегистрирован полностью
+	clientV1 := pbV1.NewMetricServiceClient(conn)
+	html, err := clientV1.GetAllMetricsHTML(context.Background(), &pbV1.GetAllMetricsHTMLRequest{})
+	require.NoError(t, err)
+	assert.Contains(t, html.HtmlContent, "Alloc")
+
+	// Сервис metrics.v2 по-прежнему доступен на том же сервере
+	clientV2 := pbV2.NewMetricServiceClient(conn)
+	resp, err := clientV2.GetMetricV2(context.Background(), &pbV2.AddMetricV2Request{
+		Metric: &pbBase.Metric{Id: "PollCount", Type: pbBase.MetricType_COUNTER, Labels: map[string]string{"host": "agent"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), resp.Metric.Delta)
+}
+
+func TestSendMetricsGRPCRejectedBatch(t *testing.T) {
+	conn := startBufconnServer(t, registerMetricService(memStorage.NewStorage()))
+
+	err := sendMetricsGRPC(conn, []metric.Metric{{MType: metric.MetricTypeGauge, Value: Float64Ptr(1)}})
+	assert.ErrorIs(t, err, errBatchRejected)
+}
+
+func TestSendMetricsStreamGRPC(t *testing.T) {
+	store := memStorage.NewStorage()
+	conn := startBufconnServer(t, registerMetricService(store))
+
+	stream := newMetricsStream(conn, 2)
+	defer stream.Close()
+
+	// Параллельные отправки делят один поток, окно ограничивает неподтвержденные пачки
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := sendMetricsStreamGRPC(stream, conn, []metric.Metric{
+				{ID: "PollCount", MType: metric.MetricTypeCounter, Delta: Int64Ptr(1)},
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	counter, err := store.Get("PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), *counter.Delta)
+
+	// Отклоненная пачка подтверждается с ошибкой, но поток продолжает работать
+	err = sendMetricsStreamGRPC(stream, conn, []metric.Metric{{MType: metric.MetricTypeGauge, Value: Float64Ptr(1)}})
+	assert.Error(t, err)
+
+	err = sendMetricsStreamGRPC(stream, conn, []metric.Metric{
+		{ID: "Alloc", MType: metric.MetricTypeGauge, Value: Float64Ptr(2.5)},
+	})
+	require.NoError(t, err)
+
+	gauge, err := store.Get("Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, *gauge.Value)
+}
+
+func TestSendMetricsStreamGRPCFallback(t *testing.T) {
+	store := memStorage.NewStorage()
+
+	// Сервер без metrics.v3
+	conn := startBufconnServer(t, func(server *grpc.Server) {
+		pbV1.RegisterMetricServiceServer(server, grpcMetric.NewMetricService(store).V1())
+	})
+
+	stream := newMetricsStream(conn, 2)
+	defer stream.Close()
+
+	err := sendMetricsStreamGRPC(stream, conn, []metric.Metric{
+		{ID: "PollCount", MType: metric.MetricTypeCounter, Delta: Int64Ptr(3)},
+	})
+	require.NoError(t, err)
+
+	counter, err := store.Get("PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *counter.Delta)
+}
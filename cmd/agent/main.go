@@ -3,29 +3,36 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/dip96/metrics/internal/asymmetricEncryption/encode"
 	"github.com/dip96/metrics/internal/asymmetricEncryption/generate"
+	"github.com/dip96/metrics/internal/collector"
 	"github.com/dip96/metrics/internal/config"
 	"github.com/dip96/metrics/internal/grpcservices/metric"
 	"github.com/dip96/metrics/internal/hash"
+	"github.com/dip96/metrics/internal/interceptors"
 	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/spool"
 	"github.com/dip96/metrics/internal/utils"
 	pbBase "github.com/dip96/metrics/protobuf/protos/metric/base"
-	pbV2 "github.com/dip96/metrics/protobuf/protos/metric/v1"
-	"github.com/shirou/gopsutil/cpu"
-	"github.com/shirou/gopsutil/mem"
+	pbV1 "github.com/dip96/metrics/protobuf/protos/metric/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
 	"log"
-	"math/rand"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"runtime"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -38,20 +45,64 @@ var (
 
 var wg sync.WaitGroup
 
-const countGor = 3
+// spoolQueue - очередь пачек метрик, которые не удалось отправить на сервер.
+// nil, если очередь отключена.
+var spoolQueue *spool.Queue
+
+// spoolReplayMu не дает воркерам одновременно повторять отправку из очереди.
+var spoolReplayMu sync.Mutex
+
+// httpClient - HTTP клиент агента. Общий для всех воркеров, чтобы переиспользовать соединения.
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// agentTLS - TLS конфигурация агента. nil, если агент подключается без TLS.
+var agentTLS *tls.Config
+
+// grpcConn - долгоживущее gRPC соединение с сервером, общее для всех воркеров,
+// grpcStream - поток StreamMetrics поверх него.
+// Создаются при первой отправке и закрываются при остановке агента.
+var (
+	grpcConn     *grpc.ClientConn
+	grpcStream   *metricsStream
+	grpcConnErr  error
+	grpcConnOnce sync.Once
+)
+
+// retryDelays - паузы между попытками отправки пачки на сервер.
+var retryDelays = []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second}
+
+// errBatchRejected - сервер отклонил пачку (например, из-за неверной подписи или некорректных данных),
+// и повторная отправка ее не изменит. Такая пачка не повторяется и не сохраняется в очередь.
+var errBatchRejected = errors.New("the metrics batch was rejected by the server")
+
+// rejectedBatches - количество отброшенных пачек, отклоненных сервером.
+var rejectedBatches atomic.Int64
 
 func main() {
 	printBuildInfo()
 	stop := make(chan struct{})
-	metricsChan := make(chan []metricModel.Metric)
-	gopsutilMetricsChan := make(chan []metricModel.Metric)
+
+	cfg, err := config.LoadAgent()
+	if err != nil {
+		log.Fatalf("Failed to prepare agent config: %v", err)
+	}
 
 	generate.Generate()
 
-	wg.Add(countGor)
-	go collectMetricsRoutine(metricsChan, stop)
-	go collectGopsutilMetricsRoutine(gopsutilMetricsChan, stop)
-	go prepareMetricsRoutine(metricsChan, gopsutilMetricsChan, stop)
+	if err := initTLS(cfg); err != nil {
+		log.Fatalf("Failed to prepare TLS config: %v", err)
+	}
+
+	initSpool()
+
+	if err := registerScrape(cfg, collector.Default()); err != nil {
+		log.Fatalf("Failed to prepare scrape collector: %v", err)
+	}
+
+	collected := startCollectors(cfg, collector.Default(), stop)
+
+	wg.Add(1)
+	go prepareMetricsRoutine(collected, stop)
 
 	// Создаем канал для сигналов
 	sigChan := make(chan os.Signal, 1)
@@ -62,6 +113,7 @@ func main() {
 
 	// Инициируем graceful shutdown
 	gracefulShutdown(stop)
+	closeGRPCConnection()
 }
 
 func gracefulShutdown(stop chan struct{}) {
@@ -93,32 +145,28 @@ func printBuildInfo() {
 	fmt.Printf("Build commit: %s\n", buildCommit)
 }
 
-// collectGopsutilMetricsRoutine - горутина для сбора метрик из gopsutil.
-// Метрики помещаются в канал gopsutilMetricsChan с интервалом gopsutilInterval.
-func collectGopsutilMetricsRoutine(gopsutilMetricsChan chan<- []metricModel.Metric, stop <-chan struct{}) {
-	defer wg.Done()
+// initTLS настраивает TLS для HTTP и gRPC клиентов агента по конфигурации cfg.
+func initTLS(cfg *config.Agent) error {
+	tlsConfig, err := utils.ClientTLSConfig(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey, cfg.TLSServerName)
+	if err != nil {
+		return err
+	}
 
-	gopsutilInterval := 5 * time.Second
+	if tlsConfig == nil {
+		return nil
+	}
 
-	ticker := time.NewTicker(gopsutilInterval)
-	defer ticker.Stop()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	httpClient.Transport = transport
+	agentTLS = tlsConfig
 
-	for {
-		select {
-		case <-stop:
-			log.Println("Stop collectGopsutilMetricsRoutine")
-			return
-		case <-ticker.C:
-			gopsutilMetrics := collectGopsutilMetrics()
-			gopsutilMetricsChan <- gopsutilMetrics
-		}
-	}
+	return nil
 }
 
-// collectMetricsRoutine - горутина для сбора метрик из runtime.
-// Метрики помещаются в канал metricsChan с интервалом updateInterval.
-func collectMetricsRoutine(metricsChan chan<- []metricModel.Metric, stop <-chan struct{}) {
-	defer wg.Done()
+// initSpool создает очередь неотправленных пачек метрик по конфигурации агента.
+// Если очередь создать не удалось, агент работает без нее.
+func initSpool() {
 	cfg, err := config.LoadAgent()
 
 	if err != nil {
@@ -126,30 +174,111 @@ func collectMetricsRoutine(metricsChan chan<- []metricModel.Metric, stop <-chan
 		return
 	}
 
-	updateInterval := time.Duration(cfg.FlagRuntime) * time.Second
-	lastUpdateTime := time.Now()
-	PollCount := int64(1)
+	if cfg.SpoolDir == "" {
+		return
+	}
+
+	queue, err := spool.NewQueue(cfg.SpoolDir, cfg.SpoolMaxSize, time.Duration(cfg.SpoolMaxAge)*time.Second)
+	if err != nil {
+		log.Println("Failed to create spool, pending batches will be dropped:", err)
+		return
+	}
+
+	spoolQueue = queue
+	log.Printf("Spool %s has %d pending batches", cfg.SpoolDir, queue.Len())
+}
+
+// registerScrape регистрирует сборщик scrape, если в конфигурации заданы цели опроса.
+func registerScrape(cfg *config.Agent, registry *collector.Registry) error {
+	if len(cfg.ScrapeTargets) == 0 {
+		return nil
+	}
+
+	scrape, err := collector.NewScrape(cfg.ScrapeTargets, cfg.ScrapeRelabel, time.Duration(cfg.ScrapeTimeout)*time.Second)
+	if err != nil {
+		return err
+	}
+
+	return registry.Register(scrape, collector.DefaultScrapeInterval)
+}
+
+// startCollectors - функция для запуска включенных сборщиков метрик из реестра registry.
+// Каждый сборщик работает в отдельной горутине со своим интервалом.
+// Возвращает каналы, в которые сборщики помещают собранные метрики.
+func startCollectors(cfg *config.Agent, registry *collector.Registry, stop <-chan struct{}) []<-chan []metricModel.Metric {
+	var collected []<-chan []metricModel.Metric
+
+	for _, registered := range registry.Collectors() {
+		name := registered.Collector.Name()
+		if !cfg.CollectorEnabled(name) {
+			log.Printf("Collector %s is disabled", name)
+			continue
+		}
+
+		interval := cfg.CollectorInterval(name, registered.Interval)
+		if interval <= 0 {
+			log.Printf("Collector %s has invalid interval %v, skipping", name, interval)
+			continue
+		}
+
+		metricsChan := make(chan []metricModel.Metric)
+		wg.Add(1)
+		go collectRoutine(registered.Collector, interval, metricsChan, stop)
+		collected = append(collected, metricsChan)
+	}
+
+	return collected
+}
+
+// collectRoutine - горутина для сбора метрик сборщиком c.
+// Метрики помещаются в канал metricsChan с интервалом interval.
+// При остановке канал metricsChan закрывается.
+func collectRoutine(c collector.Collector, interval time.Duration, metricsChan chan<- []metricModel.Metric, stop <-chan struct{}) {
+	defer wg.Done()
+	defer close(metricsChan)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Прерываем текущий сбор метрик при остановке агента
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-stop:
-			log.Println("Stop collectMetricsRoutine")
+			log.Printf("Stop collector %s", c.Name())
 			return
-		default:
-			if time.Since(lastUpdateTime) > updateInterval {
-				metrics := collectMetrics(PollCount)
-				PollCount++
-				lastUpdateTime = time.Now()
-				metricsChan <- metrics
+		case <-ticker.C:
+			metrics, err := c.Collect(ctx)
+			if err != nil {
+				log.Printf("Collector %s failed: %v", c.Name(), err)
+				continue
+			}
+
+			select {
+			case metricsChan <- metrics:
+			case <-stop:
+				log.Printf("Stop collector %s", c.Name())
+				return
 			}
 		}
 	}
 }
 
 // prepareMetricsRoutine - горутина для обработки и отправки метрик.
-// Метрики из каналов metricsChan и gopsutilMetricsChan объединяются и отправляются с интервалом sendInterval.
-// Для отправки метрик используется пул воркеров с размером rateLimit.
-func prepareMetricsRoutine(metricsChan <-chan []metricModel.Metric, gopsutilMetricsChan <-chan []metricModel.Metric, stop <-chan struct{}) {
+// Метрики из каналов сборщиков collected объединяются в пачки не больше batchSize метрик
+// и отправляются не реже чем раз в sendInterval.
+// Для отправки пачек используется пул воркеров с размером rateLimit.
+func prepareMetricsRoutine(collected []<-chan []metricModel.Metric, stop <-chan struct{}) {
 	defer wg.Done()
 	cfg, err := config.LoadAgent()
 
@@ -160,268 +289,440 @@ func prepareMetricsRoutine(metricsChan <-chan []metricModel.Metric, gopsutilMetr
 	rateLimit := cfg.RateLimit
 	sendInterval := time.Duration(cfg.FlagReportInterval) * time.Second
 
-	mergedMetricsChan := mergeMetrics(metricsChan, gopsutilMetricsChan)
+	mergedMetricsChan := mergeMetrics(collected...)
+	jobChan := make(chan []metricModel.Metric, rateLimit)
 
-	lastSendTime := time.Now()
-	jobChan := make(chan metricModel.Metric, rateLimit)
+	send := metricsSender(cfg.Transport)
 
 	//pool worker
+	var workersWg sync.WaitGroup
 	for i := 0; i < rateLimit; i++ {
-		go sendMetricsRoutine(jobChan, stop)
+		workersWg.Add(1)
+		go func() {
+			defer workersWg.Done()
+			sendMetricsRoutine(jobChan, send)
+		}()
+	}
+
+	// Очередь неотправленных пачек повторяется с интервалом отправки
+	if spoolQueue != nil {
+		replayInterval := sendInterval
+		if replayInterval <= 0 {
+			replayInterval = time.Second
+		}
+
+		workersWg.Add(1)
+		go func() {
+			defer workersWg.Done()
+			replaySpoolRoutine(spoolQueue, send, replayInterval, stop)
+		}()
+	}
+
+	// Сборщики закрывают свои каналы при остановке, поэтому batchMetrics
+	// отправит последнюю пачку и завершится после остановки всех сборщиков
+	go func() {
+		<-stop
+		log.Println("Preparing final metrics before shutdown...")
+	}()
+
+	batchMetrics(mergedMetricsChan, jobChan, cfg.BatchSize, sendInterval, cfg.Labels)
+	close(jobChan)
+
+	// Дожидаемся отправки оставшихся пачек
+	workersWg.Wait()
+	log.Println("Stop prepareMetricsRoutine")
+}
+
+// batchMetrics - функция для объединения метрик из канала metricsChan в пачки.
+// Пачка помещается в канал jobChan, когда в ней набирается batchSize метрик
+// или с момента отправки предыдущей пачки прошло flushInterval.
+// Функция завершается после закрытия канала metricsChan, отправив последнюю пачку.
+func batchMetrics(metricsChan <-chan []metricModel.Metric, jobChan chan<- []metricModel.Metric, batchSize int, flushInterval time.Duration, labels map[string]string) {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+
+	batch := make([]metricModel.Metric, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		jobChan <- batch
+		batch = make([]metricModel.Metric, 0, batchSize)
 	}
 
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case <-stop:
-			log.Println("Preparing final metrics before shutdown...")
-			// Отправляем все оставшиеся метрики
-			for metrics := range mergedMetricsChan {
-				for _, m := range metrics {
-					jobChan <- m
-				}
+		case metrics, ok := <-metricsChan:
+			if !ok {
+				flush()
+				return
 			}
-			close(jobChan)
-			log.Println("Stop prepareMetricsRoutine")
-			return
-		default:
-			if time.Since(lastSendTime) > sendInterval {
-				for metrics := range mergedMetricsChan {
-					for _, m := range metrics {
-						jobChan <- m
-					}
+
+			for _, m := range applyLabels(metrics, labels) {
+				batch = append(batch, m)
+				if len(batch) >= batchSize {
+					flush()
 				}
-				lastSendTime = time.Now()
 			}
+		case <-ticker.C:
+			flush()
 		}
 	}
 }
 
-// mergeMetrics - функция для объединения метрик из двух каналов.
-// Возвращает канал, в который помещаются объединенные метрики.
-func mergeMetrics(metricsChan <-chan []metricModel.Metric, gopsutilMetricsChan <-chan []metricModel.Metric) <-chan []metricModel.Metric {
+// mergeMetrics - функция для объединения метрик из нескольких каналов.
+// Возвращает канал, в который помещаются объединенные метрики в порядке поступления.
+// Канал закрывается после закрытия всех исходных каналов.
+func mergeMetrics(chans ...<-chan []metricModel.Metric) <-chan []metricModel.Metric {
 	mergedChan := make(chan []metricModel.Metric)
 
+	cases := make([]reflect.SelectCase, len(chans))
+	for i, metricsChan := range chans {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(metricsChan)}
+	}
+
 	go func() {
 		defer close(mergedChan)
 
-		for {
-			select {
-			case metrics, ok := <-metricsChan:
-				if !ok {
-					metricsChan = nil
-					continue
-				}
-				mergedChan <- metrics
-			case gopsutilMetrics, ok := <-gopsutilMetricsChan:
-				if !ok {
-					gopsutilMetricsChan = nil
-					continue
-				}
-				mergedChan <- gopsutilMetrics
-			default:
-				if metricsChan == nil && gopsutilMetricsChan == nil {
-					return
-				}
+		// Количество каналов сборщиков заранее неизвестно, поэтому используем reflect.Select
+		for len(cases) > 0 {
+			i, value, ok := reflect.Select(cases)
+			if !ok {
+				cases = append(cases[:i], cases[i+1:]...)
+				continue
 			}
+			mergedChan <- value.Interface().([]metricModel.Metric)
 		}
 	}()
 
 	return mergedChan
 }
 
-// sendMetricsRoutine - горутина для отправки метрик.
-// Метрики принимаются из канала jobChan и отправляются на сервер.
-func sendMetricsRoutine(jobChan <-chan metricModel.Metric, stop <-chan struct{}) {
-	for {
-		select {
-		case <-stop:
-			log.Println("Sending final metrics...")
-			// Отправляем все оставшиеся метрики в канале
-			for metric := range jobChan {
-				sendMetricsButch([]metricModel.Metric{metric})
-				sendMetricsButchGRPC([]metricModel.Metric{metric})
+// applyLabels - функция для добавления меток агента к метрикам.
+// Метки, уже заданные у метрики, имеют приоритет над метками агента.
+func applyLabels(metrics []metricModel.Metric, labels map[string]string) []metricModel.Metric {
+	if len(labels) == 0 {
+		return metrics
+	}
+
+	for i := range metrics {
+		merged := metricModel.CopyLabels(labels)
+		for name, value := range metrics[i].Labels {
+			merged[name] = value
+		}
+		metrics[i].Labels = merged
+	}
+
+	return metrics
+}
+
+// sendMetricsRoutine - горутина для отправки пачек метрик.
+// Пачки принимаются из канала jobChan и отправляются на сервер функцией send до закрытия канала.
+func sendMetricsRoutine(jobChan <-chan []metricModel.Metric, send func([]metricModel.Metric) error) {
+	for metrics := range jobChan {
+		deliverMetrics(spoolQueue, metrics, send)
+	}
+}
+
+// metricsSender - функция для выбора способа отправки пачек метрик по протоколу transport.
+// При transport both пачка отправляется и по gRPC, но в очередь неотправленных пачек
+// попадает только при ошибке отправки по HTTP.
+func metricsSender(transport string) func([]metricModel.Metric) error {
+	switch transport {
+	case config.TransportGRPC:
+		return sendMetricsButchGRPC
+	case config.TransportBoth:
+		return func(metrics []metricModel.Metric) error {
+			if err := sendMetricsButchGRPC(metrics); err != nil {
+				log.Println(err)
 			}
-			return
-		case metric := <-jobChan:
-			sendMetricsButch([]metricModel.Metric{metric})
-			sendMetricsButchGRPC([]metricModel.Metric{metric})
+			return sendMetricsButch(metrics)
 		}
+	default:
+		return sendMetricsButch
 	}
 }
 
-// collectMetrics - функция для сбора метрик из runtime.
-// Возвращает срез метрик, включая счетчик PollCount.
-func collectMetrics(PollCount int64) []metricModel.Metric {
-	var metrics []metricModel.Metric
+// deliverMetrics - функция для отправки пачки метрик с сохранением в очередь при ошибке.
+// Если в очереди есть неотправленные пачки, новая пачка ставится в конец очереди,
+// чтобы на сервере не было пропусков. Очередь отправляется отдельно, см. replaySpoolRoutine:
+// повтор сразу после неудачной отправки снова обратился бы к недоступному серверу.
+// Пачка, отклоненная сервером, отбрасывается.
+func deliverMetrics(queue *spool.Queue, metrics []metricModel.Metric, send func([]metricModel.Metric) error) {
+	if queue == nil {
+		if err := send(metrics); err != nil {
+			log.Println("Dropping metrics batch:", err)
+		}
+		return
+	}
 
-	// метрики gauge
-	metrics = collectRuntimeGauges()
+	if queue.Len() == 0 {
+		err := send(metrics)
+		if err == nil {
+			return
+		}
+		if errors.Is(err, errBatchRejected) {
+			dropRejectedBatch(err)
+			return
+		}
+		log.Println("Spooling metrics batch:", err)
+	}
 
-	// счетчик PollCount
-	metrics = append(metrics, collectPollCount(PollCount)...)
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		log.Println("Error when serialization object:", err)
+		return
+	}
 
-	return metrics
+	dropped := queue.Dropped()
+	if err := queue.Push(data); err != nil {
+		log.Println("Error when spooling metrics batch:", err)
+	}
+
+	if total := queue.Dropped(); total > dropped {
+		log.Printf("Spool limits exceeded, dropped %d batches (%d total)", total-dropped, total)
+	}
 }
 
-// collectGopsutilMetrics - функция для сбора метрик из gopsutil.
-// Возвращает срез метрик, включая данные о памяти и использовании CPU.
-func collectGopsutilMetrics() []metricModel.Metric {
-	var metrics []metricModel.Metric
+// replaySpoolRoutine - горутина для повторной отправки очереди с интервалом interval.
+// Завершается при остановке агента.
+func replaySpoolRoutine(queue *spool.Queue, send func([]metricModel.Metric) error, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	virtualMemoryStat, err := mem.VirtualMemory()
-	if err == nil {
-		metrics = append(metrics, createMetricFromUint64("TotalMemory", metricModel.MetricTypeGauge, virtualMemoryStat.Total))
-		metrics = append(metrics, createMetricFromUint64("FreeMemory", metricModel.MetricTypeGauge, virtualMemoryStat.Free))
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			replaySpool(queue, send)
+		}
 	}
+}
 
-	cpuPercentages, err := cpu.Percent(time.Second, false)
-	if err == nil {
-		for i, cpuUsage := range cpuPercentages {
-			metricName := fmt.Sprintf("CPUutilization%d", i+1)
-			metrics = append(metrics, createMetricFromFloat64(metricName, metricModel.MetricTypeGauge, cpuUsage))
-		}
+// replaySpool - функция для отправки очереди в порядке поступления пачек.
+// Отправка прекращается на первой ошибке, оставшиеся пачки остаются в очереди.
+// Пачки, отклоненные сервером, удаляются из очереди, чтобы не задерживать следующие.
+func replaySpool(queue *spool.Queue, send func([]metricModel.Metric) error) {
+	if queue.Len() == 0 {
+		return
 	}
 
-	return metrics
+	// Очередь уже отправляется
+	if !spoolReplayMu.TryLock() {
+		return
+	}
+	defer spoolReplayMu.Unlock()
+
+	sent, err := queue.Replay(func(data []byte) error {
+		var pending []metricModel.Metric
+		if err := json.Unmarshal(data, &pending); err != nil {
+			log.Println("Skipping corrupted spooled batch:", err)
+			return nil
+		}
+		err := send(pending)
+		if errors.Is(err, errBatchRejected) {
+			dropRejectedBatch(err)
+			return nil
+		}
+		return err
+	})
+	if sent > 0 {
+		log.Printf("Replayed %d spooled batches", sent)
+	}
+	if err != nil {
+		log.Printf("Spool replay stopped, %d batches pending: %v", queue.Len(), err)
+	}
 }
 
-// collectRuntimeGauges - функция для сбора метрик gauge
-func collectRuntimeGauges() []metricModel.Metric {
-	var gauges []metricModel.Metric
-
-	memStats := runtime.MemStats{}
-	runtime.ReadMemStats(&memStats)
-
-	gauges = append(gauges, createMetricFromUint64("Alloc", metricModel.MetricTypeGauge, memStats.Alloc))
-	gauges = append(gauges, createMetricFromUint64("BuckHashSys", metricModel.MetricTypeGauge, memStats.BuckHashSys))
-	gauges = append(gauges, createMetricFromUint64("Frees", metricModel.MetricTypeGauge, memStats.Frees))
-	gauges = append(gauges, createMetricFromFloat64("GCCPUFraction", metricModel.MetricTypeGauge, memStats.GCCPUFraction))
-	gauges = append(gauges, createMetricFromUint64("GCSys", metricModel.MetricTypeGauge, memStats.GCSys))
-	gauges = append(gauges, createMetricFromUint64("HeapAlloc", metricModel.MetricTypeGauge, memStats.HeapAlloc))
-	gauges = append(gauges, createMetricFromUint64("HeapIdle", metricModel.MetricTypeGauge, memStats.HeapIdle))
-	gauges = append(gauges, createMetricFromUint64("HeapInuse", metricModel.MetricTypeGauge, memStats.HeapInuse))
-	gauges = append(gauges, createMetricFromUint64("HeapObjects", metricModel.MetricTypeGauge, memStats.HeapObjects))
-	gauges = append(gauges, createMetricFromUint64("HeapReleased", metricModel.MetricTypeGauge, memStats.HeapReleased))
-	gauges = append(gauges, createMetricFromUint64("HeapSys", metricModel.MetricTypeGauge, memStats.HeapSys))
-	gauges = append(gauges, createMetricFromUint64("LastGC", metricModel.MetricTypeGauge, memStats.LastGC))
-	gauges = append(gauges, createMetricFromUint64("Lookups", metricModel.MetricTypeGauge, memStats.Lookups))
-	gauges = append(gauges, createMetricFromUint64("MCacheInuse", metricModel.MetricTypeGauge, memStats.MCacheInuse))
-	gauges = append(gauges, createMetricFromUint64("Lookups", metricModel.MetricTypeGauge, memStats.Lookups))
-	gauges = append(gauges, createMetricFromUint64("MCacheSys", metricModel.MetricTypeGauge, memStats.MCacheSys))
-	gauges = append(gauges, createMetricFromUint64("Mallocs", metricModel.MetricTypeGauge, memStats.Mallocs))
-	gauges = append(gauges, createMetricFromUint64("NextGC", metricModel.MetricTypeGauge, memStats.NextGC))
-	gauges = append(gauges, createMetricFromUint32("NumForcedGC", metricModel.MetricTypeGauge, memStats.NumForcedGC))
-	gauges = append(gauges, createMetricFromUint32("NumGC", metricModel.MetricTypeGauge, memStats.NumGC))
-	gauges = append(gauges, createMetricFromUint64("OtherSys", metricModel.MetricTypeGauge, memStats.OtherSys))
-	gauges = append(gauges, createMetricFromUint64("PauseTotalNs", metricModel.MetricTypeGauge, memStats.PauseTotalNs))
-	gauges = append(gauges, createMetricFromUint64("StackInuse", metricModel.MetricTypeGauge, memStats.StackInuse))
-	gauges = append(gauges, createMetricFromUint64("StackSys", metricModel.MetricTypeGauge, memStats.StackSys))
-	gauges = append(gauges, createMetricFromUint64("Sys", metricModel.MetricTypeGauge, memStats.Sys))
-	gauges = append(gauges, createMetricFromUint64("TotalAlloc", metricModel.MetricTypeGauge, memStats.TotalAlloc))
-	gauges = append(gauges, createMetricFromUint64("StackInuse", metricModel.MetricTypeGauge, memStats.StackInuse))
-	gauges = append(gauges, createMetricFromUint64("MSpanInuse", metricModel.MetricTypeGauge, memStats.MSpanInuse))
-	gauges = append(gauges, createMetricFromUint64("MSpanSys", metricModel.MetricTypeGauge, memStats.MSpanSys))
-	gauges = append(gauges, createMetricFromFloat64("RandomValue", metricModel.MetricTypeGauge, collectRandomValue()))
-
-	return gauges
+// dropRejectedBatch - функция для учета пачки, отклоненной сервером.
+func dropRejectedBatch(err error) {
+	log.Printf("Dropping rejected metrics batch (%d total): %v", rejectedBatches.Add(1), err)
 }
 
-func collectPollCount(PollCount int64) []metricModel.Metric {
-	var counter []metricModel.Metric
-	counter = append(counter, createMetricFromInt64("PollCount", metricModel.MetricTypeCounter, PollCount))
-	return counter
+// isRejectedStatus сообщает, что HTTP статус означает отказ сервера принять пачку.
+// Ошибки 4xx постоянные, кроме 408 и 429: после них пачку стоит отправить повторно.
+func isRejectedStatus(code int) bool {
+	return code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
 }
 
-func collectRandomValue() float64 {
-	return rand.Float64()
+// isRejectedCode сообщает, что код ошибки gRPC означает отказ сервера принять пачку.
+func isRejectedCode(code codes.Code) bool {
+	switch code {
+	case codes.InvalidArgument, codes.Unauthenticated, codes.PermissionDenied, codes.FailedPrecondition, codes.OutOfRange:
+		return true
+	default:
+		return false
+	}
 }
 
-func sendMetricsButch(metrics []metricModel.Metric) {
+// sendMetricsButch - функция для отправки пачки метрик на сервер по HTTP.
+// Возвращает ошибку, если все попытки отправки завершились неудачей.
+// Если сервер отклонил пачку, повторных попыток нет и возвращается ошибка errBatchRejected.
+func sendMetricsButch(metrics []metricModel.Metric) error {
 	cfg, err := config.LoadAgent()
 
 	if err != nil {
-		fmt.Printf("Failed to prepare agent config: %v\n", err)
-		return
+		return fmt.Errorf("failed to prepare agent config: %w", err)
 	}
 	data, err := json.Marshal(metrics)
 
 	if err != nil {
-		log.Println("Error when serialization object:", err)
+		return fmt.Errorf("error when serialization object: %w", err)
 	}
 
-	// Шифруем данные перед отправкой
-	encryptedData, err := encode.EncryptData(data)
-	if err != nil {
-		log.Println("Error when encrypting data:", err)
-		return
-	}
+	contentEncoding := "gzip"
 
-	url := fmt.Sprintf("http://%s/updates/", cfg.FlagRunAddr)
-	b, err := utils.GzipCompress(encryptedData)
+	// Шифруем данные перед отправкой, если задан публичный ключ сервера.
+	// При TLS шифрование RSA можно отключить, не задавая ключ
+	if cfg.CryptoKey != "" {
+		data, err = encode.EncryptData(data)
+		if err != nil {
+			return fmt.Errorf("error when encrypting data: %w", err)
+		}
+		contentEncoding = "gzip,encrypted"
+	}
 
-	if err != nil {
-		log.Println("Error when compress data:", err.Error())
+	scheme := "http"
+	if agentTLS != nil {
+		scheme = "https"
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(b))
+	url := fmt.Sprintf("%s://%s/updates/", scheme, cfg.FlagRunAddr)
+	b, err := utils.GzipCompress(data)
+
 	if err != nil {
-		log.Println("Error when created request data:", err.Error())
+		return fmt.Errorf("error when compress data: %w", err)
 	}
 
 	hashAgent := hash.CalculateHashAgent(b)
-	if hashAgent != "" {
-		req.Header.Add("HashSHA256", hashAgent)
-	}
-
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Content-Encoding", "gzip,encrypted")
-
 	localIP := getIP()
-	if localIP != "" {
-		req.Header.Add("X-Real-IP", localIP)
-	}
 
-	client := &http.Client{}
-	//TODO вынести в отдельную функцию
-	retryDelays := []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second}
+	lastErr := errors.New("no attempts were made")
 	for attempt, delay := range retryDelays {
-		resp, err := client.Do(req)
+		// Запрос создается на каждую попытку, так как тело запроса вычитывается при отправке
+		req, err := http.NewRequest("POST", url, bytes.NewBuffer(b))
 		if err != nil {
-			log.Printf("Error when sending data (attempt %d/%d): %v", attempt+1, len(retryDelays), err)
-			time.Sleep(delay)
-			continue
+			return fmt.Errorf("error when created request data: %w", err)
 		}
 
-		err = resp.Body.Close()
-		if err != nil {
-			log.Println("Error closing the connection:", err)
+		if hashAgent != "" {
+			req.Header.Add("HashSHA256", hashAgent)
 		}
 
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			log.Println("Data sent successfully.")
-			return
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("Content-Encoding", contentEncoding)
+
+		if localIP != "" {
+			req.Header.Add("X-Real-IP", localIP)
+		}
+
+		resp, err := httpClient.Do(req)
+		if err == nil {
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				log.Println("Error closing the connection:", closeErr)
+			}
+
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				log.Println("Data sent successfully.")
+				return nil
+			}
+
+			if isRejectedStatus(resp.StatusCode) {
+				return fmt.Errorf("%w: status code %d", errBatchRejected, resp.StatusCode)
+			}
+
+			err = fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+
+		lastErr = err
+		log.Printf("Error when sending data (attempt %d/%d): %v", attempt+1, len(retryDelays), err)
+		if attempt < len(retryDelays)-1 {
+			time.Sleep(delay)
 		}
 	}
+
+	return lastErr
 }
 
-func sendMetricsButchGRPC(metrics []metricModel.Metric) {
-	// Установка gRPC соединения
-	conn, err := createGRPCConnection("127.0.0.1:3200")
+// sendMetricsButchGRPC - функция для отправки пачки метрик на сервер по gRPC.
+// Используются общие для всех воркеров соединение и поток StreamMetrics.
+func sendMetricsButchGRPC(metrics []metricModel.Metric) error {
+	conn, stream, err := getGRPCConnection()
 	if err != nil {
-		log.Printf("Failed to connect: %v", err)
-		return
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	return sendMetricsStreamGRPC(stream, conn, metrics)
+}
+
+// sendMetricsStreamGRPC - функция для отправки пачки метрик через поток stream.
+// Если сервер не поддерживает metrics.v3, пачка отправляется унарным вызовом SendMetricsBatch.
+func sendMetricsStreamGRPC(stream *metricsStream, conn grpc.ClientConnInterface, metrics []metricModel.Metric) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	err := stream.Send(ctx, toProtoMetrics(metrics))
+	if status.Code(err) == codes.Unimplemented {
+		return sendMetricsGRPC(conn, metrics)
+	}
+
+	if isRejectedCode(status.Code(err)) {
+		return fmt.Errorf("%w: %v", errBatchRejected, err)
 	}
-	defer conn.Close()
 
+	if err != nil {
+		return fmt.Errorf("failed to stream metrics via gRPC: %w", err)
+	}
+
+	return nil
+}
+
+// sendMetricsGRPC - функция для отправки пачки метрик через соединение conn
+// методом SendMetricsBatch сервиса metrics.v1.
+func sendMetricsGRPC(conn grpc.ClientConnInterface, metrics []metricModel.Metric) error {
 	// Создание gRPC клиента
-	client := pbV2.NewMetricServiceClient(conn)
+	client := pbV1.NewMetricServiceClient(conn)
+	pbMetrics := toProtoMetrics(metrics)
+
+	// Отправка метрик
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	response, err := client.SendMetricsBatch(ctx, &pbV1.SendMetricsBatchRequest{Metrics: pbMetrics})
+	if isRejectedCode(status.Code(err)) {
+		return fmt.Errorf("%w: %v", errBatchRejected, err)
+	}
 
-	// Преобразование метрик в формат protobuf
+	if err != nil {
+		return fmt.Errorf("failed to send metrics via gRPC: %w", err)
+	}
+
+	// Сервер отвечает Success: false на некорректные метрики
+	if !response.Success {
+		return fmt.Errorf("%w: %s", errBatchRejected, response.Message)
+	}
+
+	log.Printf("Metrics sent successfully via gRPC. Message: %s", response.Message)
+	return nil
+}
+
+// toProtoMetrics - функция для преобразования метрик в формат protobuf.
+func toProtoMetrics(metrics []metricModel.Metric) []*pbBase.Metric {
 	pbMetrics := make([]*pbBase.Metric, len(metrics))
 	for i, m := range metrics {
 		pbMetric := &pbBase.Metric{
-			Id:   m.ID,
-			Type: metric.MetricTypeToProto(m.MType),
+			Id:     m.ID,
+			Type:   metric.MetricTypeToProto(m.MType),
+			Labels: m.Labels,
 		}
 
 		switch m.MType {
@@ -433,27 +734,16 @@ func sendMetricsButchGRPC(metrics []metricModel.Metric) {
 			if m.Delta != nil {
 				pbMetric.Delta = *m.Delta
 			}
+		case metricModel.MetricTypeHistogram:
+			pbMetric.Histogram = metric.HistogramToProto(m.Histogram)
+		case metricModel.MetricTypeSummary:
+			pbMetric.Summary = metric.SummaryToProto(m.Summary)
 		}
 
 		pbMetrics[i] = pbMetric
 	}
 
-	// Отправка метрик
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-
-	response, err := client.SendMetricsBatch(ctx, &pbV2.SendMetricsBatchRequest{Metrics: pbMetrics})
-	if err != nil {
-
-		log.Printf("Failed to send metrics via gRPC: %v", err)
-		return
-	}
-
-	if response.Success {
-		log.Printf("Metrics sent successfully via gRPC. Message: %s", response.Message)
-	} else {
-		log.Printf("Failed to send metrics via gRPC. Message: %s", response.Message)
-	}
+	return pbMetrics
 }
 
 func getIP() string {
@@ -472,40 +762,51 @@ func getIP() string {
 	return ""
 }
 
-func createMetricFromFloat64(name string, typeMetric metricModel.MetricType, value float64) metricModel.Metric {
-	var metric metricModel.Metric
-	metric.ID = name
-	metric.MType = typeMetric
-	metric.Value = &value
-	return metric
-}
+// getGRPCConnection возвращает общее gRPC соединение с сервером и поток StreamMetrics.
+// grpc.NewClient не устанавливает соединение сразу, а переподключается при обрывах сам,
+// поэтому одно соединение можно использовать все время работы агента.
+func getGRPCConnection() (*grpc.ClientConn, *metricsStream, error) {
+	grpcConnOnce.Do(func() {
+		cfg, err := config.LoadAgent()
+		if err != nil {
+			grpcConnErr = err
+			return
+		}
 
-func createMetricFromUint64(name string, typeMetric metricModel.MetricType, value uint64) metricModel.Metric {
-	var metric metricModel.Metric
-	metric.ID = name
-	metric.MType = typeMetric
-	floatValue := float64(value)
-	metric.Value = &floatValue
-	return metric
-}
+		grpcConn, grpcConnErr = createGRPCConnection(cfg.GRPCAddress, agentTLS,
+			grpc.WithChainUnaryInterceptor(interceptors.UnaryClient(getIP(), cfg.Key)),
+			grpc.WithChainStreamInterceptor(interceptors.StreamClient(getIP(), cfg.Key)),
+			grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)),
+		)
+		if grpcConnErr == nil {
+			grpcStream = newMetricsStream(grpcConn, cfg.StreamWindow)
+		}
+	})
 
-func createMetricFromInt64(name string, typeMetric metricModel.MetricType, value int64) metricModel.Metric {
-	var metric metricModel.Metric
-	metric.ID = name
-	metric.MType = typeMetric
-	metric.Delta = &value
-	return metric
+	return grpcConn, grpcStream, grpcConnErr
 }
 
-func createMetricFromUint32(name string, typeMetric metricModel.MetricType, value uint32) metricModel.Metric {
-	var metric metricModel.Metric
-	metric.ID = name
-	metric.MType = typeMetric
-	floatValue := float64(value)
-	metric.Value = &floatValue
-	return metric
+// closeGRPCConnection закрывает общие поток и gRPC соединение, если они были созданы.
+func closeGRPCConnection() {
+	if grpcConn == nil {
+		return
+	}
+
+	grpcStream.Close()
+
+	if err := grpcConn.Close(); err != nil {
+		log.Println("Error closing the gRPC connection:", err)
+	}
 }
 
-func createGRPCConnection(address string) (*grpc.ClientConn, error) {
-	return grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// createGRPCConnection создает gRPC соединение с сервером.
+// Если tlsConfig не nil, соединение защищается TLS.
+func createGRPCConnection(address string, tlsConfig *tls.Config, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, opts...)
+	return grpc.NewClient(address, opts...)
 }
@@ -1,66 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/dip96/metrics/internal/collector"
+	"github.com/dip96/metrics/internal/config"
 	"github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/spool"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 )
 
-func TestCollectMetrics(t *testing.T) {
-	// Проверяем, что функция возвращает срез метрик
-	metrics := collectMetrics(1)
-	assert.NotEmpty(t, metrics)
-
-	// Проверяем наличие счетчика PollCount
-	var pollCountFound bool
-	for _, m := range metrics {
-		if m.ID == "PollCount" && m.MType == metric.MetricTypeCounter {
-			pollCountFound = true
-			break
-		}
-	}
-	assert.True(t, pollCountFound)
-
-	// Проверяем наличие метрик gauge
-	var gaugesFound bool
-	for _, m := range metrics {
-		if m.MType == metric.MetricTypeGauge {
-			gaugesFound = true
-			break
-		}
-	}
-	assert.True(t, gaugesFound)
-}
-
-func TestCollectGopsutilMetrics(t *testing.T) {
-	metrics := collectGopsutilMetrics()
-	assert.NotEmpty(t, metrics)
-
-	// Проверяем наличие метрик памяти
-	var memMetricsFound bool
-	for _, m := range metrics {
-		if m.ID == "TotalMemory" || m.ID == "FreeMemory" {
-			memMetricsFound = true
-			break
-		}
-	}
-	assert.True(t, memMetricsFound)
-
-	// Проверяем наличие метрик использования CPU
-	var cpuMetricsFound bool
-	for _, m := range metrics {
-		if strings.HasPrefix(m.ID, "CPUutilization") {
-			cpuMetricsFound = true
-			break
-		}
-	}
-	assert.True(t, cpuMetricsFound)
-}
-
 func TestMergeMetrics(t *testing.T) {
 	metricsChan := make(chan []metric.Metric)
 	gopsutilMetricsChan := make(chan []metric.Metric)
@@ -130,97 +87,287 @@ func TestMergeMetrics(t *testing.T) {
 //	close(stop)
 //}
 
-func TestCreateMetricFromFloat64(t *testing.T) {
-	name := "float_metric"
-	value := 42.0
-	m := createMetricFromFloat64(name, metric.MetricTypeGauge, value)
-	assert.Equal(t, name, m.ID)
-	assert.Equal(t, metric.MetricTypeGauge, m.MType)
-	assert.Equal(t, value, *m.Value)
+func TestApplyLabels(t *testing.T) {
+	metrics := []metric.Metric{
+		{ID: "metric1"},
+		{ID: "metric2", Labels: map[string]string{"host": "override"}},
+	}
+
+	result := applyLabels(metrics, map[string]string{"host": "agent", "region": "eu"})
+
+	assert.Equal(t, map[string]string{"host": "agent", "region": "eu"}, result[0].Labels)
+	assert.Equal(t, map[string]string{"host": "override", "region": "eu"}, result[1].Labels)
 }
 
-func TestCreateMetricFromUint64(t *testing.T) {
-	name := "uint64_metric"
-	value := uint64(42)
-	m := createMetricFromUint64(name, metric.MetricTypeGauge, value)
-	assert.Equal(t, name, m.ID)
-	assert.Equal(t, metric.MetricTypeGauge, m.MType)
-	assert.Equal(t, float64(value), *m.Value)
+func TestDeliverMetrics(t *testing.T) {
+	queue, err := spool.NewQueue(t.TempDir(), 0, 0)
+	assert.NoError(t, err)
+
+	serverDown := true
+	var delivered []string
+	send := func(metrics []metric.Metric) error {
+		if serverDown {
+			return errors.New("server is down")
+		}
+		for _, m := range metrics {
+			delivered = append(delivered, m.ID)
+		}
+		return nil
+	}
+
+	// Пока сервер недоступен, пачки копятся в очереди
+	deliverMetrics(queue, []metric.Metric{{ID: "metric1"}}, send)
+	deliverMetrics(queue, []metric.Metric{{ID: "metric2"}}, send)
+	assert.Equal(t, 2, queue.Len())
+	assert.Empty(t, delivered)
+
+	// Пока в очереди есть пачки, новая пачка ставится в конец очереди без отправки
+	serverDown = false
+	deliverMetrics(queue, []metric.Metric{{ID: "metric3"}}, send)
+	assert.Equal(t, 3, queue.Len())
+	assert.Empty(t, delivered)
+
+	// Очередь отправляется в порядке поступления
+	replaySpool(queue, send)
+	assert.Equal(t, 0, queue.Len())
+	assert.Equal(t, []string{"metric1", "metric2", "metric3"}, delivered)
 }
 
-func TestCreateMetricFromInt64(t *testing.T) {
-	name := "int64_metric"
-	value := int64(42)
-	m := createMetricFromInt64(name, metric.MetricTypeCounter, value)
-	assert.Equal(t, name, m.ID)
-	assert.Equal(t, metric.MetricTypeCounter, m.MType)
-	assert.Equal(t, value, *m.Delta)
+func TestDeliverMetricsRejectedBatch(t *testing.T) {
+	queue, err := spool.NewQueue(t.TempDir(), 0, 0)
+	assert.NoError(t, err)
+
+	serverDown := true
+	var delivered []string
+	send := func(metrics []metric.Metric) error {
+		if metrics[0].ID == "invalid" {
+			return fmt.Errorf("%w: status code %d", errBatchRejected, http.StatusBadRequest)
+		}
+		if serverDown {
+			return errors.New("server is down")
+		}
+		for _, m := range metrics {
+			delivered = append(delivered, m.ID)
+		}
+		return nil
+	}
+
+	// Отклоненная пачка отбрасывается и не попадает в очередь
+	rejected := rejectedBatches.Load()
+	deliverMetrics(queue, []metric.Metric{{ID: "invalid"}}, send)
+	assert.Equal(t, 0, queue.Len())
+	assert.Equal(t, rejected+1, rejectedBatches.Load())
+
+	// Отклоненная пачка в очереди не задерживает следующие
+	deliverMetrics(queue, []metric.Metric{{ID: "metric1"}}, send)
+	assert.NoError(t, queue.Push([]byte(`[{"id":"invalid"}]`)))
+	deliverMetrics(queue, []metric.Metric{{ID: "metric2"}}, send)
+	assert.Equal(t, 3, queue.Len())
+
+	serverDown = false
+	replaySpool(queue, send)
+	assert.Equal(t, 0, queue.Len())
+	assert.Equal(t, []string{"metric1", "metric2"}, delivered)
+	assert.Equal(t, rejected+2, rejectedBatches.Load())
 }
 
-func TestCreateMetricFromUint32(t *testing.T) {
-	name := "uint32_metric"
-	value := uint32(42)
-	m := createMetricFromUint32(name, metric.MetricTypeGauge, value)
-	assert.Equal(t, name, m.ID)
-	assert.Equal(t, metric.MetricTypeGauge, m.MType)
-	assert.Equal(t, float64(value), *m.Value)
+func TestSendMetricsButchRejected(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	cfg, err := config.LoadAgent()
+	require.NoError(t, err)
+	runAddr, cryptoKey := cfg.FlagRunAddr, cfg.CryptoKey
+	cfg.FlagRunAddr, cfg.CryptoKey = strings.TrimPrefix(server.URL, "http://"), ""
+	defer func() { cfg.FlagRunAddr, cfg.CryptoKey = runAddr, cryptoKey }()
+
+	// Пачка, отклоненная сервером, не отправляется повторно
+	err = sendMetricsButch([]metric.Metric{{ID: "metric1", MType: metric.MetricTypeGauge, Value: Float64Ptr(1)}})
+	assert.ErrorIs(t, err, errBatchRejected)
+	assert.Equal(t, 1, requests)
 }
 
-// MetricsSender интерфейс для отправки метрик.
-type MetricsSender interface {
-	send(metrics []metric.Metric)
+func TestDeliverMetricsNoReplayAfterFailure(t *testing.T) {
+	queue, err := spool.NewQueue(t.TempDir(), 0, 0)
+	assert.NoError(t, err)
+
+	attempts := 0
+	send := func(metrics []metric.Metric) error {
+		attempts++
+		return errors.New("server is down")
+	}
+
+	// Неудачная пачка сохраняется в очередь и сразу не повторяется
+	deliverMetrics(queue, []metric.Metric{{ID: "metric1"}}, send)
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, 1, queue.Len())
+
+	// Пока очередь не пуста, новые пачки не отправляются
+	deliverMetrics(queue, []metric.Metric{{ID: "metric2"}}, send)
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, 2, queue.Len())
+
+	// Повтор по таймеру останавливается на первой ошибке
+	replaySpool(queue, send)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 2, queue.Len())
 }
 
 func TestSendMetricsRoutine(t *testing.T) {
-	//TODO доработать
-	jobChan := make(chan metric.Metric, 1)
-	stop := make(chan struct{})
-	//sender := &fakeMetricsSender{}
+	jobChan := make(chan []metric.Metric, 1)
+
+	var mu sync.Mutex
+	var sent []string
+	send := func(metrics []metric.Metric) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, m := range metrics {
+			sent = append(sent, m.ID)
+		}
+		return nil
+	}
 
-	go sendMetricsRoutine(jobChan, stop)
+	done := make(chan struct{})
+	go func() {
+		sendMetricsRoutine(jobChan, send)
+		close(done)
+	}()
 
-	jobChan <- metric.Metric{
+	jobChan <- []metric.Metric{{
 		ID:    "test_metric",
 		MType: metric.MetricTypeGauge,
 		Value: Float64Ptr(10.5),
-	}
+	}}
+	close(jobChan)
+	<-done
 
-	time.Sleep(100 * time.Millisecond)
+	// Каждая пачка отправляется выбранным способом ровно один раз
+	assert.Equal(t, []string{"test_metric"}, sent)
+}
 
-	close(stop)
+func TestBatchMetrics(t *testing.T) {
+	t.Run("size bounded", func(t *testing.T) {
+		metricsChan := make(chan []metric.Metric)
+		jobChan := make(chan []metric.Metric, 10)
+
+		done := make(chan struct{})
+		go func() {
+			batchMetrics(metricsChan, jobChan, 2, time.Hour, map[string]string{"host": "agent"})
+			close(done)
+		}()
+
+		metricsChan <- []metric.Metric{{ID: "metric1"}, {ID: "metric2"}, {ID: "metric3"}}
+		close(metricsChan)
+		<-done
+		close(jobChan)
+
+		var batches [][]metric.Metric
+		for batch := range jobChan {
+			batches = append(batches, batch)
+		}
+
+		// Полная пачка отправляется сразу, остаток - после закрытия канала
+		assert.Len(t, batches, 2)
+		assert.Len(t, batches[0], 2)
+		assert.Len(t, batches[1], 1)
+		assert.Equal(t, "metric3", batches[1][0].ID)
+		assert.Equal(t, map[string]string{"host": "agent"}, batches[1][0].Labels)
+	})
+
+	t.Run("time bounded", func(t *testing.T) {
+		metricsChan := make(chan []metric.Metric)
+		jobChan := make(chan []metric.Metric, 10)
+
+		go batchMetrics(metricsChan, jobChan, 100, 50*time.Millisecond, nil)
+		defer close(metricsChan)
+
+		metricsChan <- []metric.Metric{{ID: "metric1"}}
+		metricsChan <- []metric.Metric{{ID: "metric2"}}
+
+		select {
+		case batch := <-jobChan:
+			assert.Equal(t, []metric.Metric{{ID: "metric1"}, {ID: "metric2"}}, batch)
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected batch, but got timeout")
+		}
+	})
+}
+
+// fakeCollector - сборщик, возвращающий заданный набор метрик.
+type fakeCollector struct {
+	name    string
+	metrics []metric.Metric
+}
+
+func (f *fakeCollector) Name() string {
+	return f.name
+}
 
-	//assert.True(t, sender, "sendMetricsButch should have been called")
+func (f *fakeCollector) Collect(_ context.Context) ([]metric.Metric, error) {
+	return f.metrics, nil
 }
-func TestCollectMetricsRoutine(t *testing.T) {
+
+func TestCollectRoutine(t *testing.T) {
 	metricsChan := make(chan []metric.Metric, 1)
 	stop := make(chan struct{})
 
-	go collectMetricsRoutine(metricsChan, stop)
+	wg.Add(1)
+	go collectRoutine(collector.NewRuntime(), 100*time.Millisecond, metricsChan, stop)
 
 	select {
 	case metrics := <-metricsChan:
 		assert.NotEmpty(t, metrics)
-	case <-time.After(2 * time.Second): // Slightly more than the 1-second interval
+	case <-time.After(2 * time.Second):
 		t.Fatal("Expected metrics, but got timeout")
 	}
 
 	close(stop)
+	wg.Wait()
 }
 
-func TestCollectGopsutilMetricsRoutine_Stop(t *testing.T) {
-	gopsutilMetricsChan := make(chan []metric.Metric, 1)
+func TestCollectRoutine_Stop(t *testing.T) {
+	metricsChan := make(chan []metric.Metric, 1)
 	stop := make(chan struct{})
 
-	go collectGopsutilMetricsRoutine(gopsutilMetricsChan, stop)
+	wg.Add(1)
+	go collectRoutine(&fakeCollector{name: "fake"}, time.Hour, metricsChan, stop)
 	close(stop)
+	wg.Wait()
+
+	// После остановки канал закрыт и метрик в нем нет
+	_, ok := <-metricsChan
+	assert.False(t, ok)
+}
 
-	time.Sleep(6 * time.Second)
+func TestStartCollectors(t *testing.T) {
+	registry := collector.NewRegistry()
+	assert.NoError(t, registry.Register(&fakeCollector{name: "enabled", metrics: []metric.Metric{{ID: "metric1"}}}, 50*time.Millisecond))
+	assert.NoError(t, registry.Register(&fakeCollector{name: "disabled", metrics: []metric.Metric{{ID: "metric2"}}}, 50*time.Millisecond))
+
+	disabled := false
+	cfg := &config.Agent{
+		Collectors: map[string]config.CollectorConfig{
+			"disabled": {Enabled: &disabled},
+		},
+	}
+
+	stop := make(chan struct{})
+	collected := startCollectors(cfg, registry, stop)
+	assert.Len(t, collected, 1)
 
 	select {
-	case <-gopsutilMetricsChan:
-		t.Fatal("Expected no metrics, but received some")
-	default:
+	case metrics := <-collected[0]:
+		assert.Equal(t, []metric.Metric{{ID: "metric1"}}, metrics)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected metrics, but got timeout")
 	}
+
+	close(stop)
+	wg.Wait()
 }
 
 func TestGracefulShutdown(t *testing.T) {
@@ -281,7 +428,8 @@ func TestPrepareMetricsRoutine(t *testing.T) {
 	stop := make(chan struct{})
 
 	// Запускаем тестируемую функцию в отдельной горутине
-	go prepareMetricsRoutine(metricsChan, gopsutilMetricsChan, stop)
+	wg.Add(1)
+	go prepareMetricsRoutine([]<-chan []metric.Metric{metricsChan, gopsutilMetricsChan}, stop)
 
 	// Отправляем тестовые метрики
 	go func() {
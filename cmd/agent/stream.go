@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pbBase "github.com/dip96/metrics/protobuf/protos/metric/base"
+	pbV3 "github.com/dip96/metrics/protobuf/protos/metric/v3"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+// errStreamClosed - ошибка отправки в закрытый поток.
+var errStreamClosed = errors.New("metrics stream is closed")
+
+// metricsStream - клиент потоковой отправки метрик через StreamMetrics сервиса metrics.v3.
+// Пачки отправляются по одному долгоживущему потоку, каждая пачка подтверждается сервером.
+// Количество неподтвержденных пачек ограничено окном, поэтому агент не переполняет сервер,
+// если тот не успевает сохранять метрики.
+// При обрыве поток пересоздается при следующей отправке.
+type metricsStream struct {
+	client pbV3.MetricServiceClient
+	// window - семафор неподтвержденных пачек.
+	window chan struct{}
+
+	// sendMu упорядочивает вызовы Send потока, которые нельзя делать параллельно.
+	sendMu sync.Mutex
+
+	mu      sync.Mutex
+	stream  pbV3.MetricService_StreamMetricsClient
+	cancel  context.CancelFunc
+	seq     uint64
+	pending map[uint64]chan error
+	closed  bool
+}
+
+// newMetricsStream создает клиент потоковой отправки поверх соединения conn
+// с окном из window неподтвержденных пачек.
+func newMetricsStream(conn grpc.ClientConnInterface, window int) *metricsStream {
+	if window <= 0 {
+		window = 1
+	}
+
+	return &metricsStream{
+		client:  pbV3.NewMetricServiceClient(conn),
+		window:  make(chan struct{}, window),
+		pending: make(map[uint64]chan error),
+	}
+}
+
+// Send отправляет пачку метрик и дожидается ее подтверждения сервером.
+// Если окно заполнено, Send ждет, пока сервер подтвердит одну из предыдущих пачек.
+func (s *metricsStream) Send(ctx context.Context, metrics []*pbBase.Metric) error {
+	select {
+	case s.window <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.window }()
+
+	ack := make(chan error, 1)
+
+	s.sendMu.Lock()
+	s.mu.Lock()
+	stream, err := s.ensureStreamLocked()
+	if err != nil {
+		s.mu.Unlock()
+		s.sendMu.Unlock()
+		return err
+	}
+	s.seq++
+	seq := s.seq
+	s.pending[seq] = ack
+	s.mu.Unlock()
+
+	// При ошибке Send поток уже завершен, а причину обрыва gRPC возвращает из Recv.
+	// receive получит ее и завершит ожидающие пачки, поэтому ошибку Send не обрабатываем
+	_ = stream.Send(&pbV3.MetricsBatch{Sequence: seq, Metrics: metrics})
+	s.sendMu.Unlock()
+
+	select {
+	case err := <-ack:
+		return err
+	case <-ctx.Done():
+		s.mu.Lock()
+		delete(s.pending, seq)
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Close закрывает поток. Неподтвержденные пачки завершаются ошибкой.
+func (s *metricsStream) Close() {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.stream == nil {
+		return
+	}
+
+	_ = s.stream.CloseSend()
+	s.resetLocked(errStreamClosed)
+}
+
+// ensureStreamLocked возвращает открытый поток, при необходимости открывая новый.
+// Вызывается под блокировкой mu.
+func (s *metricsStream) ensureStreamLocked() (pbV3.MetricService_StreamMetricsClient, error) {
+	if s.closed {
+		return nil, errStreamClosed
+	}
+
+	if s.stream != nil {
+		return s.stream, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := s.client.StreamMetrics(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s.stream = stream
+	s.cancel = cancel
+	go s.receive(stream)
+
+	return stream, nil
+}
+
+// receive читает подтверждения из потока и передает их ожидающим отправителям.
+func (s *metricsStream) receive(stream pbV3.MetricService_StreamMetricsClient) {
+	for {
+		ack, err := stream.Recv()
+		if err != nil {
+			s.fail(stream, err)
+			return
+		}
+
+		s.mu.Lock()
+		pending, ok := s.pending[ack.Sequence]
+		delete(s.pending, ack.Sequence)
+		s.mu.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		if ack.Success {
+			pending <- nil
+		} else {
+			pending <- errors.New(ack.Message)
+		}
+	}
+}
+
+// fail закрывает поток stream после ошибки, если он еще используется.
+func (s *metricsStream) fail(stream pbV3.MetricService_StreamMetricsClient, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stream != stream {
+		return
+	}
+
+	s.resetLocked(err)
+}
+
+// resetLocked сбрасывает текущий поток и завершает ожидающие отправки ошибкой err.
+// Вызывается под блокировкой mu.
+func (s *metricsStream) resetLocked(err error) {
+	s.cancel()
+	s.stream = nil
+	s.cancel = nil
+
+	for seq, pending := range s.pending {
+		pending <- fmt.Errorf("metrics stream failed: %w", err)
+		delete(s.pending, seq)
+	}
+}
@@ -5,24 +5,45 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/dip96/metrics/internal/config"
 	"github.com/dip96/metrics/internal/database/migrator"
+	"github.com/dip96/metrics/internal/graphite"
 	"github.com/dip96/metrics/internal/grpcservices/metric"
 	"github.com/dip96/metrics/internal/hash"
+	"github.com/dip96/metrics/internal/influx"
+	"github.com/dip96/metrics/internal/interceptors"
+	"github.com/dip96/metrics/internal/janitor"
 	"github.com/dip96/metrics/internal/middleware"
 	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/otlp"
+	"github.com/dip96/metrics/internal/prometheus"
+	"github.com/dip96/metrics/internal/query"
+	"github.com/dip96/metrics/internal/remotewrite"
+	"github.com/dip96/metrics/internal/rollup"
+	"github.com/dip96/metrics/internal/statsd"
 	"github.com/dip96/metrics/internal/storage"
 	"github.com/dip96/metrics/internal/storage/files"
 	memStorage "github.com/dip96/metrics/internal/storage/mem"
 	postgresStorage "github.com/dip96/metrics/internal/storage/postgres"
 	"github.com/dip96/metrics/internal/utils"
-	pbV2 "github.com/dip96/metrics/protobuf/protos/metric/v2"
+	pbCollector "github.com/dip96/metrics/protobuf/protos/opentelemetry/proto/collector/metrics/v1"
 	echopprof "github.com/hiko1129/echo-pprof"
 	"github.com/labstack/echo/v4"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	// Регистрирует gzip, чтобы сервер принимал сжатые агентом сообщения
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io"
 	"log"
+	"mime"
 	"net"
 	"net/http"
 	"os"
@@ -35,8 +56,15 @@ import (
 type Servers struct {
 	Echo *echo.Echo
 	GRPC *grpc.Server
+	// StatsD - прием метрик StatsD, nil если прием отключен.
+	StatsD *statsd.Server
+	// Graphite - прием метрик Graphite, nil если прием отключен.
+	Graphite *graphite.Server
 }
 
+// otlpProtobufContentType - тип содержимого OTLP/HTTP в формате protobuf.
+const otlpProtobufContentType = "application/x-protobuf"
+
 var (
 	buildVersion = "N/A"
 	buildDate    = "N/A"
@@ -51,8 +79,7 @@ func AddMetric(c echo.Context) error {
 	nameMetric := c.Param("name_metric")
 	valueMetric := c.Param("value_metric")
 
-	metric, _ := storage.Storage.Get(nameMetric)
-	metric.ID = nameMetric
+	metric := metricModel.Metric{ID: nameMetric}
 
 	if typeMetric == string(metricModel.MetricTypeGauge) {
 		value, err := strconv.ParseFloat(valueMetric, 64)
@@ -63,6 +90,10 @@ func AddMetric(c echo.Context) error {
 		metric.MType = metricModel.MetricTypeGauge
 		metric.Value = &value
 		metric.FullValueGauge = valueMetric
+
+		if err := storage.Storage.Set(metric); err != nil {
+			return c.String(http.StatusBadRequest, "")
+		}
 	} else if typeMetric == string(metricModel.MetricTypeCounter) {
 		value, err := strconv.ParseInt(valueMetric, 10, 64)
 
@@ -71,21 +102,15 @@ func AddMetric(c echo.Context) error {
 		}
 
 		metric.MType = metricModel.MetricTypeCounter
-		if metric.Delta == nil {
-			metric.Delta = &value
-		} else {
-			*metric.Delta += value
+		metric.Delta = &value
+
+		if _, err := storage.Storage.Increment(metric); err != nil {
+			return c.String(http.StatusBadRequest, "")
 		}
 	} else {
 		return c.String(http.StatusBadRequest, "")
 	}
 
-	err := storage.Storage.Set(metric)
-
-	if err != nil {
-		return c.String(http.StatusBadRequest, "")
-	}
-
 	return c.String(http.StatusOK, "")
 }
 
@@ -152,6 +177,320 @@ func getAllMetrics(c echo.Context) error {
 	return c.HTML(http.StatusOK, buf.String())
 }
 
+// getMetricsPrometheus - Эндпоинт для получения всех метрик в формате Prometheus.
+// Формат (text 0.0.4 или OpenMetrics) выбирается по заголовку Accept,
+// ответ сжимается gzip, если клиент это поддерживает.
+func getMetricsPrometheus(c echo.Context) error {
+	metrics, err := storage.Storage.GetAll()
+
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	format := prometheus.NegotiateFormat(c.Request().Header.Get("Accept"))
+
+	var buf bytes.Buffer
+	if err := prometheus.Encode(&buf, metrics, format); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	if utils.AcceptsGzip(c.Request().Header.Get("Accept-Encoding")) {
+		b, err := utils.GzipCompress(buf.Bytes())
+
+		if err != nil {
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+
+		c.Response().Header().Set("Content-Encoding", "gzip")
+		c.Response().Header().Add("Vary", "Accept-Encoding")
+		return c.Blob(http.StatusOK, string(format), b)
+	}
+
+	return c.Blob(http.StatusOK, string(format), buf.Bytes())
+}
+
+// queryRange - Эндпоинт для получения истории значений метрики.
+// Принимает имя метрики (name), условия на метки (match, можно передать несколько раз),
+// период (start, end), шаг (step) и функцию агрегации (aggregation).
+// Возвращает ряды метрики в формате JSON и статус-код 200,
+// или сообщение об ошибке и статус-код 400 при некорректном запросе.
+func queryRange(c echo.Context) error {
+	req, err := parseQueryRange(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	series, err := query.Execute(storage.Storage, req)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, series)
+}
+
+// parseQueryRange разбирает параметры запроса истории значений метрики.
+// Не заданные период и шаг заменяются значениями по умолчанию.
+func parseQueryRange(c echo.Context) (query.Request, error) {
+	req := query.Request{
+		Name: c.QueryParam("name"),
+		End:  time.Now(),
+		Step: query.DefaultStep,
+	}
+
+	var err error
+	if end := c.QueryParam("end"); end != "" {
+		if req.End, err = query.ParseTime(end); err != nil {
+			return req, err
+		}
+	}
+
+	req.Start = req.End.Add(-query.DefaultRange)
+	if start := c.QueryParam("start"); start != "" {
+		if req.Start, err = query.ParseTime(start); err != nil {
+			return req, err
+		}
+	}
+
+	if step := c.QueryParam("step"); step != "" {
+		if req.Step, err = query.ParseStep(step); err != nil {
+			return req, err
+		}
+	}
+
+	if req.Aggregation, err = query.ParseAggregation(c.QueryParam("aggregation")); err != nil {
+		return req, err
+	}
+
+	if req.Matchers, err = parseMatchers(c); err != nil {
+		return req, err
+	}
+
+	return req, nil
+}
+
+// queryRollup - Эндпоинт для получения истории значений метрики по агрегатам уровней прореживания.
+// Принимает те же параметры, что и queryRange. Ответ строится по самому грубому уровню,
+// длина окна которого не превышает шаг, а при меньшем шаге - по исходным отсчетам.
+// Возвращает длину окна уровня (resolution, 0 для исходных отсчетов) и ряды метрики в формате JSON
+// со статус-кодом 200, или сообщение об ошибке и статус-код 400 при некорректном запросе.
+func queryRollup(c echo.Context, roller *rollup.Roller) error {
+	req, err := parseQueryRange(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if err := req.Validate(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	result, err := roller.Query(storage.Storage, req)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// parseMatchers разбирает условия на метки из параметров match.
+func parseMatchers(c echo.Context) ([]*query.Matcher, error) {
+	var matchers []*query.Matcher
+	for _, match := range c.QueryParams()["match"] {
+		matcher, err := query.ParseMatcher(match)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	return matchers, nil
+}
+
+// counterRate - Эндпоинт для получения скорости роста и прироста счетчика с учетом сбросов.
+// Принимает имя метрики (name), условия на метки (match), окно расчета (window) и его конец (end).
+// Возвращает ряды счетчика в формате JSON и статус-код 200,
+// или сообщение об ошибке и статус-код 400 при некорректном запросе.
+func counterRate(c echo.Context) error {
+	name := c.QueryParam("name")
+	if name == "" {
+		return c.String(http.StatusBadRequest, "metric name is empty")
+	}
+
+	window, err := parseRateWindow(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	end := time.Now()
+	if param := c.QueryParam("end"); param != "" {
+		if end, err = query.ParseTime(param); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	matchers, err := parseMatchers(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	counters, err := query.Counters(storage.Storage, name, matchers, end, window)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, counters)
+}
+
+// parseRateWindow разбирает окно расчета скорости счетчика из параметра window.
+// Если параметр не задан, используется query.DefaultRateWindow.
+func parseRateWindow(c echo.Context) (time.Duration, error) {
+	param := c.QueryParam("window")
+	if param == "" {
+		return query.DefaultRateWindow, nil
+	}
+
+	window, err := query.ParseStep(param)
+	if err != nil {
+		return 0, err
+	}
+
+	if window <= 0 {
+		return 0, errors.New("window must be positive")
+	}
+
+	return window, nil
+}
+
+// writeInflux - Эндпоинт для записи метрик в формате InfluxDB line protocol.
+// Принимает строки line protocol в теле запроса и единицу меток времени в параметре precision.
+// Каждое поле сохраняется как gauge или counter по правилам converter.
+// Возвращает статус-код 204 в случае успеха, иначе - ошибку в формате JSON и статус-код 400.
+// Если хотя бы одна строка некорректна, запрос не сохраняется целиком.
+// Значения старше последнего значения своего ряда отбрасываются, остальные сохраняются,
+// а в ответ возвращается статус-код 400 с количеством отброшенных значений.
+func writeInflux(c echo.Context, converter *influx.Converter) error {
+	precision, err := influx.ParsePrecision(c.QueryParam("precision"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	points, err := influx.Parse(string(body), precision)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	metrics, err := converter.Metrics(points)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if len(metrics) == 0 {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	written, err := storage.Storage.Append(metrics)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// Как и InfluxDB, на частичную запись отвечаем 400 с количеством отброшенных значений
+	if dropped := len(metrics) - len(written); dropped > 0 {
+		err = fmt.Errorf("partial write: %w: dropped=%d", storage.ErrOutOfOrder, dropped)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// writeOTLP - Эндпоинт OTLP/HTTP для записи метрик OpenTelemetry.
+// Принимает ExportMetricsServiceRequest в формате protobuf (application/x-protobuf) или JSON (application/json)
+// и отвечает в том же формате: ExportMetricsServiceResponse и статус-код 200 в случае успеха,
+// иначе - google.rpc.Status и статус-код 400 или 500. Для других типов содержимого возвращается статус-код 415.
+func writeOTLP(c echo.Context, receiver *otlp.Receiver) error {
+	contentType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+
+	var (
+		marshal   func(proto.Message) ([]byte, error)
+		unmarshal func([]byte, proto.Message) error
+	)
+	switch contentType {
+	case otlpProtobufContentType:
+		marshal = proto.Marshal
+		unmarshal = proto.Unmarshal
+	case echo.MIMEApplicationJSON:
+		marshal = protojson.Marshal
+		unmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal
+	default:
+		return c.String(http.StatusUnsupportedMediaType, "Unsupported content type")
+	}
+
+	writeResponse := func(code int, msg proto.Message) error {
+		data, err := marshal(msg)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+		return c.Blob(code, contentType, data)
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return writeResponse(http.StatusBadRequest, status.New(codes.InvalidArgument, err.Error()).Proto())
+	}
+
+	req := &pbCollector.ExportMetricsServiceRequest{}
+	if err := unmarshal(body, req); err != nil {
+		return writeResponse(http.StatusBadRequest, status.New(codes.InvalidArgument, err.Error()).Proto())
+	}
+
+	resp, err := receiver.Save(req)
+	if err != nil {
+		return writeResponse(http.StatusInternalServerError, status.New(codes.Internal, err.Error()).Proto())
+	}
+
+	return writeResponse(http.StatusOK, resp)
+}
+
+// writeRemote - Эндпоинт Prometheus remote write 1.0.
+// Принимает WriteRequest в формате protobuf, сжатый snappy.
+// Возвращает статус-код 204 в случае успеха, иначе - текст ошибки и статус-код 400 или 500.
+// Если хотя бы один ряд некорректен, запрос не сохраняется целиком.
+func writeRemote(c echo.Context, receiver *remotewrite.Receiver) error {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	req, err := remotewrite.Decode(body)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	batch, err := receiver.Convert(req)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	// Prometheus не повторяет запрос после ответа 400, поэтому устаревшие отсчеты не присылаются снова
+	err = receiver.Save(batch)
+	if errors.Is(err, storage.ErrOutOfOrder) {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
 // AddMetricV2 - Эндпоинт для добавления метрики в формате JSON.
 // Принимает структуру Metric в теле запроса.
 // Возвращает добавленную метрику в формате JSON и статус-код 200 в случае успеха,
@@ -163,31 +502,40 @@ func AddMetricV2(c echo.Context) error {
 		return err
 	}
 
-	typeMetric := body.MType
-	nameMetric := body.ID
-	metric, _ := storage.Storage.Get(nameMetric)
-	metric.ID = body.ID
+	metric := metricModel.Metric{
+		ID:     body.ID,
+		MType:  body.MType,
+		Labels: body.Labels,
+	}
 
-	if typeMetric == metricModel.MetricTypeGauge {
-		valueMetric := body.Value
-		metric.MType = metricModel.MetricTypeGauge
-		metric.Value = valueMetric
-		metric.FullValueGauge = fmt.Sprintf("%f", *valueMetric)
-	} else if typeMetric == metricModel.MetricTypeCounter {
-		valueMetric := body.Delta
-		if metric.Delta == nil {
-			metric.MType = metricModel.MetricTypeCounter
-			metric.Delta = valueMetric
-		} else {
-			*metric.Delta += *valueMetric
+	if body.MType == metricModel.MetricTypeGauge && body.Value != nil {
+		metric.Value = body.Value
+		metric.FullValueGauge = fmt.Sprintf("%f", *body.Value)
+
+		if err := storage.Storage.Set(metric); err != nil {
+			return c.String(http.StatusBadRequest, "")
 		}
-	} else {
-		return c.String(http.StatusBadRequest, "")
-	}
+	} else if body.MType == metricModel.MetricTypeCounter && body.Delta != nil {
+		metric.Delta = body.Delta
 
-	err := storage.Storage.Set(metric)
+		updated, err := storage.Storage.Increment(metric)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "")
+		}
+		metric = updated
+	} else if body.MType == metricModel.MetricTypeHistogram || body.MType == metricModel.MetricTypeSummary {
+		metric.Histogram = body.Histogram
+		metric.Summary = body.Summary
+		if err := metric.Validate(); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
 
-	if err != nil {
+		updated, err := storage.Storage.Increment(metric)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "")
+		}
+		metric = updated
+	} else {
 		return c.String(http.StatusBadRequest, "")
 	}
 
@@ -237,13 +585,27 @@ func GetMetricV2(c echo.Context) error {
 		return err
 	}
 
-	nameMetric := body.ID
-	metric, err := storage.Storage.Get(nameMetric)
+	metric, err := storage.Storage.Get(body.Key())
 
 	if err != nil {
 		return c.String(http.StatusNotFound, err.Error())
 	}
 
+	if metric.MType == metricModel.MetricTypeCounter {
+		window, err := parseRateWindow(c)
+		if err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+
+		counter, err := query.Counter(storage.Storage, body.Key(), time.Now(), window)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+
+		metric.Rate = &counter.Rate
+		metric.Increase = &counter.Increase
+	}
+
 	jsonData, err := json.Marshal(metric)
 
 	if err != nil {
@@ -273,7 +635,7 @@ func GetMetricV2(c echo.Context) error {
 	if hashServer != "" {
 		c.Response().Header().Set("HashSHA256", hashServer)
 	}
-	return c.JSON(http.StatusOK, jsonData)
+	return c.JSONBlob(http.StatusOK, jsonData)
 }
 
 // ping - Функция для проверки соединения с базой данных PostgreSQL.
@@ -299,30 +661,34 @@ func AddMetrics(c echo.Context) error {
 		return err
 	}
 
+	// Значения gauge сохраняются одной пачкой, счетчики, гистограммы и summary
+	// объединяются атомарно по одному, чтобы параллельные запросы агентов не теряли приращения
 	metricsSave := make(map[string]metricModel.Metric)
-	//TODO придумать что-нибудь получше
-	var newMetric bool
-	for _, metricValue := range metrics {
-		if metricValue.MType == metricModel.MetricTypeCounter {
-			metric, _ := storage.Storage.Get(metricValue.ID)
-
-			if _, ok := metricsSave[metricValue.ID]; !ok {
-				metricsSave[metricValue.ID] = metricValue
-				newMetric = true
-			}
-
-			if metric.Delta != nil {
-				valueMetric := metric.Delta
-				*metricsSave[metricValue.ID].Delta += *valueMetric
-			} else if !newMetric {
-				*metricsSave[metricValue.ID].Delta += *metricValue.Delta
+	var counters []metricModel.Metric
+	for i := range metrics {
+		// Время обновления ряда задает только сервер
+		metrics[i].UpdatedAt = nil
+		metricValue := metrics[i]
+
+		switch {
+		case metricValue.MType == metricModel.MetricTypeGauge && metricValue.Value != nil:
+			metricsSave[metricValue.Key()] = metricValue
+		case metricValue.MType == metricModel.MetricTypeCounter && metricValue.Delta != nil:
+			counters = append(counters, metricValue)
+		case metricValue.MType == metricModel.MetricTypeHistogram || metricValue.MType == metricModel.MetricTypeSummary:
+			if err := metricValue.Validate(); err != nil {
+				return c.String(http.StatusBadRequest, err.Error())
 			}
-
-			newMetric = false
-			continue
+			counters = append(counters, metricValue)
+		default:
+			return c.String(http.StatusBadRequest, "")
 		}
+	}
 
-		metricsSave[metricValue.ID] = metricValue
+	for _, counter := range counters {
+		if _, err := storage.Storage.Increment(counter); err != nil {
+			return c.String(http.StatusBadRequest, "")
+		}
 	}
 
 	err := storage.Storage.SetAll(metricsSave)
@@ -367,6 +733,22 @@ func AddMetrics(c echo.Context) error {
 	return c.JSON(http.StatusOK, jsonData)
 }
 
+// newRouter создает echo с общими middleware и две группы маршрутов.
+// agent - маршруты агента: проверка доверенной подсети и подписи ключом агента, распаковка и расшифровка тела.
+// ingest - приемники сторонних форматов (Telegraf, Prometheus, OpenTelemetry), клиенты которых
+// не подписывают запросы ключом агента: проверка доверенной подсети по адресу клиента и распаковка тела.
+func newRouter() (*echo.Echo, *echo.Group, *echo.Group) {
+	e := echo.New()
+	e.Use(middleware.AgentIdentity)
+	e.Use(middleware.Logger)
+
+	ingest := e.Group("", middleware.CheckIngestIP, middleware.UnzipMiddleware)
+	// Группа агента создается последней, чтобы неизвестные маршруты проходили ее проверки, как и раньше
+	agent := e.Group("", middleware.CheckIP, middleware.CheckHash, middleware.UnzipMiddleware, middleware.DecodeMiddleware)
+
+	return e, agent, ingest
+}
+
 func main() {
 	printBuildInfo()
 	cfg, err := config.LoadServer()
@@ -376,21 +758,25 @@ func main() {
 		panic(err)
 	}
 
-	e := echo.New()
-	e.Use(middleware.Logger)
-	e.Use(middleware.CheckIP)
-	e.Use(middleware.CheckHash)
-	e.Use(middleware.UnzipMiddleware)
-	e.Use(middleware.DecodeMiddleware)
+	tlsConfig, err := utils.ServerTLSConfig(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA)
+	if err != nil {
+		log.Fatalf("Failed to prepare TLS config: %v", err)
+	}
 
-	e.POST("/update/:type_metric/:name_metric/:value_metric", AddMetric)
-	e.GET("/value/:type_metric/:name_metric", getMetric)
-	e.GET("/", getAllMetrics)
+	e, agent, ingest := newRouter()
 
-	e.POST("/update/", AddMetricV2)
-	e.POST("/value/", GetMetricV2)
+	agent.POST("/update/:type_metric/:name_metric/:value_metric", AddMetric)
+	agent.GET("/value/:type_metric/:name_metric", getMetric)
+	agent.GET("/", getAllMetrics)
+	// Prometheus не подписывает запросы, поэтому страница метрик не проходит проверки агента
+	e.GET("/metrics", getMetricsPrometheus, middleware.CheckMetricsIP)
+	agent.GET("/api/v1/query_range", queryRange)
+	agent.GET("/api/v1/counter_rate", counterRate)
 
-	e.POST("/updates/", AddMetrics)
+	agent.POST("/update/", AddMetricV2)
+	agent.POST("/value/", GetMetricV2)
+
+	agent.POST("/updates/", AddMetrics)
 
 	if cfg.DatabaseDsn != "" {
 		db, err := postgresStorage.NewDB()
@@ -400,7 +786,7 @@ func main() {
 		}
 		defer db.Pool.Close()
 
-		e.GET("/ping", func(c echo.Context) error {
+		agent.GET("/ping", func(c echo.Context) error {
 			return ping(c, db)
 		})
 
@@ -418,11 +804,57 @@ func main() {
 		storage.Storage = memStorage.NewStorage()
 	}
 
+	// Каждое записанное значение учитывается в агрегатах уровней прореживания
+	rollupStore, ok := storage.Storage.(rollup.Store)
+	if !ok {
+		log.Fatal("Storage does not support rollups")
+	}
+
+	roller, err := rollup.NewRoller(rollup.DefaultTiers, rollupStore, time.Duration(cfg.SampleRetention)*time.Second)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	// После перезапуска прирост считается от значений, сохраненных в базе до него
+	stored, err := storage.Storage.GetAll()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	for _, m := range stored {
+		roller.Seed(m)
+	}
+	storage.Storage = rollup.NewStorage(storage.Storage, roller)
+
+	agent.GET("/api/v1/query_rollup", func(c echo.Context) error {
+		return queryRollup(c, roller)
+	})
+
+	influxConverter, err := influx.NewConverter(cfg.InfluxCounterFields)
+	if err != nil {
+		log.Fatalf("Failed to parse InfluxDB counter fields: %v", err)
+	}
+
+	ingest.POST("/write", func(c echo.Context) error {
+		return writeInflux(c, influxConverter)
+	})
+
+	remoteReceiver := remotewrite.NewReceiver(storage.Storage)
+
+	ingest.POST("/api/v1/write", func(c echo.Context) error {
+		return writeRemote(c, remoteReceiver)
+	})
+
+	otlpReceiver := otlp.NewReceiver(storage.Storage)
+
+	ingest.POST("/v1/metrics", func(c echo.Context) error {
+		return writeOTLP(c, otlpReceiver)
+	})
+
 	// Создаем экземпляр MetricService
 	metricService := metric.NewMetricService(storage.Storage)
 
 	// Запускаем gRPC сервер
-	grpcServer, err := runGRPCServer("127.0.0.1:3200", metricService)
+	grpcServer, err := runGRPCServer(cfg.GRPCAddress, metricService, otlpReceiver, tlsConfig)
 	if err != nil {
 		log.Fatalf("Failed to run gRPC server: %v", err)
 	}
@@ -431,6 +863,25 @@ func main() {
 		GRPC: grpcServer,
 	}
 
+	if cfg.StatsdUDPAddress != "" || cfg.StatsdTCPAddress != "" {
+		servers.StatsD = statsd.NewServer(storage.Storage, time.Duration(cfg.StatsdFlushInterval)*time.Second)
+		if err := servers.StatsD.Listen(cfg.StatsdUDPAddress, cfg.StatsdTCPAddress); err != nil {
+			log.Fatalf("Failed to run StatsD listener: %v", err)
+		}
+	}
+
+	if cfg.GraphiteAddress != "" || cfg.GraphitePickleAddress != "" {
+		mapper, err := graphite.NewMapper(cfg.GraphiteTemplates)
+		if err != nil {
+			log.Fatalf("Failed to parse Graphite templates: %v", err)
+		}
+
+		servers.Graphite = graphite.NewServer(storage.Storage, mapper)
+		if err := servers.Graphite.Listen(cfg.GraphiteAddress, cfg.GraphitePickleAddress); err != nil {
+			log.Fatalf("Failed to run Graphite listener: %v", err)
+		}
+	}
+
 	// Канал для сигналов завершения
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
@@ -444,11 +895,26 @@ func main() {
 
 	go files.UpdateMetrics()
 
+	backgroundStop := make(chan struct{})
+	defer close(backgroundStop)
+	go janitor.NewJanitor(storage.Storage, janitor.NewRules(cfg), time.Duration(cfg.JanitorInterval)*time.Second).Run(backgroundStop)
+	go roller.Run(backgroundStop)
+
 	fmt.Println("Running server on", cfg.FlagRunAddr)
 	echopprof.Wrap(e)
 
 	go func() {
-		if err := e.Start(cfg.FlagRunAddr); err != nil && err != http.ErrServerClosed {
+		var err error
+		if tlsConfig != nil {
+			// TLSServer останавливается в e.Shutdown вместе с обычным сервером
+			e.TLSServer.Addr = cfg.FlagRunAddr
+			e.TLSServer.TLSConfig = tlsConfig
+			err = e.StartServer(e.TLSServer)
+		} else {
+			err = e.Start(cfg.FlagRunAddr)
+		}
+
+		if err != nil && err != http.ErrServerClosed {
 			e.Logger.Fatal("shutting down the server")
 		}
 	}()
@@ -457,18 +923,27 @@ func main() {
 	<-stop
 
 	// Запускаем graceful shutdown
-	if err := gracefulShutdown(servers, storage.Storage); err != nil {
+	if err := gracefulShutdown(servers, storage.Storage, roller); err != nil {
 		log.Fatalf("Error during graceful shutdown: %v", err)
 	}
 }
 
-func runGRPCServer(addr string, metricService *metric.MetricService) (*grpc.Server, error) {
+// runGRPCServer запускает gRPC сервер на адресе addr с сервисами метрик и приемом OTLP.
+// Если tlsConfig не nil, сервер принимает только TLS соединения.
+func runGRPCServer(addr string, metricService *metric.MetricService, otlpReceiver *otlp.Receiver, tlsConfig *tls.Config) (*grpc.Server, error) {
 	lis, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
-	pbV2.RegisterMetricServiceServer(s, metricService)
+
+	opts := interceptors.ServerOptions()
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	s := grpc.NewServer(opts...)
+	metric.Register(s, metricService)
+	otlp.Register(s, otlpReceiver)
 	log.Printf("Starting gRPC server on %s", addr)
 	go func() {
 		if err := s.Serve(lis); err != nil {
@@ -478,7 +953,7 @@ func runGRPCServer(addr string, metricService *metric.MetricService) (*grpc.Serv
 	return s, nil
 }
 
-func gracefulShutdown(servers *Servers, store storage.StorageInterface) error {
+func gracefulShutdown(servers *Servers, store storage.StorageInterface, roller *rollup.Roller) error {
 	// Устанавливаем таймаут для завершения
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -491,9 +966,26 @@ func gracefulShutdown(servers *Servers, store storage.StorageInterface) error {
 	// Останавливаем gRPC сервер
 	servers.GRPC.GracefulStop()
 
+	// Останавливаем прием StatsD и сохраняем накопленные значения
+	if servers.StatsD != nil {
+		if err := servers.StatsD.Close(); err != nil {
+			log.Printf("Error flushing StatsD metrics: %v", err)
+		}
+	}
+
+	// Останавливаем прием Graphite
+	if servers.Graphite != nil {
+		servers.Graphite.Close()
+	}
+
 	// Ожидаем завершения всех текущих запросов
 	<-ctx.Done()
 
+	// Сохраняем накопленные агрегаты до закрытия хранилища
+	if err := roller.Flush(); err != nil {
+		log.Printf("Error saving rollups: %v", err)
+	}
+
 	// Закрываем соединение с базой данных
 	store.Close()
 	log.Println("Graceful shutdown completed")
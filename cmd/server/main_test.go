@@ -2,17 +2,37 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"github.com/dip96/metrics/internal/config"
+	"github.com/dip96/metrics/internal/influx"
+	"github.com/dip96/metrics/internal/middleware"
 	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/otlp"
+	"github.com/dip96/metrics/internal/prometheus"
+	"github.com/dip96/metrics/internal/query"
+	"github.com/dip96/metrics/internal/remotewrite"
+	"github.com/dip96/metrics/internal/rollup"
 	"github.com/dip96/metrics/internal/storage"
+	"github.com/dip96/metrics/internal/storage/mem"
 	postgresStorage "github.com/dip96/metrics/internal/storage/postgres"
+	pbCollector "github.com/dip96/metrics/protobuf/protos/opentelemetry/proto/collector/metrics/v1"
+	pbMetrics "github.com/dip96/metrics/protobuf/protos/opentelemetry/proto/metrics/v1"
+	"github.com/dip96/metrics/protobuf/protos/prometheus/prompb"
+	"github.com/golang/snappy"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestAddMetric(t *testing.T) {
@@ -116,6 +136,543 @@ func TestGetAllMetrics(t *testing.T) {
 	assert.Contains(t, string(body), "test_metric_2: 100")
 }
 
+func TestGetMetricsPrometheus(t *testing.T) {
+	e := echo.New()
+	e.GET("/metrics", getMetricsPrometheus)
+
+	storage.Storage.Clear()
+
+	err := storage.Storage.Set(metricModel.Metric{
+		ID:    "test_gauge",
+		MType: metricModel.MetricTypeGauge,
+		Value: Float64Ptr(42.5),
+	})
+	require.NoError(t, err)
+	err = storage.Storage.Set(metricModel.Metric{
+		ID:    "test_counter",
+		MType: metricModel.MetricTypeCounter,
+		Delta: Int64Ptr(7),
+	})
+	require.NoError(t, err)
+
+	t.Run("text format", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, string(prometheus.FormatText), rec.Header().Get(echo.HeaderContentType))
+		assert.Contains(t, rec.Body.String(), "# TYPE test_gauge gauge\ntest_gauge 42.5\n")
+		assert.Contains(t, rec.Body.String(), "# TYPE test_counter counter\ntest_counter 7\n")
+	})
+
+	t.Run("openmetrics format with gzip", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0")
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+
+		reader, err := gzip.NewReader(rec.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(reader)
+		require.NoError(t, err)
+
+		assert.Contains(t, string(body), "test_counter_total 7\n")
+		assert.True(t, strings.HasSuffix(string(body), "# EOF\n"))
+	})
+}
+
+func TestMetricsRouteWithoutAgentChecks(t *testing.T) {
+	configureServer(t, "secret", "192.168.1.0/24")
+
+	cfg, err := config.LoadServer()
+	require.NoError(t, err)
+	prevSubnet := cfg.MetricsTrustedSubnet
+	t.Cleanup(func() { cfg.MetricsTrustedSubnet = prevSubnet })
+
+	e, _, _ := newRouter()
+	e.GET("/metrics", getMetricsPrometheus, middleware.CheckMetricsIP)
+
+	// Prometheus читает метрики без подписи и без X-Real-IP
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Отдельный список доверенных адресов проверяет адрес соединения
+	cfg.MetricsTrustedSubnet = "10.0.0.0/8"
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.RemoteAddr = "10.1.2.3:41234"
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.RemoteAddr = "192.168.1.10:41234"
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+// configureServer задает ключ и доверенную подсеть сервера на время теста.
+func configureServer(t *testing.T, key, trustedSubnet string) {
+	t.Helper()
+
+	cfg, err := config.LoadServer()
+	require.NoError(t, err)
+
+	prevKey, prevSubnet := cfg.Key, cfg.TrustedSubnet
+	cfg.Key, cfg.TrustedSubnet = key, trustedSubnet
+	t.Cleanup(func() {
+		cfg.Key, cfg.TrustedSubnet = prevKey, prevSubnet
+	})
+}
+
+func TestWriteInflux(t *testing.T) {
+	converter, err := influx.NewConverter([]string{"net.bytes_*"})
+	require.NoError(t, err)
+
+	// Telegraf не подписывает запросы ключом агента и не передает X-Real-IP,
+	// подсеть проверяется по адресу соединения: httptest отправляет запросы с 192.0.2.1
+	configureServer(t, "secret", "192.0.2.0/24")
+
+	e, agent, ingest := newRouter()
+	agent.POST("/update/", AddMetricV2)
+	ingest.POST("/write", func(c echo.Context) error {
+		return writeInflux(c, converter)
+	})
+
+	storage.Storage.Clear()
+
+	t.Run("agent checks", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/update/", strings.NewReader(`{"id":"cpu","type":"gauge","value":1}`))
+		req.Header.Set("X-Real-IP", "192.0.2.10")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		// Маршруты агента по-прежнему требуют подпись
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("untrusted network", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader("cpu,host=a usage_idle=1\n"))
+		req.RemoteAddr = "10.0.0.1:41234"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		// X-Real-IP, если он передан, приоритетнее адреса соединения
+		req = httptest.NewRequest(http.MethodPost, "/write", strings.NewReader("cpu,host=a usage_idle=1\n"))
+		req.Header.Set("X-Real-IP", "10.0.0.1")
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("gzip body", func(t *testing.T) {
+		var body bytes.Buffer
+		gz := gzip.NewWriter(&body)
+		_, err := gz.Write([]byte("cpu,host=a usage_idle=97.5,usage_user=1i 1700000000000000000\n" +
+			"net,host=a bytes_recv=1024i,up=true,name=\"eth0\" 1700000000000000000\n"))
+		require.NoError(t, err)
+		require.NoError(t, gz.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/write?precision=ns", &body)
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusNoContent, rec.Code)
+
+		labels := map[string]string{"host": "a"}
+		idle, err := storage.Storage.Get(metricModel.SeriesKey("cpu_usage_idle", labels))
+		require.NoError(t, err)
+		assert.Equal(t, metricModel.MetricTypeGauge, idle.MType)
+		assert.Equal(t, 97.5, *idle.Value)
+
+		recv, err := storage.Storage.Get(metricModel.SeriesKey("net_bytes_recv", labels))
+		require.NoError(t, err)
+		assert.Equal(t, metricModel.MetricTypeCounter, recv.MType)
+		assert.Equal(t, int64(1024), *recv.Delta)
+
+		up, err := storage.Storage.Get(metricModel.SeriesKey("net_up", labels))
+		require.NoError(t, err)
+		assert.Equal(t, 1.0, *up.Value)
+
+		// Строковые поля не сохраняются
+		_, err = storage.Storage.Get(metricModel.SeriesKey("net_name", labels))
+		assert.Error(t, err)
+	})
+
+	t.Run("point timestamps", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/write?precision=s",
+			strings.NewReader("mem,host=a used=2i 1700000060\nmem,host=a used=1i 1700000000\n"))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusNoContent, rec.Code)
+
+		// Каждая точка записана в историю со своим временем
+		key := metricModel.SeriesKey("mem_used", map[string]string{"host": "a"})
+		history, err := storage.Storage.GetRange(key, time.Unix(1700000000, 0), time.Unix(1700000060, 0))
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Equal(t, 1.0, *history[0].Value)
+		assert.Equal(t, 2.0, *history[1].Value)
+
+		// Точка старше последней точки ряда отбрасывается
+		req = httptest.NewRequest(http.MethodPost, "/write?precision=s", strings.NewReader("mem,host=a used=3i 1700000030\n"))
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "dropped=1")
+
+		// Время, которое не помещается в наносекунды, отклоняется
+		req = httptest.NewRequest(http.MethodPost, "/write?precision=s", strings.NewReader("mem,host=a used=3i 99999999999\n"))
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("invalid line", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader("cpu usage_idle=1\ncpu,host usage_idle=2\n"))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "line 2")
+
+		// Запрос с некорректной строкой не сохраняется целиком
+		_, err := storage.Storage.Get("cpu_usage_idle")
+		assert.Error(t, err)
+	})
+}
+
+func TestWriteOTLP(t *testing.T) {
+	// SDK OpenTelemetry не подписывают запросы ключом агента и не передают X-Real-IP,
+	// подсеть проверяется по адресу соединения httptest
+	configureServer(t, "secret", "192.0.2.0/24")
+
+	e, _, ingest := newRouter()
+	ingest.POST("/v1/metrics", func(c echo.Context) error {
+		return writeOTLP(c, otlp.NewReceiver(storage.Storage))
+	})
+
+	storage.Storage.Clear()
+
+	t.Run("json body", func(t *testing.T) {
+		// Имена полей в lowerCamelCase и 64-битные числа в виде строк, как их отправляют SDK OpenTelemetry
+		body := `{"resourceMetrics":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"api"}}]},
+			"scopeMetrics":[{"metrics":[
+				{"name":"otel.requests","sum":{"aggregationTemporality":2,"isMonotonic":true,
+					"dataPoints":[{"asInt":"12","timeUnixNano":"1700000000000000000"}]}},
+				{"name":"otel.temperature","gauge":{"dataPoints":[{"asDouble":21.5,
+					"exemplars":[{"traceId":"5b8efff798038103d269b633813fc60c","asDouble":21.5}]}]}}
+			]}]}]}`
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/metrics", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, echo.MIMEApplicationJSON, rec.Header().Get(echo.HeaderContentType))
+		assert.JSONEq(t, "{}", rec.Body.String())
+
+		labels := map[string]string{"service.name": "api"}
+		requests, err := storage.Storage.Get(metricModel.SeriesKey("otel.requests", labels))
+		require.NoError(t, err)
+		assert.Equal(t, metricModel.MetricTypeCounter, requests.MType)
+		assert.Equal(t, int64(12), *requests.Delta)
+
+		temperature, err := storage.Storage.Get(metricModel.SeriesKey("otel.temperature", labels))
+		require.NoError(t, err)
+		assert.Equal(t, 21.5, *temperature.Value)
+	})
+
+	t.Run("protobuf body", func(t *testing.T) {
+		data, err := proto.Marshal(&pbCollector.ExportMetricsServiceRequest{
+			ResourceMetrics: []*pbMetrics.ResourceMetrics{{ScopeMetrics: []*pbMetrics.ScopeMetrics{{
+				Metrics: []*pbMetrics.Metric{{Name: "otel.duration", Data: &pbMetrics.Metric_Histogram{Histogram: &pbMetrics.Histogram{
+					AggregationTemporality: pbMetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					DataPoints: []*pbMetrics.HistogramDataPoint{{
+						Count: 3, Sum: proto.Float64(1.5), ExplicitBounds: []float64{0.5}, BucketCounts: []uint64{2, 1},
+					}},
+				}}}},
+			}}}},
+		})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(data))
+		req.Header.Set(echo.HeaderContentType, "application/x-protobuf")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		resp := &pbCollector.ExportMetricsServiceResponse{}
+		require.NoError(t, proto.Unmarshal(rec.Body.Bytes(), resp))
+		assert.Nil(t, resp.GetPartialSuccess())
+
+		duration, err := storage.Storage.Get("otel.duration")
+		require.NoError(t, err)
+		assert.Equal(t, []metricModel.Bucket{{UpperBound: 0.5, Count: 2}}, duration.Histogram.Buckets)
+		assert.Equal(t, uint64(3), duration.Histogram.Count)
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/metrics", strings.NewReader("{"))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"code":3`)
+	})
+
+	t.Run("unsupported content type", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/metrics", strings.NewReader("otel.requests 1"))
+		req.Header.Set(echo.HeaderContentType, echo.MIMETextPlain)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+}
+
+func TestWriteRemote(t *testing.T) {
+	// Prometheus не подписывает запросы ключом агента и не передает X-Real-IP,
+	// подсеть проверяется по адресу соединения httptest
+	configureServer(t, "secret", "192.0.2.0/24")
+
+	e, _, ingest := newRouter()
+	ingest.POST("/api/v1/write", func(c echo.Context) error {
+		return writeRemote(c, remotewrite.NewReceiver(storage.Storage))
+	})
+
+	storage.Storage.Clear()
+
+	send := func(req *prompb.WriteRequest) *httptest.ResponseRecorder {
+		data, err := proto.Marshal(req)
+		require.NoError(t, err)
+
+		httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(snappy.Encode(nil, data)))
+		httpReq.Header.Set("Content-Encoding", "snappy")
+		httpReq.Header.Set(echo.HeaderContentType, "application/x-protobuf")
+		httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httpReq)
+		return rec
+	}
+
+	labels := []*prompb.Label{{Name: "__name__", Value: "node_load1"}, {Name: "instance", Value: "a"}}
+	key := metricModel.SeriesKey("node_load1", map[string]string{"instance": "a"})
+
+	rec := send(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{{
+		Labels:  labels,
+		Samples: []*prompb.Sample{{Value: 0.5, Timestamp: 1700000000000}, {Value: 0.75, Timestamp: 1700000015000}},
+	}}})
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	load, err := storage.Storage.Get(key)
+	require.NoError(t, err)
+	assert.Equal(t, metricModel.MetricTypeGauge, load.MType)
+	assert.Equal(t, 0.75, *load.Value)
+
+	// Маркер устаревания не обновляет и не удаляет ряд
+	rec = send(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{{
+		Labels:  labels,
+		Samples: []*prompb.Sample{{Value: math.Float64frombits(0x7ff0000000000002), Timestamp: 1700000030000}},
+	}}})
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	load, err = storage.Storage.Get(key)
+	require.NoError(t, err)
+	assert.Equal(t, 0.75, *load.Value)
+
+	// Отсчет старше сохраненного отклоняется
+	rec = send(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{{
+		Labels:  labels,
+		Samples: []*prompb.Sample{{Value: 1, Timestamp: 1700000005000}},
+	}}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	history, err := storage.Storage.GetRange(key, time.UnixMilli(1700000000000), time.UnixMilli(1700000030000))
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, 0.5, *history[0].Value)
+
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/write", strings.NewReader("not snappy"))
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httpReq)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestQueryRange(t *testing.T) {
+	e := echo.New()
+	e.GET("/api/v1/query_range", queryRange)
+
+	storage.Storage.Clear()
+
+	for _, host := range []string{"a", "b"} {
+		for _, value := range []float64{1, 3} {
+			err := storage.Storage.Set(metricModel.Metric{
+				ID:     "QueryGauge",
+				MType:  metricModel.MetricTypeGauge,
+				Value:  Float64Ptr(value),
+				Labels: map[string]string{"host": host},
+			})
+			require.NoError(t, err)
+		}
+	}
+
+	t.Run("aggregated series", func(t *testing.T) {
+		end := time.Now().Add(time.Second).Format(time.RFC3339Nano)
+		target := "/api/v1/query_range?name=QueryGauge&match=host%3Da&step=1h&aggregation=avg&end=" + url.QueryEscape(end)
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var series []query.Series
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &series))
+		require.Len(t, series, 1)
+		assert.Equal(t, "QueryGauge", series[0].Name)
+		assert.Equal(t, map[string]string{"host": "a"}, series[0].Labels)
+		require.NotEmpty(t, series[0].Points)
+		assert.Equal(t, 2.0, series[0].Points[len(series[0].Points)-1].Value)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		for _, target := range []string{
+			"/api/v1/query_range?name=QueryGauge&aggregation=median",
+			"/api/v1/query_range?name=QueryGauge&step=never",
+			"/api/v1/query_range?name=QueryGauge&start=10&end=5",
+			"/api/v1/query_range?step=1m",
+		} {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+		}
+	})
+}
+
+func TestQueryRollup(t *testing.T) {
+	store := mem.NewStorage()
+	roller, err := rollup.NewRoller(rollup.DefaultTiers, store, 0)
+	require.NoError(t, err)
+
+	previous := storage.Storage
+	storage.Storage = rollup.NewStorage(store, roller)
+	defer func() { storage.Storage = previous }()
+
+	e := echo.New()
+	e.GET("/api/v1/query_rollup", func(c echo.Context) error {
+		return queryRollup(c, roller)
+	})
+
+	for _, value := range []float64{1, 3} {
+		require.NoError(t, storage.Storage.Set(metricModel.Metric{ID: "RollupGauge", MType: metricModel.MetricTypeGauge, Value: Float64Ptr(value)}))
+	}
+	require.NoError(t, roller.Flush())
+
+	// Окно текущего часа заканчивается в пределах следующего часа
+	start := url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339Nano))
+	end := url.QueryEscape(time.Now().Add(2 * time.Hour).Format(time.RFC3339Nano))
+
+	t.Run("coarsest tier", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/query_rollup?name=RollupGauge&step=1h&aggregation=max&start="+start+"&end="+end, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var result rollup.Result
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+		assert.Equal(t, int64(3600), result.Resolution)
+		require.Len(t, result.Series, 1)
+		require.NotEmpty(t, result.Series[0].Points)
+		assert.Equal(t, 3.0, result.Series[0].Points[len(result.Series[0].Points)-1].Value)
+	})
+
+	t.Run("raw samples", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/query_rollup?name=RollupGauge&step=10s", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var result rollup.Result
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+		assert.Equal(t, int64(0), result.Resolution)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/query_rollup?name=RollupGauge&aggregation=median", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestCounterRate(t *testing.T) {
+	e := echo.New()
+	e.GET("/api/v1/counter_rate", counterRate)
+	e.POST("/value/", GetMetricV2)
+
+	storage.Storage.Clear()
+
+	counter := metricModel.Metric{ID: "RateCounter", MType: metricModel.MetricTypeCounter}
+	_, err := storage.Storage.Increment(metricModel.Metric{ID: counter.ID, MType: counter.MType, Delta: Int64Ptr(5)})
+	require.NoError(t, err)
+	// Счетчик сброшен и снова начался с 1
+	require.NoError(t, storage.Storage.Set(metricModel.Metric{ID: counter.ID, MType: counter.MType, Delta: Int64Ptr(1)}))
+	_, err = storage.Storage.Increment(metricModel.Metric{ID: counter.ID, MType: counter.MType, Delta: Int64Ptr(2)})
+	require.NoError(t, err)
+
+	t.Run("counter rate endpoint", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/counter_rate?name=RateCounter&window=1m", nil))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var counters []query.CounterRate
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &counters))
+		require.Len(t, counters, 1)
+		assert.Equal(t, 3.0, counters[0].Increase)
+		assert.Equal(t, 1, counters[0].Resets)
+		assert.Greater(t, counters[0].Rate, 0.0)
+	})
+
+	t.Run("get metric v2", func(t *testing.T) {
+		body, err := json.Marshal(counter)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/value/", bytes.NewBuffer(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var resp metricModel.Metric
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, int64(3), *resp.Delta)
+		require.NotNil(t, resp.Increase)
+		assert.Equal(t, 3.0, *resp.Increase)
+		require.NotNil(t, resp.Rate)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		for _, target := range []string{
+			"/api/v1/counter_rate?window=1m",
+			"/api/v1/counter_rate?name=RateCounter&window=-1m",
+			"/api/v1/counter_rate?name=RateCounter&match=host",
+		} {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+		}
+	})
+}
+
 func TestAddMetricV2(t *testing.T) {
 	// Создаем новый экземпляр Echo
 	e := echo.New()
@@ -182,6 +739,132 @@ func TestAddMetricV2(t *testing.T) {
 
 		assert.Equal(t, counterMetric, resp)
 	})
+
+	t.Run("add histogram metric", func(t *testing.T) {
+		e.POST("/update/", AddMetricV2)
+		post := func(h metricModel.Histogram) *httptest.ResponseRecorder {
+			body, err := json.Marshal(metricModel.Metric{ID: "Latency", MType: metricModel.MetricTypeHistogram, Histogram: &h})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewBuffer(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+
+		observe := metricModel.Histogram{Buckets: []metricModel.Bucket{{UpperBound: 0.5, Count: 1}, {UpperBound: 1, Count: 2}}, Sum: 1.2, Count: 3}
+		require.Equal(t, http.StatusOK, post(observe).Code)
+		rec := post(observe)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		// Наблюдения объединяются с сохраненной гистограммой
+		resp := metricModel.Metric{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.NotNil(t, resp.Histogram)
+		assert.Equal(t, []metricModel.Bucket{{UpperBound: 0.5, Count: 2}, {UpperBound: 1, Count: 4}}, resp.Histogram.Buckets)
+		assert.Equal(t, uint64(6), resp.Histogram.Count)
+
+		// Некумулятивные бакеты не принимаются
+		invalid := metricModel.Histogram{Buckets: []metricModel.Bucket{{UpperBound: 0.5, Count: 2}, {UpperBound: 1, Count: 1}}, Count: 2}
+		assert.Equal(t, http.StatusBadRequest, post(invalid).Code)
+	})
+}
+
+func TestMetricLabels(t *testing.T) {
+	e := echo.New()
+	e.POST("/update/", AddMetricV2)
+	e.POST("/value/", GetMetricV2)
+
+	storage.Storage.Clear()
+
+	for host, value := range map[string]int64{"a": 1, "b": 2} {
+		counterMetric := metricModel.Metric{
+			ID:     "LabeledCounter",
+			MType:  metricModel.MetricTypeCounter,
+			Delta:  Int64Ptr(value),
+			Labels: map[string]string{"host": host},
+		}
+
+		body, err := json.Marshal(counterMetric)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewBuffer(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	// Ряды с разными метками хранятся независимо
+	metric, err := storage.Storage.Get(`LabeledCounter{host="a"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *metric.Delta)
+
+	metric, err = storage.Storage.Get(`LabeledCounter{host="b"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *metric.Delta)
+	assert.Equal(t, map[string]string{"host": "b"}, metric.Labels)
+
+	body, err := json.Marshal(metricModel.Metric{
+		ID:     "LabeledCounter",
+		MType:  metricModel.MetricTypeCounter,
+		Labels: map[string]string{"host": "b"},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/value/", bytes.NewBuffer(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	resp := metricModel.Metric{}
+	err = json.Unmarshal(rec.Body.Bytes(), &resp)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *resp.Delta)
+	assert.Equal(t, map[string]string{"host": "b"}, resp.Labels)
+}
+
+func TestAddMetricsConcurrentCounters(t *testing.T) {
+	e := echo.New()
+	e.POST("/updates/", AddMetrics)
+
+	storage.Storage.Clear()
+
+	body, err := json.Marshal([]metricModel.Metric{
+		{ID: "PollCount", MType: metricModel.MetricTypeCounter, Delta: Int64Ptr(1)},
+		{ID: "PollCount", MType: metricModel.MetricTypeCounter, Delta: Int64Ptr(2)},
+		{ID: "Alloc", MType: metricModel.MetricTypeGauge, Value: Float64Ptr(1.5)},
+	})
+	require.NoError(t, err)
+
+	const agents = 10
+
+	var wg sync.WaitGroup
+	for i := 0; i < agents; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewBuffer(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}()
+	}
+	wg.Wait()
+
+	metric, err := storage.Storage.Get("PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3*agents), *metric.Delta)
+
+	metric, err = storage.Storage.Get("Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *metric.Value)
 }
 
 // Mock DB object
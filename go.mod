@@ -5,6 +5,7 @@ go 1.21.7
 require (
 	github.com/dorfire/go-analyzers v0.0.1
 	github.com/golang-migrate/migrate/v4 v4.17.0
+	github.com/golang/snappy v0.0.4
 	github.com/hiko1129/echo-pprof v1.0.1
 	github.com/jackc/pgerrcode v0.0.0-20240316143900-6e2875d9b438
 	github.com/jackc/pgx v3.6.2+incompatible
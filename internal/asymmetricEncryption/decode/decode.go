@@ -3,10 +3,14 @@ package decode
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"github.com/dip96/metrics/internal/asymmetricEncryption/envelope"
 	"github.com/dip96/metrics/internal/config"
 	"github.com/dip96/metrics/internal/utils"
 )
 
+// DecryptData расшифровывает данные приватным ключом сервера.
+// Поддерживается формат envelope и данные, зашифрованные только RSA PKCS#1 v1.5
+// агентами предыдущих версий.
 func DecryptData(ciphertext []byte) ([]byte, error) {
 	cnf, err := config.LoadServer()
 	if err != nil {
@@ -20,5 +24,9 @@ func DecryptData(ciphertext []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	if envelope.IsEnvelope(ciphertext) {
+		return envelope.Open(privateKey, ciphertext)
+	}
+
 	return rsa.DecryptPKCS1v15(rand.Reader, privateKey, ciphertext)
 }
@@ -1,6 +1,7 @@
 package decode
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/dip96/metrics/internal/asymmetricEncryption/envelope"
 	"github.com/dip96/metrics/internal/config"
 )
 
@@ -65,3 +67,47 @@ func TestDecryptData(t *testing.T) {
 		t.Errorf("Decrypted data does not match original plaintext")
 	}
 }
+
+func TestDecryptDataEnvelope(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+
+	plaintext := bytes.Repeat([]byte("Тестовые данные для шифрования"), 100)
+
+	ciphertext, err := envelope.Seal(&privateKey.PublicKey, plaintext)
+	if err != nil {
+		t.Fatalf("Failed to encrypt data: %v", err)
+	}
+
+	tmpKeyFile, err := os.CreateTemp("", "test_key.pem")
+	if err != nil {
+		t.Fatalf("Failed to create temporary key file: %v", err)
+	}
+	defer os.Remove(tmpKeyFile.Name())
+
+	pemData := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+
+	if _, err := tmpKeyFile.Write(pemData); err != nil {
+		t.Fatalf("Failed to write private key to temporary file: %v", err)
+	}
+
+	cnf, err := config.LoadServer()
+	if err != nil {
+		t.Fatalf("Failed to prepare server config: %v\n", err)
+	}
+	cnf.CryptoKey = tmpKeyFile.Name()
+
+	decrypted, err := DecryptData(ciphertext)
+	if err != nil {
+		t.Fatalf("Failed to decrypt data: %v", err)
+	}
+
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Decrypted data does not match original plaintext")
+	}
+}
@@ -1,12 +1,13 @@
 package encode
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
+	"github.com/dip96/metrics/internal/asymmetricEncryption/envelope"
 	"github.com/dip96/metrics/internal/config"
 	"github.com/dip96/metrics/internal/utils"
 )
 
+// EncryptData шифрует данные публичным ключом сервера в формате envelope.
+// Размер данных не ограничен размером RSA-ключа.
 func EncryptData(data []byte) ([]byte, error) {
 	cfg, err := config.LoadAgent()
 	if err != nil {
@@ -20,5 +21,5 @@ func EncryptData(data []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	return rsa.EncryptPKCS1v15(rand.Reader, pubKey, data)
+	return envelope.Seal(pubKey, data)
 }
@@ -6,7 +6,9 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"github.com/dip96/metrics/internal/asymmetricEncryption/encode"
+	"github.com/dip96/metrics/internal/asymmetricEncryption/envelope"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/dip96/metrics/internal/config"
@@ -55,7 +57,7 @@ func TestEncryptData(t *testing.T) {
 	}
 
 	// Расшифровываем зашифрованные данные с помощью закрытого ключа
-	decrypted, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, ciphertext)
+	decrypted, err := envelope.Open(privateKey, ciphertext)
 	if err != nil {
 		t.Errorf("Failed to decrypt data: %v", err)
 	}
@@ -65,3 +67,50 @@ func TestEncryptData(t *testing.T) {
 		t.Errorf("Decrypted data does not match original plaintext")
 	}
 }
+
+func TestEncryptDataLargePayload(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+
+	// Сохраняем открытый ключ в формате PKIX, как это делает generate.Generate
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+
+	tmpKeyFile, err := os.CreateTemp("", "test_key.pem")
+	if err != nil {
+		t.Fatalf("Failed to create temporary key file: %v", err)
+	}
+	defer os.Remove(tmpKeyFile.Name())
+
+	if _, err := tmpKeyFile.Write(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})); err != nil {
+		t.Fatalf("Failed to write public key to temporary file: %v", err)
+	}
+
+	cfg, err := config.LoadAgent()
+	if err != nil {
+		t.Errorf("Failed to prepare agent config: %v\n", err)
+		return
+	}
+	cfg.CryptoKey = tmpKeyFile.Name()
+
+	// Пачка метрик значительно больше 245 байт
+	plaintext := []byte(strings.Repeat(`{"id":"HeapAlloc","type":"gauge","value":123456.789},`, 200))
+
+	ciphertext, err := encode.EncryptData(plaintext)
+	if err != nil {
+		t.Fatalf("Failed to encrypt data: %v", err)
+	}
+
+	decrypted, err := envelope.Open(privateKey, ciphertext)
+	if err != nil {
+		t.Fatalf("Failed to decrypt data: %v", err)
+	}
+
+	if string(decrypted) != string(plaintext) {
+		t.Errorf("Decrypted data does not match original plaintext")
+	}
+}
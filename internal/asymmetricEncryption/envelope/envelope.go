@@ -0,0 +1,129 @@
+// Package envelope реализует гибридное шифрование данных агента.
+//
+// Данные шифруются случайным ключом AES-256-GCM, а сам ключ - публичным ключом RSA (OAEP, SHA-256).
+// Поэтому размер сообщения не ограничен размером RSA-ключа.
+//
+// Формат сообщения версии 1:
+//
+//	magic "menc" (4 байта) | версия (1 байт) | длина ключа (2 байта, big-endian) |
+//	зашифрованный ключ | nonce (12 байт) | шифротекст AES-GCM с тегом
+//
+// Заголовок (magic, версия и длина ключа) передается в AES-GCM как дополнительные данные.
+package envelope
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Version1 - текущая версия формата сообщения.
+const Version1 byte = 1
+
+// keySize - размер ключа AES-256.
+const keySize = 32
+
+// magic - сигнатура, по которой сообщение отличается от данных, зашифрованных только RSA.
+var magic = []byte("menc")
+
+// headerSize - размер заголовка без зашифрованного ключа.
+var headerSize = len(magic) + 1 + 2
+
+// ErrNotEnvelope возвращается, если данные не являются сообщением в формате envelope.
+var ErrNotEnvelope = errors.New("data is not an envelope")
+
+// ErrUnsupportedVersion возвращается для сообщений неизвестной версии.
+var ErrUnsupportedVersion = errors.New("unsupported envelope version")
+
+// IsEnvelope проверяет наличие сигнатуры формата в начале данных.
+func IsEnvelope(data []byte) bool {
+	return len(data) >= headerSize && bytes.Equal(data[:len(magic)], magic)
+}
+
+// Seal шифрует данные произвольного размера публичным ключом получателя.
+func Seal(pub *rsa.PublicKey, plaintext []byte) ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerSize, headerSize+len(wrappedKey)+len(nonce)+len(plaintext)+gcm.Overhead())
+	copy(header, magic)
+	header[len(magic)] = Version1
+	binary.BigEndian.PutUint16(header[len(magic)+1:], uint16(len(wrappedKey)))
+
+	out := append(header, wrappedKey...)
+	out = append(out, nonce...)
+
+	return gcm.Seal(out, nonce, plaintext, header[:headerSize]), nil
+}
+
+// Open расшифровывает сообщение, созданное Seal, приватным ключом получателя.
+func Open(priv *rsa.PrivateKey, data []byte) ([]byte, error) {
+	if !IsEnvelope(data) {
+		return nil, ErrNotEnvelope
+	}
+
+	if data[len(magic)] != Version1 {
+		return nil, ErrUnsupportedVersion
+	}
+
+	header := data[:headerSize]
+	keyLen := int(binary.BigEndian.Uint16(data[len(magic)+1:]))
+	rest := data[headerSize:]
+
+	if len(rest) < keyLen {
+		return nil, errors.New("envelope is truncated")
+	}
+
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, rest[:keyLen], nil)
+	if err != nil {
+		return nil, err
+	}
+	rest = rest[keyLen:]
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) < gcm.NonceSize() {
+		return nil, errors.New("envelope is truncated")
+	}
+
+	return gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], header)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, errors.New("invalid data key size")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
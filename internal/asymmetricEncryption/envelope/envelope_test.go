@@ -0,0 +1,62 @@
+package envelope_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/dip96/metrics/internal/asymmetricEncryption/envelope"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	t.Run("large payload", func(t *testing.T) {
+		// Размер больше лимита RSA PKCS#1 v1.5 для ключа 2048 бит (245 байт)
+		plaintext := bytes.Repeat([]byte(`{"id":"HeapAlloc","type":"gauge","value":1}`), 1000)
+
+		sealed, err := envelope.Seal(&privateKey.PublicKey, plaintext)
+		require.NoError(t, err)
+		assert.True(t, envelope.IsEnvelope(sealed))
+
+		opened, err := envelope.Open(privateKey, sealed)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, opened)
+	})
+
+	t.Run("empty payload", func(t *testing.T) {
+		sealed, err := envelope.Seal(&privateKey.PublicKey, nil)
+		require.NoError(t, err)
+
+		opened, err := envelope.Open(privateKey, sealed)
+		require.NoError(t, err)
+		assert.Empty(t, opened)
+	})
+
+	t.Run("tampered ciphertext", func(t *testing.T) {
+		sealed, err := envelope.Seal(&privateKey.PublicKey, []byte("data"))
+		require.NoError(t, err)
+
+		sealed[len(sealed)-1] ^= 0xff
+		_, err = envelope.Open(privateKey, sealed)
+		assert.Error(t, err)
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		sealed, err := envelope.Seal(&privateKey.PublicKey, []byte("data"))
+		require.NoError(t, err)
+
+		sealed[4] = 99
+		_, err = envelope.Open(privateKey, sealed)
+		assert.ErrorIs(t, err, envelope.ErrUnsupportedVersion)
+	})
+
+	t.Run("not an envelope", func(t *testing.T) {
+		_, err := envelope.Open(privateKey, []byte("plain data"))
+		assert.ErrorIs(t, err, envelope.ErrNotEnvelope)
+	})
+}
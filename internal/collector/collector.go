@@ -0,0 +1,108 @@
+// Package collector описывает сборщики метрик агента и реестр, в котором они регистрируются.
+//
+// Чтобы добавить новый сборщик, достаточно реализовать интерфейс Collector
+// и зарегистрировать его в функции init через Register. Агент запускает все
+// зарегистрированные и включенные в конфигурации сборщики.
+package collector
+
+import (
+	"context"
+	"fmt"
+	"github.com/dip96/metrics/internal/model/metric"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Collector - источник метрик агента.
+type Collector interface {
+	// Name возвращает имя сборщика, по которому он настраивается в конфигурации агента.
+	Name() string
+	// Collect собирает текущие значения метрик.
+	Collect(ctx context.Context) ([]metric.Metric, error)
+}
+
+// Registered - сборщик, зарегистрированный в реестре.
+type Registered struct {
+	Collector Collector
+	// Interval - интервал сбора по умолчанию.
+	// Нулевое значение означает интервал опроса агента.
+	Interval time.Duration
+}
+
+// Registry - реестр сборщиков метрик.
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]Registered
+}
+
+// NewRegistry создает пустой реестр сборщиков.
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]Registered),
+	}
+}
+
+// Register добавляет сборщик в реестр. Имена сборщиков должны быть уникальными.
+func (r *Registry) Register(c Collector, interval time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collectors[c.Name()]; ok {
+		return fmt.Errorf("collector %q is already registered", c.Name())
+	}
+
+	r.collectors[c.Name()] = Registered{Collector: c, Interval: interval}
+	return nil
+}
+
+// Collectors возвращает зарегистрированные сборщики, отсортированные по имени.
+func (r *Registry) Collectors() []Registered {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	collectors := make([]Registered, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].Collector.Name() < collectors[j].Collector.Name()
+	})
+
+	return collectors
+}
+
+// defaultRegistry - реестр, в котором сборщики регистрируются при инициализации пакета.
+var defaultRegistry = NewRegistry()
+
+// Register добавляет сборщик в реестр по умолчанию.
+// Вызывается из функций init, поэтому при повторной регистрации имени паникует.
+func Register(c Collector, interval time.Duration) {
+	if err := defaultRegistry.Register(c, interval); err != nil {
+		panic(err)
+	}
+}
+
+// Default возвращает реестр по умолчанию.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// newGauge создает метрику типа gauge.
+func newGauge(name string, value float64) metric.Metric {
+	return metric.Metric{
+		ID:    name,
+		MType: metric.MetricTypeGauge,
+		Value: &value,
+	}
+}
+
+// newCounter создает метрику типа counter.
+func newCounter(name string, delta int64) metric.Metric {
+	return metric.Metric{
+		ID:    name,
+		MType: metric.MetricTypeCounter,
+		Delta: &delta,
+	}
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"context"
+	"github.com/dip96/metrics/internal/model/metric"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// staticCollector - сборщик с фиксированным именем для тестов реестра.
+type staticCollector struct {
+	name string
+}
+
+func (s staticCollector) Name() string {
+	return s.name
+}
+
+func (s staticCollector) Collect(_ context.Context) ([]metric.Metric, error) {
+	return nil, nil
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	assert.NoError(t, registry.Register(staticCollector{name: "b"}, time.Second))
+	assert.NoError(t, registry.Register(staticCollector{name: "a"}, 0))
+	assert.Error(t, registry.Register(staticCollector{name: "a"}, time.Second))
+
+	collectors := registry.Collectors()
+	assert.Len(t, collectors, 2)
+	assert.Equal(t, "a", collectors[0].Collector.Name())
+	assert.Equal(t, time.Duration(0), collectors[0].Interval)
+	assert.Equal(t, "b", collectors[1].Collector.Name())
+	assert.Equal(t, time.Second, collectors[1].Interval)
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	var names []string
+	for _, c := range Default().Collectors() {
+		names = append(names, c.Collector.Name())
+	}
+
+	assert.Equal(t, []string{GopsutilName, RuntimeName}, names)
+}
+
+func TestNewGauge(t *testing.T) {
+	m := newGauge("float_metric", 42.0)
+	assert.Equal(t, "float_metric", m.ID)
+	assert.Equal(t, metric.MetricTypeGauge, m.MType)
+	assert.Equal(t, 42.0, *m.Value)
+}
+
+func TestNewCounter(t *testing.T) {
+	m := newCounter("int64_metric", 42)
+	assert.Equal(t, "int64_metric", m.ID)
+	assert.Equal(t, metric.MetricTypeCounter, m.MType)
+	assert.Equal(t, int64(42), *m.Delta)
+}
@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"github.com/dip96/metrics/internal/model/metric"
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/mem"
+	"time"
+)
+
+// GopsutilName - имя сборщика системных метрик gopsutil.
+const GopsutilName = "gopsutil"
+
+func init() {
+	Register(NewGopsutil(), 5*time.Second)
+}
+
+// Gopsutil собирает данные о памяти и загрузке CPU через gopsutil.
+type Gopsutil struct{}
+
+// NewGopsutil создает сборщик системных метрик.
+func NewGopsutil() *Gopsutil {
+	return &Gopsutil{}
+}
+
+// Name возвращает имя сборщика.
+func (g *Gopsutil) Name() string {
+	return GopsutilName
+}
+
+// Collect собирает метрики памяти и использования CPU.
+// Ошибка возвращается, только если не удалось собрать ни одной метрики.
+func (g *Gopsutil) Collect(ctx context.Context) ([]metric.Metric, error) {
+	var metrics []metric.Metric
+
+	virtualMemoryStat, memErr := mem.VirtualMemoryWithContext(ctx)
+	if memErr == nil {
+		metrics = append(metrics, newGauge("TotalMemory", float64(virtualMemoryStat.Total)))
+		metrics = append(metrics, newGauge("FreeMemory", float64(virtualMemoryStat.Free)))
+	}
+
+	cpuPercentages, cpuErr := cpu.PercentWithContext(ctx, time.Second, false)
+	if cpuErr == nil {
+		for i, cpuUsage := range cpuPercentages {
+			metricName := fmt.Sprintf("CPUutilization%d", i+1)
+			metrics = append(metrics, newGauge(metricName, cpuUsage))
+		}
+	}
+
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("failed to collect gopsutil metrics: memory: %v, cpu: %v", memErr, cpuErr)
+	}
+
+	return metrics, nil
+}
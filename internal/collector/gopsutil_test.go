@@ -0,0 +1,34 @@
+package collector
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestGopsutilCollect(t *testing.T) {
+	metrics, err := NewGopsutil().Collect(context.Background())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, metrics)
+
+	// Проверяем наличие метрик памяти
+	var memMetricsFound bool
+	for _, m := range metrics {
+		if m.ID == "TotalMemory" || m.ID == "FreeMemory" {
+			memMetricsFound = true
+			break
+		}
+	}
+	assert.True(t, memMetricsFound)
+
+	// Проверяем наличие метрик использования CPU
+	var cpuMetricsFound bool
+	for _, m := range metrics {
+		if strings.HasPrefix(m.ID, "CPUutilization") {
+			cpuMetricsFound = true
+			break
+		}
+	}
+	assert.True(t, cpuMetricsFound)
+}
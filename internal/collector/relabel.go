@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dip96/metrics/internal/config"
+)
+
+// relabelRule - правило relabel со скомпилированным регулярным выражением.
+type relabelRule struct {
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	targetLabel  string
+	replacement  string
+	action       string
+}
+
+// Relabeler применяет правила relabel к меткам рядов.
+type Relabeler struct {
+	rules []relabelRule
+}
+
+// NewRelabeler проверяет правила и подставляет значения по умолчанию.
+func NewRelabeler(configs []config.RelabelConfig) (*Relabeler, error) {
+	r := &Relabeler{rules: make([]relabelRule, 0, len(configs))}
+
+	for i, c := range configs {
+		rule := relabelRule{
+			sourceLabels: c.SourceLabels,
+			separator:    ";",
+			targetLabel:  c.TargetLabel,
+			replacement:  "$1",
+			action:       c.Action,
+		}
+
+		if c.Separator != nil {
+			rule.separator = *c.Separator
+		}
+		if c.Replacement != nil {
+			rule.replacement = *c.Replacement
+		}
+		if rule.action == "" {
+			rule.action = config.RelabelReplace
+		}
+
+		expr := c.Regex
+		if expr == "" {
+			expr = "(.*)"
+		}
+
+		// Как и в Prometheus, значение должно соответствовать выражению целиком
+		regex, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule %d: invalid regex %q: %w", i, c.Regex, err)
+		}
+		rule.regex = regex
+
+		switch rule.action {
+		case config.RelabelReplace:
+			if rule.targetLabel == "" {
+				return nil, fmt.Errorf("relabel rule %d: target label is required for action %s", i, rule.action)
+			}
+		case config.RelabelKeep, config.RelabelDrop, config.RelabelLabelDrop, config.RelabelLabelKeep:
+		default:
+			return nil, fmt.Errorf("relabel rule %d: unknown action %q", i, rule.action)
+		}
+
+		r.rules = append(r.rules, rule)
+	}
+
+	return r, nil
+}
+
+// Apply применяет правила к копии меток и возвращает ее.
+// Если ряд отброшен правилом keep или drop, второе значение равно false.
+func (r *Relabeler) Apply(labels map[string]string) (map[string]string, bool) {
+	result := make(map[string]string, len(labels))
+	for name, value := range labels {
+		result[name] = value
+	}
+
+	for _, rule := range r.rules {
+		values := make([]string, len(rule.sourceLabels))
+		for i, name := range rule.sourceLabels {
+			values[i] = result[name]
+		}
+		value := strings.Join(values, rule.separator)
+
+		switch rule.action {
+		case config.RelabelReplace:
+			match := rule.regex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+
+			target := string(rule.regex.ExpandString(nil, rule.replacement, value, match))
+			if target == "" {
+				delete(result, rule.targetLabel)
+			} else {
+				result[rule.targetLabel] = target
+			}
+		case config.RelabelKeep:
+			if !rule.regex.MatchString(value) {
+				return nil, false
+			}
+		case config.RelabelDrop:
+			if rule.regex.MatchString(value) {
+				return nil, false
+			}
+		case config.RelabelLabelDrop, config.RelabelLabelKeep:
+			for name := range result {
+				if rule.regex.MatchString(name) == (rule.action == config.RelabelLabelDrop) {
+					delete(result, name)
+				}
+			}
+		}
+	}
+
+	return result, true
+}
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"context"
+	"github.com/dip96/metrics/internal/model/metric"
+	"math/rand"
+	"runtime"
+	"sync/atomic"
+)
+
+// RuntimeName - имя сборщика метрик runtime.
+const RuntimeName = "runtime"
+
+func init() {
+	// Метрики runtime собираются с интервалом опроса агента
+	Register(NewRuntime(), 0)
+}
+
+// Runtime собирает статистику памяти и сборщика мусора из runtime,
+// а также счетчик опросов PollCount и случайное значение RandomValue.
+type Runtime struct {
+	pollCount atomic.Int64
+}
+
+// NewRuntime создает сборщик метрик runtime.
+func NewRuntime() *Runtime {
+	return &Runtime{}
+}
+
+// Name возвращает имя сборщика.
+func (r *Runtime) Name() string {
+	return RuntimeName
+}
+
+// Collect собирает метрики runtime.
+func (r *Runtime) Collect(_ context.Context) ([]metric.Metric, error) {
+	memStats := runtime.MemStats{}
+	runtime.ReadMemStats(&memStats)
+
+	metrics := []metric.Metric{
+		newGauge("Alloc", float64(memStats.Alloc)),
+		newGauge("BuckHashSys", float64(memStats.BuckHashSys)),
+		newGauge("Frees", float64(memStats.Frees)),
+		newGauge("GCCPUFraction", memStats.GCCPUFraction),
+		newGauge("GCSys", float64(memStats.GCSys)),
+		newGauge("HeapAlloc", float64(memStats.HeapAlloc)),
+		newGauge("HeapIdle", float64(memStats.HeapIdle)),
+		newGauge("HeapInuse", float64(memStats.HeapInuse)),
+		newGauge("HeapObjects", float64(memStats.HeapObjects)),
+		newGauge("HeapReleased", float64(memStats.HeapReleased)),
+		newGauge("HeapSys", float64(memStats.HeapSys)),
+		newGauge("LastGC", float64(memStats.LastGC)),
+		newGauge("Lookups", float64(memStats.Lookups)),
+		newGauge("MCacheInuse", float64(memStats.MCacheInuse)),
+		newGauge("MCacheSys", float64(memStats.MCacheSys)),
+		newGauge("Mallocs", float64(memStats.Mallocs)),
+		newGauge("NextGC", float64(memStats.NextGC)),
+		newGauge("NumForcedGC", float64(memStats.NumForcedGC)),
+		newGauge("NumGC", float64(memStats.NumGC)),
+		newGauge("OtherSys", float64(memStats.OtherSys)),
+		newGauge("PauseTotalNs", float64(memStats.PauseTotalNs)),
+		newGauge("StackInuse", float64(memStats.StackInuse)),
+		newGauge("StackSys", float64(memStats.StackSys)),
+		newGauge("Sys", float64(memStats.Sys)),
+		newGauge("TotalAlloc", float64(memStats.TotalAlloc)),
+		newGauge("MSpanInuse", float64(memStats.MSpanInuse)),
+		newGauge("MSpanSys", float64(memStats.MSpanSys)),
+		newGauge("RandomValue", rand.Float64()),
+	}
+
+	// счетчик PollCount
+	metrics = append(metrics, newCounter("PollCount", r.pollCount.Add(1)))
+
+	return metrics, nil
+}
@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"context"
+	"github.com/dip96/metrics/internal/model/metric"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRuntimeCollect(t *testing.T) {
+	r := NewRuntime()
+
+	metrics, err := r.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, metrics)
+
+	// Имена метрик не повторяются
+	seen := make(map[string]bool)
+	for _, m := range metrics {
+		assert.False(t, seen[m.ID], "duplicate metric %s", m.ID)
+		seen[m.ID] = true
+	}
+
+	// Проверяем наличие метрик gauge
+	assert.True(t, seen["Alloc"])
+	assert.True(t, seen["RandomValue"])
+
+	// Счетчик PollCount растет с каждым сбором
+	pollCount := func(metrics []metric.Metric) int64 {
+		for _, m := range metrics {
+			if m.ID == "PollCount" && m.MType == metric.MetricTypeCounter {
+				return *m.Delta
+			}
+		}
+		return 0
+	}
+	assert.Equal(t, int64(1), pollCount(metrics))
+
+	metrics, err = r.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), pollCount(metrics))
+}
@@ -0,0 +1,215 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dip96/metrics/internal/config"
+	"github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/prometheus"
+)
+
+// ScrapeName - имя сборщика, опрашивающего страницы метрик Prometheus.
+const ScrapeName = "scrape"
+
+// DefaultScrapeInterval - интервал опроса целей по умолчанию.
+const DefaultScrapeInterval = 15 * time.Second
+
+// scrapeTarget - опрашиваемая страница метрик.
+type scrapeTarget struct {
+	url string
+	// instance - адрес цели, который добавляется к рядам меткой instance.
+	instance string
+}
+
+// Scrape опрашивает страницы метрик в текстовом формате Prometheus.
+// Ряды типа counter отправляются как приращения счетчиков, gauge и ряды без типа - как gauge.
+// Ряды гистограмм и summary не поддерживаются и пропускаются.
+// Для каждой цели также отправляется gauge up: 1, если опрос удался, иначе 0.
+type Scrape struct {
+	targets   []scrapeTarget
+	relabeler *Relabeler
+	client    *http.Client
+
+	mu sync.Mutex
+	// counters - последние значения счетчиков по адресу цели и ключу ряда.
+	counters map[string]map[string]float64
+}
+
+// NewScrape создает сборщик, опрашивающий targets с таймаутом timeout
+// и применяющий к рядам правила relabel.
+func NewScrape(targets []string, rules []config.RelabelConfig, timeout time.Duration) (*Scrape, error) {
+	relabeler, err := NewRelabeler(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Scrape{
+		relabeler: relabeler,
+		client:    &http.Client{Timeout: timeout},
+		counters:  make(map[string]map[string]float64),
+	}
+
+	for _, target := range targets {
+		t, err := parseScrapeTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		s.targets = append(s.targets, t)
+	}
+
+	return s, nil
+}
+
+// parseScrapeTarget дополняет адрес цели схемой http и путем /metrics, если они не заданы.
+func parseScrapeTarget(target string) (scrapeTarget, error) {
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return scrapeTarget{}, fmt.Errorf("invalid scrape target %q", target)
+	}
+
+	if u.Path == "" {
+		u.Path = "/metrics"
+	}
+
+	return scrapeTarget{url: u.String(), instance: u.Host}, nil
+}
+
+// Name возвращает имя сборщика.
+func (s *Scrape) Name() string {
+	return ScrapeName
+}
+
+// Collect опрашивает все цели. Ошибка опроса цели не прерывает опрос остальных
+// и отражается только в значении up.
+// Приращение счетчика считается от значения предыдущего опроса, поэтому при первом опросе
+// ряда отправляется только его значение up. Если значение уменьшилось, счетчик считается сброшенным.
+func (s *Scrape) Collect(ctx context.Context) ([]metric.Metric, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var metrics []metric.Metric
+
+	for _, target := range s.targets {
+		up := 1.0
+
+		samples, err := s.scrape(ctx, target)
+		if err != nil {
+			log.Printf("Scrape of %s failed: %v", target.url, err)
+			up = 0
+		} else {
+			metrics = append(metrics, s.convert(target, samples)...)
+		}
+
+		m := newGauge("up", up)
+		m.Labels = map[string]string{"instance": target.instance}
+		metrics = append(metrics, m)
+	}
+
+	return metrics, nil
+}
+
+func (s *Scrape) scrape(ctx context.Context, target scrapeTarget) ([]prometheus.Sample, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", string(prometheus.FormatText))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return prometheus.ParseText(resp.Body)
+}
+
+// convert преобразует отсчеты цели в метрики, применяя правила relabel.
+func (s *Scrape) convert(target scrapeTarget, samples []prometheus.Sample) []metric.Metric {
+	var metrics []metric.Metric
+
+	previous := s.counters[target.url]
+	counters := make(map[string]float64)
+
+	for _, sample := range samples {
+		var mType metric.MetricType
+		switch {
+		case sample.Type == prometheus.TypeCounter && (sample.Name == sample.Family || sample.Name == sample.Family+"_total"):
+			mType = metric.MetricTypeCounter
+		case (sample.Type == prometheus.TypeGauge || sample.Type == prometheus.TypeUntyped) && sample.Name == sample.Family:
+			mType = metric.MetricTypeGauge
+		default:
+			continue
+		}
+
+		labels := metric.CopyLabels(sample.Labels)
+		if labels == nil {
+			labels = make(map[string]string, 2)
+		}
+		labels["__name__"] = sample.Name
+		if _, ok := labels["instance"]; !ok {
+			labels["instance"] = target.instance
+		}
+
+		labels, keep := s.relabeler.Apply(labels)
+		if !keep || labels["__name__"] == "" {
+			continue
+		}
+
+		m := metric.Metric{ID: labels["__name__"], MType: mType}
+		// Метки с префиксом __ служебные и не отправляются
+		for name := range labels {
+			if strings.HasPrefix(name, "__") {
+				delete(labels, name)
+			}
+		}
+		m.Labels = labels
+
+		if mType == metric.MetricTypeGauge {
+			value := sample.Value
+			m.Value = &value
+			metrics = append(metrics, m)
+			continue
+		}
+
+		if sample.Value < 0 || sample.Value >= math.MaxInt64 || math.IsNaN(sample.Value) {
+			continue
+		}
+
+		key := m.Key()
+		counters[key] = sample.Value
+
+		last, ok := previous[key]
+		if !ok {
+			continue
+		}
+
+		// Разность округленных значений не теряет дробные приращения между опросами
+		delta := int64(math.Round(sample.Value))
+		if sample.Value >= last {
+			delta -= int64(math.Round(last))
+		}
+		m.Delta = &delta
+		metrics = append(metrics, m)
+	}
+
+	s.counters[target.url] = counters
+
+	return metrics
+}
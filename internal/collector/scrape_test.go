@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dip96/metrics/internal/config"
+	"github.com/dip96/metrics/internal/model/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelabeler(t *testing.T) {
+	empty := ""
+	relabeler, err := NewRelabeler([]config.RelabelConfig{
+		{SourceLabels: []string{"__name__"}, Regex: "go_.*", Action: config.RelabelDrop},
+		{SourceLabels: []string{"__name__", "code"}, Regex: "(.+);(5..)", TargetLabel: "error"},
+		{SourceLabels: []string{"path"}, Regex: "/api/(.*)", TargetLabel: "path", Replacement: &empty},
+		{Regex: "debug_.*", Action: config.RelabelLabelDrop},
+	})
+	require.NoError(t, err)
+
+	labels, keep := relabeler.Apply(map[string]string{"__name__": "go_goroutines"})
+	assert.False(t, keep)
+	assert.Nil(t, labels)
+
+	labels, keep = relabeler.Apply(map[string]string{
+		"__name__": "requests_total", "code": "503", "path": "/api/users", "debug_id": "1",
+	})
+	assert.True(t, keep)
+	assert.Equal(t, map[string]string{"__name__": "requests_total", "code": "503", "error": "requests_total"}, labels)
+
+	_, err = NewRelabeler([]config.RelabelConfig{{Regex: "(", TargetLabel: "a"}})
+	assert.Error(t, err)
+
+	_, err = NewRelabeler([]config.RelabelConfig{{Action: "hashmod"}})
+	assert.Error(t, err)
+
+	_, err = NewRelabeler([]config.RelabelConfig{{SourceLabels: []string{"a"}}})
+	assert.Error(t, err)
+}
+
+func TestScrape(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/metrics", r.URL.Path)
+		requests++
+		fmt.Fprintf(w, `# TYPE http_requests_total counter
+http_requests_total{code="200"} %d
+# TYPE process_cpu_seconds counter
+process_cpu_seconds_total %v
+# TYPE queue_length gauge
+queue_length{queue="mail"} %d
+# TYPE latency histogram
+latency_bucket{le="+Inf"} 3
+latency_count 3
+go_goroutines 12
+`, []int{10, 15, 2}[requests-1], []float64{1.2, 1.9, 2.4}[requests-1], requests)
+	}))
+	defer server.Close()
+
+	instance := strings.TrimPrefix(server.URL, "http://")
+	scrape, err := NewScrape([]string{instance, "127.0.0.1:1"}, []config.RelabelConfig{
+		{SourceLabels: []string{"__name__"}, Regex: "go_.*", Action: config.RelabelDrop},
+	}, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, ScrapeName, scrape.Name())
+
+	byKey := func(metrics []metric.Metric) map[string]metric.Metric {
+		result := make(map[string]metric.Metric, len(metrics))
+		for _, m := range metrics {
+			result[m.Key()] = m
+		}
+		return result
+	}
+	requestsKey := metric.SeriesKey("http_requests_total", map[string]string{"code": "200", "instance": instance})
+	cpuKey := metric.SeriesKey("process_cpu_seconds_total", map[string]string{"instance": instance})
+	queueKey := metric.SeriesKey("queue_length", map[string]string{"queue": "mail", "instance": instance})
+
+	// При первом опросе счетчики только запоминаются
+	metrics, err := scrape.Collect(context.Background())
+	require.NoError(t, err)
+	first := byKey(metrics)
+	assert.Len(t, first, 3)
+	assert.Equal(t, 1.0, *first[queueKey].Value)
+	assert.Equal(t, 1.0, *first[metric.SeriesKey("up", map[string]string{"instance": instance})].Value)
+	assert.Equal(t, 0.0, *first[metric.SeriesKey("up", map[string]string{"instance": "127.0.0.1:1"})].Value)
+
+	metrics, err = scrape.Collect(context.Background())
+	require.NoError(t, err)
+	second := byKey(metrics)
+	assert.Len(t, second, 5)
+	assert.Equal(t, metric.MetricTypeCounter, second[requestsKey].MType)
+	assert.Equal(t, int64(5), *second[requestsKey].Delta)
+	assert.Equal(t, int64(1), *second[cpuKey].Delta)
+	assert.Equal(t, 2.0, *second[queueKey].Value)
+
+	// Уменьшение значения означает сброс счетчика
+	metrics, err = scrape.Collect(context.Background())
+	require.NoError(t, err)
+	third := byKey(metrics)
+	assert.Equal(t, int64(2), *third[requestsKey].Delta)
+	assert.Equal(t, int64(0), *third[cpuKey].Delta)
+}
+
+func TestParseScrapeTarget(t *testing.T) {
+	target, err := parseScrapeTarget("localhost:9100")
+	require.NoError(t, err)
+	assert.Equal(t, scrapeTarget{url: "http://localhost:9100/metrics", instance: "localhost:9100"}, target)
+
+	target, err = parseScrapeTarget("https://app:8443/internal/metrics")
+	require.NoError(t, err)
+	assert.Equal(t, "https://app:8443/internal/metrics", target.url)
+
+	_, err = parseScrapeTarget("http://")
+	assert.Error(t, err)
+}
@@ -3,15 +3,34 @@ package config
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
+)
+
+// Протоколы отправки метрик агентом.
+const (
+	// TransportHTTP - отправка метрик только по HTTP.
+	TransportHTTP = "http"
+	// TransportGRPC - отправка метрик только по gRPC.
+	TransportGRPC = "grpc"
+	// TransportBoth - отправка метрик по HTTP и gRPC одновременно. Только на время миграции:
+	// сервер получает каждую пачку дважды, и приращения счетчиков удваиваются.
+	TransportBoth = "both"
 )
 
 // Agent представляет конфигурацию агента.
 type Agent struct {
 	// FlagRunAddr - адрес и порт для запуска сервера.
 	FlagRunAddr string `json:"address"`
+	// GRPCAddress - адрес и порт gRPC сервера.
+	GRPCAddress string `json:"grpc_address"`
+	// Transport - протокол отправки метрик: http, grpc или both.
+	Transport string `json:"transport"`
 	// FlagReportInterval - интервал отчетности в секундах.
 	FlagReportInterval int `json:"report_interval"`
 	// FlagRuntime - время работы приложения в секундах.
@@ -20,12 +39,107 @@ type Agent struct {
 	Key string `json:"key"`
 	// RateLimit - ограничение скорости в запросах в секунду.
 	RateLimit int `json:"rate_limit"`
-	// CryptoKey - путь до файла с публичным ключом
+	// BatchSize - максимальное количество метрик в одной отправляемой пачке.
+	BatchSize int `json:"batch_size"`
+	// StreamWindow - максимальное количество неподтвержденных сервером пачек в потоке gRPC.
+	StreamWindow int `json:"stream_window"`
+	// CryptoKey - путь до файла с публичным ключом. Если не задан, данные не шифруются RSA.
 	CryptoKey string `json:"crypto_key"`
+	// TLSCA - путь до сертификата CA сервера. Если задан, агент подключается по TLS.
+	TLSCA string `json:"tls_ca"`
+	// TLSCert - путь до клиентского сертификата агента для mTLS. Если задан, агент подключается по TLS.
+	TLSCert string `json:"tls_cert"`
+	// TLSKey - путь до приватного ключа клиентского сертификата агента.
+	TLSKey string `json:"tls_key"`
+	// TLSServerName - имя сервера для проверки его сертификата, если оно отличается от адреса.
+	TLSServerName string `json:"tls_server_name"`
+	// Labels - метки, которые агент добавляет ко всем отправляемым метрикам (например, host).
+	// Задаются в файле конфигурации или переменной окружения LABELS.
+	Labels map[string]string `json:"labels"`
+	// SpoolDir - каталог очереди неотправленных пачек метрик. Пустое значение отключает очередь.
+	SpoolDir string `json:"spool_dir"`
+	// SpoolMaxSize - максимальный суммарный размер очереди в байтах.
+	SpoolMaxSize int64 `json:"spool_max_size"`
+	// SpoolMaxAge - максимальный возраст пачки в очереди в секундах.
+	SpoolMaxAge int `json:"spool_max_age"`
+	// Collectors - настройки сборщиков метрик по имени сборщика.
+	Collectors map[string]CollectorConfig `json:"collectors"`
+	// ScrapeTargets - адреса страниц метрик в текстовом формате Prometheus, которые опрашивает сборщик scrape.
+	// Адрес без схемы дополняется http://, адрес без пути - /metrics.
+	// Задаются в файле конфигурации или переменной окружения SCRAPE_TARGETS.
+	ScrapeTargets []string `json:"scrape_targets"`
+	// ScrapeTimeout - таймаут опроса одной цели в секундах.
+	ScrapeTimeout int `json:"scrape_timeout"`
+	// ScrapeRelabel - правила relabel, которые применяются к рядам сборщика scrape по порядку.
+	ScrapeRelabel []RelabelConfig `json:"scrape_relabel"`
 	// Config - путь до файла конфигурации
 	Config string
 }
 
+// CollectorConfig представляет настройки сборщика метрик агента.
+type CollectorConfig struct {
+	// Enabled - включен ли сборщик. Если не задано, сборщик включен.
+	Enabled *bool `json:"enabled"`
+	// Interval - интервал сбора в секундах. Нулевое значение означает интервал сборщика по умолчанию.
+	Interval int `json:"interval"`
+}
+
+// Действия правил relabel.
+const (
+	// RelabelReplace - записать в метку TargetLabel значение Replacement, если значения SourceLabels подходят под Regex.
+	RelabelReplace = "replace"
+	// RelabelKeep - оставить только ряды, значения SourceLabels которых подходят под Regex.
+	RelabelKeep = "keep"
+	// RelabelDrop - отбросить ряды, значения SourceLabels которых подходят под Regex.
+	RelabelDrop = "drop"
+	// RelabelLabelDrop - удалить метки, имена которых подходят под Regex.
+	RelabelLabelDrop = "labeldrop"
+	// RelabelLabelKeep - оставить только метки, имена которых подходят под Regex.
+	RelabelLabelKeep = "labelkeep"
+)
+
+// RelabelConfig представляет правило relabel в формате metric_relabel_configs Prometheus.
+// Имя метрики доступно в метке __name__, адрес цели - в метке instance.
+type RelabelConfig struct {
+	// SourceLabels - метки, значения которых объединяются через Separator и сравниваются с Regex.
+	SourceLabels []string `json:"source_labels"`
+	// Separator - разделитель значений SourceLabels. По умолчанию ";".
+	Separator *string `json:"separator"`
+	// Regex - регулярное выражение, которому должно полностью соответствовать значение. По умолчанию "(.*)".
+	Regex string `json:"regex"`
+	// TargetLabel - метка, в которую записывается результат действия replace.
+	TargetLabel string `json:"target_label"`
+	// Replacement - значение для TargetLabel, может ссылаться на группы Regex ($1). По умолчанию "$1".
+	Replacement *string `json:"replacement"`
+	// Action - действие правила. По умолчанию replace.
+	Action string `json:"action"`
+}
+
+// CollectorEnabled сообщает, включен ли сборщик с именем name.
+func (a *Agent) CollectorEnabled(name string) bool {
+	c, ok := a.Collectors[name]
+	if !ok || c.Enabled == nil {
+		return true
+	}
+
+	return *c.Enabled
+}
+
+// CollectorInterval возвращает интервал сбора для сборщика с именем name.
+// Если интервал не задан в конфигурации, возвращается defaultInterval,
+// а если не задан и он, то интервал опроса агента FlagRuntime.
+func (a *Agent) CollectorInterval(name string, defaultInterval time.Duration) time.Duration {
+	if c, ok := a.Collectors[name]; ok && c.Interval > 0 {
+		return time.Duration(c.Interval) * time.Second
+	}
+
+	if defaultInterval > 0 {
+		return defaultInterval
+	}
+
+	return time.Duration(a.FlagRuntime) * time.Second
+}
+
 // agentConfig - глобальная переменная, содержащая конфигурацию агента.
 var agentConfig *Agent
 
@@ -52,12 +166,24 @@ func initAgentConfig() (*Agent, error) {
 
 	agentFlags := flag.NewFlagSet("agent", flag.ExitOnError)
 	agentFlags.StringVar(&cfg.FlagRunAddr, "a", "localhost:8080", "address and port to run server")
+	agentFlags.StringVar(&cfg.GRPCAddress, "grpc-address", "127.0.0.1:3200", "address and port of gRPC server")
+	agentFlags.StringVar(&cfg.Transport, "transport", TransportHTTP, "Protocol to send metrics: http, grpc or both")
 	agentFlags.StringVar(&cfg.CryptoKey, "crypto-key", "", "public key")
+	agentFlags.StringVar(&cfg.TLSCA, "tls-ca", "", "CA certificate of the server")
+	agentFlags.StringVar(&cfg.TLSCert, "tls-cert", "", "Agent TLS client certificate")
+	agentFlags.StringVar(&cfg.TLSKey, "tls-key", "", "Agent TLS client private key")
+	agentFlags.StringVar(&cfg.TLSServerName, "tls-server-name", "", "Server name to verify the server certificate")
 	agentFlags.IntVar(&cfg.FlagReportInterval, "r", 10, "address and port to run server")
 	agentFlags.IntVar(&cfg.FlagRuntime, "p", 2, "address and port to run server")
 	agentFlags.StringVar(&cfg.Key, "k", "", "key")
 	agentFlags.IntVar(&cfg.RateLimit, "l", 10, "Rate limit")
+	agentFlags.IntVar(&cfg.BatchSize, "batch-size", 500, "Max number of metrics in a batch")
+	agentFlags.IntVar(&cfg.StreamWindow, "stream-window", 16, "Max number of unacknowledged batches in the gRPC stream")
 	agentFlags.StringVar(&cfg.Config, "c", "/home/dip96/go_project/src/metrics/config_agent.json", "Config path")
+	agentFlags.StringVar(&cfg.SpoolDir, "spool-dir", filepath.Join(os.TempDir(), "metrics-agent-spool"), "Directory of the pending batches queue")
+	agentFlags.Int64Var(&cfg.SpoolMaxSize, "spool-max-size", 50<<20, "Max size of the pending batches queue in bytes")
+	agentFlags.IntVar(&cfg.SpoolMaxAge, "spool-max-age", 3600, "Max age of a pending batch in seconds")
+	agentFlags.IntVar(&cfg.ScrapeTimeout, "scrape-timeout", 10, "Timeout to scrape a target in seconds")
 
 	if cfg.Config != "" {
 		err := readConfigFileAgent(cfg.Config, &cfg)
@@ -70,6 +196,14 @@ func initAgentConfig() (*Agent, error) {
 		cfg.FlagRunAddr = envRunAddr
 	}
 
+	if envGRPCAddress := os.Getenv("GRPC_ADDRESS"); envGRPCAddress != "" {
+		cfg.GRPCAddress = envGRPCAddress
+	}
+
+	if envTransport := os.Getenv("TRANSPORT"); envTransport != "" {
+		cfg.Transport = envTransport
+	}
+
 	if envReportInterval := os.Getenv("REPORT_INTERVAL"); envReportInterval != "" {
 		cfg.FlagReportInterval, _ = strconv.Atoi(envReportInterval)
 	}
@@ -86,6 +220,14 @@ func initAgentConfig() (*Agent, error) {
 		cfg.RateLimit, _ = strconv.Atoi(envRateLimit)
 	}
 
+	if envBatchSize := os.Getenv("BATCH_SIZE"); envBatchSize != "" {
+		cfg.BatchSize, _ = strconv.Atoi(envBatchSize)
+	}
+
+	if envStreamWindow := os.Getenv("STREAM_WINDOW"); envStreamWindow != "" {
+		cfg.StreamWindow, _ = strconv.Atoi(envStreamWindow)
+	}
+
 	if envCryptoKey := os.Getenv("CRYPTO_KEY"); envCryptoKey != "" {
 		cfg.CryptoKey = envCryptoKey
 	}
@@ -94,9 +236,115 @@ func initAgentConfig() (*Agent, error) {
 		cfg.Config = envConfig
 	}
 
+	if envTLSCA := os.Getenv("TLS_CA"); envTLSCA != "" {
+		cfg.TLSCA = envTLSCA
+	}
+
+	if envTLSCert := os.Getenv("TLS_CERT"); envTLSCert != "" {
+		cfg.TLSCert = envTLSCert
+	}
+
+	if envTLSKey := os.Getenv("TLS_KEY"); envTLSKey != "" {
+		cfg.TLSKey = envTLSKey
+	}
+
+	if envTLSServerName := os.Getenv("TLS_SERVER_NAME"); envTLSServerName != "" {
+		cfg.TLSServerName = envTLSServerName
+	}
+
+	if envSpoolDir, ok := os.LookupEnv("SPOOL_DIR"); ok {
+		cfg.SpoolDir = envSpoolDir
+	}
+
+	if envSpoolMaxSize := os.Getenv("SPOOL_MAX_SIZE"); envSpoolMaxSize != "" {
+		cfg.SpoolMaxSize, _ = strconv.ParseInt(envSpoolMaxSize, 10, 64)
+	}
+
+	if envSpoolMaxAge := os.Getenv("SPOOL_MAX_AGE"); envSpoolMaxAge != "" {
+		cfg.SpoolMaxAge, _ = strconv.Atoi(envSpoolMaxAge)
+	}
+
+	// DISABLED_COLLECTORS - список отключаемых сборщиков через запятую
+	if envDisabledCollectors := os.Getenv("DISABLED_COLLECTORS"); envDisabledCollectors != "" {
+		disableCollectors(&cfg, envDisabledCollectors)
+	}
+
+	if envScrapeTimeout := os.Getenv("SCRAPE_TIMEOUT"); envScrapeTimeout != "" {
+		cfg.ScrapeTimeout, _ = strconv.Atoi(envScrapeTimeout)
+	}
+
+	// SCRAPE_TARGETS - список целей через запятую
+	if envScrapeTargets := os.Getenv("SCRAPE_TARGETS"); envScrapeTargets != "" {
+		cfg.ScrapeTargets = splitList(envScrapeTargets)
+	}
+
+	// LABELS - метки в виде key1=value1,key2=value2
+	if envLabels := os.Getenv("LABELS"); envLabels != "" {
+		cfg.Labels = ParseLabels(envLabels)
+	}
+
+	switch cfg.Transport {
+	case TransportHTTP, TransportGRPC, TransportBoth:
+	default:
+		return nil, fmt.Errorf("unknown transport %q, expected %s, %s or %s", cfg.Transport, TransportHTTP, TransportGRPC, TransportBoth)
+	}
+
+	if len(cfg.ScrapeTargets) > 0 && cfg.ScrapeTimeout <= 0 {
+		return nil, fmt.Errorf("scrape timeout must be positive, got %d", cfg.ScrapeTimeout)
+	}
+
 	return &cfg, nil
 }
 
+// splitList разбирает список значений через запятую, пропуская пустые.
+func splitList(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// ParseLabels разбирает строку вида key1=value1,key2=value2 в набор меток.
+// Пары без знака равенства или с пустым именем пропускаются.
+func ParseLabels(s string) map[string]string {
+	labels := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+
+		labels[name] = strings.TrimSpace(value)
+	}
+
+	return labels
+}
+
+// disableCollectors отключает сборщики, перечисленные в строке names через запятую.
+func disableCollectors(cfg *Agent, names string) {
+	if cfg.Collectors == nil {
+		cfg.Collectors = make(map[string]CollectorConfig)
+	}
+
+	disabled := false
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		c := cfg.Collectors[name]
+		c.Enabled = &disabled
+		cfg.Collectors[name] = c
+	}
+}
+
 func readConfigFileAgent(path string, cfg *Agent) error {
 	file, err := os.Open(path)
 	if err != nil {
@@ -3,8 +3,10 @@ package config
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -12,6 +14,8 @@ import (
 type Server struct {
 	// FlagRunAddr - адрес и порт для запуска сервера.
 	FlagRunAddr string `json:"address"`
+	// GRPCAddress - адрес и порт для запуска gRPC сервера.
+	GRPCAddress string `json:"grpc_address"`
 	// StoreInterval - интервал сохранения метрик в секундах.
 	StoreInterval int `json:"store_interval"`
 	// FileStoragePath - путь к файлу для хранения метрик.
@@ -32,6 +36,41 @@ type Server struct {
 	Config string
 	// TrustedSubnet -  строковое представление бесклассовой адресации (CIDR)
 	TrustedSubnet string `json:"trusted_subnet"`
+	// MetricsTrustedSubnet - подсеть (CIDR), из которой разрешено читать страницу /metrics.
+	// Пустая строка разрешает чтение с любого адреса.
+	MetricsTrustedSubnet string `json:"metrics_trusted_subnet"`
+	// TLSCert - путь до сертификата сервера. Если задан, HTTP и gRPC слушают по TLS.
+	TLSCert string `json:"tls_cert"`
+	// TLSKey - путь до приватного ключа сертификата сервера.
+	TLSKey string `json:"tls_key"`
+	// TLSClientCA - путь до сертификата CA агентов. Если задан, сервер требует сертификат агента (mTLS).
+	TLSClientCA string `json:"tls_client_ca"`
+	// SeriesTTL - время в секундах, после которого не обновлявшийся ряд удаляется из хранилища.
+	// 0 - ряды не удаляются.
+	SeriesTTL int `json:"series_ttl"`
+	// SeriesTTLPrefixes - время жизни рядов в секундах по префиксу имени метрики.
+	// Используется самый длинный подходящий префикс, 0 - ряды с префиксом не удаляются.
+	SeriesTTLPrefixes map[string]int `json:"series_ttl_prefixes"`
+	// SampleRetention - время хранения исходных отсчетов истории в секундах.
+	// Более старые отсчеты удаляются, история за этот период доступна по агрегатам. 0 - отсчеты не удаляются.
+	SampleRetention int `json:"sample_retention"`
+	// JanitorInterval - интервал проверки устаревших рядов в секундах.
+	JanitorInterval int `json:"janitor_interval"`
+	// StatsdUDPAddress - адрес и порт приема метрик StatsD по UDP. Пустая строка отключает прием.
+	StatsdUDPAddress string `json:"statsd_udp_address"`
+	// StatsdTCPAddress - адрес и порт приема метрик StatsD по TCP. Пустая строка отключает прием.
+	StatsdTCPAddress string `json:"statsd_tcp_address"`
+	// StatsdFlushInterval - интервал сброса агрегированных метрик StatsD в хранилище в секундах.
+	StatsdFlushInterval int `json:"statsd_flush_interval"`
+	// GraphiteAddress - адрес и порт приема метрик по протоколу Graphite plaintext. Пустая строка отключает прием.
+	GraphiteAddress string `json:"graphite_address"`
+	// GraphitePickleAddress - адрес и порт приема метрик по протоколу Graphite pickle. Пустая строка отключает прием.
+	GraphitePickleAddress string `json:"graphite_pickle_address"`
+	// GraphiteTemplates - правила разбора путей Graphite на имя метрики и метки вида "[фильтр] шаблон".
+	GraphiteTemplates []string `json:"graphite_templates"`
+	// InfluxCounterFields - шаблоны полей measurement.field line protocol, которые сохраняются как counter.
+	// Остальные поля сохраняются как gauge.
+	InfluxCounterFields []string `json:"influx_counter_fields"`
 }
 
 // serverConfig - глобальная переменная, содержащая конфигурацию сервера.
@@ -60,6 +99,7 @@ func initServerConfig() (*Server, error) {
 	serverFlags := flag.NewFlagSet("server", flag.ExitOnError)
 
 	serverFlags.StringVar(&cfg.FlagRunAddr, "a", "localhost:8080", "address and port to run server")
+	serverFlags.StringVar(&cfg.GRPCAddress, "grpc-address", "127.0.0.1:3200", "address and port to run gRPC server")
 	serverFlags.StringVar(&cfg.DatabaseDsn, "d", "", "")
 	serverFlags.StringVar(&cfg.CryptoKey, "crypto-key", "/tmp/keys", "private key")
 	serverFlags.StringVar(&cfg.FileStoragePath, "f", "/tmp/metrics-db.json", "File to save metrics")
@@ -70,6 +110,18 @@ func initServerConfig() (*Server, error) {
 	serverFlags.StringVar(&cfg.Key, "k", "", "key")
 	serverFlags.StringVar(&cfg.Config, "c", "/home/dip96/go_project/src/metrics/config_server.json", "Config path")
 	serverFlags.StringVar(&cfg.TrustedSubnet, "t", "", "")
+	serverFlags.StringVar(&cfg.MetricsTrustedSubnet, "metrics-trusted-subnet", "", "Subnet allowed to scrape /metrics")
+	serverFlags.StringVar(&cfg.TLSCert, "tls-cert", "", "Server TLS certificate")
+	serverFlags.StringVar(&cfg.TLSKey, "tls-key", "", "Server TLS private key")
+	serverFlags.StringVar(&cfg.TLSClientCA, "tls-client-ca", "", "CA certificate of agents for mutual TLS")
+	serverFlags.IntVar(&cfg.SeriesTTL, "series-ttl", 0, "Seconds after which a series without updates is removed")
+	serverFlags.IntVar(&cfg.SampleRetention, "sample-retention", 24*60*60, "Seconds to keep raw metric samples")
+	serverFlags.IntVar(&cfg.JanitorInterval, "janitor-interval", 60, "Interval to remove stale series")
+	serverFlags.StringVar(&cfg.StatsdUDPAddress, "statsd-udp-address", "", "address and port to receive StatsD metrics over UDP")
+	serverFlags.StringVar(&cfg.StatsdTCPAddress, "statsd-tcp-address", "", "address and port to receive StatsD metrics over TCP")
+	serverFlags.IntVar(&cfg.StatsdFlushInterval, "statsd-flush-interval", 10, "Interval to flush StatsD metrics")
+	serverFlags.StringVar(&cfg.GraphiteAddress, "graphite-address", "", "address and port to receive Graphite plaintext metrics")
+	serverFlags.StringVar(&cfg.GraphitePickleAddress, "graphite-pickle-address", "", "address and port to receive Graphite pickle metrics")
 
 	if cfg.Config != "" {
 		err := readConfigFileServer(cfg.Config, &cfg)
@@ -83,6 +135,10 @@ func initServerConfig() (*Server, error) {
 		cfg.FlagRunAddr = envRunAddr
 	}
 
+	if envGRPCAddress := os.Getenv("GRPC_ADDRESS"); envGRPCAddress != "" {
+		cfg.GRPCAddress = envGRPCAddress
+	}
+
 	if envStoreInterval := os.Getenv("STORE_INTERVAL"); envStoreInterval != "" {
 		cfg.StoreInterval, _ = strconv.Atoi(envStoreInterval)
 	}
@@ -115,9 +171,119 @@ func initServerConfig() (*Server, error) {
 		cfg.TrustedSubnet = envTrustedSubnet
 	}
 
+	if envMetricsTrustedSubnet := os.Getenv("METRICS_TRUSTED_SUBNET"); envMetricsTrustedSubnet != "" {
+		cfg.MetricsTrustedSubnet = envMetricsTrustedSubnet
+	}
+
+	if envTLSCert := os.Getenv("TLS_CERT"); envTLSCert != "" {
+		cfg.TLSCert = envTLSCert
+	}
+
+	if envTLSKey := os.Getenv("TLS_KEY"); envTLSKey != "" {
+		cfg.TLSKey = envTLSKey
+	}
+
+	if envTLSClientCA := os.Getenv("TLS_CLIENT_CA"); envTLSClientCA != "" {
+		cfg.TLSClientCA = envTLSClientCA
+	}
+
+	if envSeriesTTL := os.Getenv("SERIES_TTL"); envSeriesTTL != "" {
+		cfg.SeriesTTL, _ = strconv.Atoi(envSeriesTTL)
+	}
+
+	// SERIES_TTL_PREFIXES - время жизни по префиксам в виде prefix1=seconds,prefix2=seconds
+	if envSeriesTTLPrefixes := os.Getenv("SERIES_TTL_PREFIXES"); envSeriesTTLPrefixes != "" {
+		prefixes, err := parseTTLPrefixes(envSeriesTTLPrefixes)
+		if err != nil {
+			return nil, err
+		}
+		cfg.SeriesTTLPrefixes = prefixes
+	}
+
+	if envSampleRetention := os.Getenv("SAMPLE_RETENTION"); envSampleRetention != "" {
+		cfg.SampleRetention, _ = strconv.Atoi(envSampleRetention)
+	}
+
+	if envJanitorInterval := os.Getenv("JANITOR_INTERVAL"); envJanitorInterval != "" {
+		cfg.JanitorInterval, _ = strconv.Atoi(envJanitorInterval)
+	}
+
+	if envStatsdUDPAddress := os.Getenv("STATSD_UDP_ADDRESS"); envStatsdUDPAddress != "" {
+		cfg.StatsdUDPAddress = envStatsdUDPAddress
+	}
+
+	if envStatsdTCPAddress := os.Getenv("STATSD_TCP_ADDRESS"); envStatsdTCPAddress != "" {
+		cfg.StatsdTCPAddress = envStatsdTCPAddress
+	}
+
+	if envStatsdFlushInterval := os.Getenv("STATSD_FLUSH_INTERVAL"); envStatsdFlushInterval != "" {
+		cfg.StatsdFlushInterval, _ = strconv.Atoi(envStatsdFlushInterval)
+	}
+
+	if envGraphiteAddress := os.Getenv("GRAPHITE_ADDRESS"); envGraphiteAddress != "" {
+		cfg.GraphiteAddress = envGraphiteAddress
+	}
+
+	if envGraphitePickleAddress := os.Getenv("GRAPHITE_PICKLE_ADDRESS"); envGraphitePickleAddress != "" {
+		cfg.GraphitePickleAddress = envGraphitePickleAddress
+	}
+
+	// GRAPHITE_TEMPLATES - правила шаблонов через запятую
+	if envGraphiteTemplates := os.Getenv("GRAPHITE_TEMPLATES"); envGraphiteTemplates != "" {
+		cfg.GraphiteTemplates = nil
+		for _, rule := range strings.Split(envGraphiteTemplates, ",") {
+			if rule = strings.TrimSpace(rule); rule != "" {
+				cfg.GraphiteTemplates = append(cfg.GraphiteTemplates, rule)
+			}
+		}
+	}
+
+	// INFLUX_COUNTER_FIELDS - шаблоны полей через запятую
+	if envInfluxCounterFields := os.Getenv("INFLUX_COUNTER_FIELDS"); envInfluxCounterFields != "" {
+		cfg.InfluxCounterFields = nil
+		for _, pattern := range strings.Split(envInfluxCounterFields, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				cfg.InfluxCounterFields = append(cfg.InfluxCounterFields, pattern)
+			}
+		}
+	}
+
+	if cfg.SeriesTTL < 0 {
+		return nil, fmt.Errorf("series ttl must not be negative, got %d", cfg.SeriesTTL)
+	}
+
+	for prefix, ttl := range cfg.SeriesTTLPrefixes {
+		if ttl < 0 {
+			return nil, fmt.Errorf("series ttl for prefix %q must not be negative, got %d", prefix, ttl)
+		}
+	}
+
+	if cfg.SampleRetention < 0 {
+		return nil, fmt.Errorf("sample retention must not be negative, got %d", cfg.SampleRetention)
+	}
+
+	if cfg.StatsdFlushInterval <= 0 && (cfg.StatsdUDPAddress != "" || cfg.StatsdTCPAddress != "") {
+		return nil, fmt.Errorf("statsd flush interval must be positive, got %d", cfg.StatsdFlushInterval)
+	}
+
 	return &cfg, nil
 }
 
+// parseTTLPrefixes разбирает строку вида prefix1=seconds,prefix2=seconds.
+func parseTTLPrefixes(s string) (map[string]int, error) {
+	prefixes := make(map[string]int)
+
+	for prefix, value := range ParseLabels(s) {
+		ttl, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid series ttl for prefix %q: %w", prefix, err)
+		}
+		prefixes[prefix] = ttl
+	}
+
+	return prefixes, nil
+}
+
 func readConfigFileServer(path string, cfg *Server) error {
 	file, err := os.Open(path)
 	if err != nil {
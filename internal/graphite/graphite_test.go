@@ -0,0 +1,185 @@
+package graphite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage/mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Сообщения pickle.dumps([("servers.web1.cpu.load", (1700000000, 0.5)), ("servers.web1.mem", (1700000000.5, "42"))])
+var pickles = map[string][]byte{
+	"protocol 0": []byte("(lp0\n(Vservers.web1.cpu.load\np1\n(I1700000000\nF0.5\ntp2\ntp3\na(Vservers.web1.mem\np4\n(F1700000000.5\nV42\np5\ntp6\ntp7\na."),
+	"protocol 2": []byte("\x80\x02]q\x00(X\x15\x00\x00\x00servers.web1.cpu.loadq\x01J\x00\xf1SeG?\xe0\x00\x00\x00\x00\x00\x00\x86q\x02\x86q\x03X\x10\x00\x00\x00servers.web1.memq\x04GA\xd9T\xfc@ \x00\x00X\x02\x00\x00\x0042q\x05\x86q\x06\x86q\x07e."),
+	"protocol 4": mustHex("80049554000000000000005d94288c15736572766572732e776562312e6370752e6c6f6164944a00f15365473fe0000000000000869486948c10736572766572732e776562312e6d656d944741d954fc402000008c0234329486948694652e"),
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// frame добавляет к сообщению pickle заголовок длины.
+func frame(payload []byte) []byte {
+	buf := make([]byte, 4, 4+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	return append(buf, payload...)
+}
+
+func TestParseLine(t *testing.T) {
+	point, err := ParseLine("servers.web1.cpu.load 0.5 1700000000")
+	require.NoError(t, err)
+	assert.Equal(t, Point{Path: "servers.web1.cpu.load", Value: 0.5, Timestamp: time.Unix(1700000000, 0)}, point)
+
+	point, err = ParseLine("servers.web1.cpu.load 1 -1")
+	require.NoError(t, err)
+	assert.True(t, point.Timestamp.IsZero())
+
+	for _, line := range []string{"servers.web1.cpu.load", "servers.web1.cpu.load x 1700000000", "a 1 2 3", "a 1 x"} {
+		_, err = ParseLine(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestMapper(t *testing.T) {
+	mapper, err := NewMapper([]string{
+		"servers.* .host.measurement*",
+		"servers.db.* .role.host.measurement.measurement",
+		"measurement.env.measurement",
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		path   string
+		name   string
+		labels map[string]string
+	}{
+		{path: "servers.web1.cpu.load", name: "cpu.load", labels: map[string]string{"host": "web1"}},
+		// Используется шаблон с самым длинным фильтром
+		{path: "servers.db.pg1.disk.used.sda", name: "disk.used", labels: map[string]string{"role": "db", "host": "pg1"}},
+		{path: "app.prod.requests", name: "app.requests", labels: map[string]string{"env": "prod"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			name, labels, err := mapper.Map(tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.labels, labels)
+		})
+	}
+
+	_, _, err = mapper.Map("servers..cpu")
+	assert.Error(t, err)
+
+	// Без шаблонов путь целиком становится именем метрики
+	name, labels, err := (&Mapper{}).Map("servers.web1.cpu")
+	require.NoError(t, err)
+	assert.Equal(t, "servers.web1.cpu", name)
+	assert.Nil(t, labels)
+
+	for _, rule := range []string{"host.env", "measurement*.host", "a b c"} {
+		_, err = ParseTemplate(rule)
+		assert.Error(t, err, rule)
+	}
+}
+
+func TestReadPickle(t *testing.T) {
+	want := []Point{
+		{Path: "servers.web1.cpu.load", Value: 0.5, Timestamp: time.Unix(1700000000, 0)},
+		{Path: "servers.web1.mem", Value: 42, Timestamp: time.Unix(1700000000, int64(500*time.Millisecond))},
+	}
+
+	for name, payload := range pickles {
+		t.Run(name, func(t *testing.T) {
+			points, err := ReadPickle(bytes.NewReader(frame(payload)))
+			require.NoError(t, err)
+			assert.Equal(t, want, points)
+		})
+	}
+
+	t.Run("unsupported opcode", func(t *testing.T) {
+		// cos\nsystem\n - GLOBAL, создающий произвольный объект
+		_, err := ReadPickle(bytes.NewReader(frame([]byte("cos\nsystem\n(S'ls'\ntR."))))
+		assert.Error(t, err)
+	})
+}
+
+func TestServer(t *testing.T) {
+	store := mem.NewStorage()
+	mapper, err := NewMapper([]string{"servers.* .host.measurement*"})
+	require.NoError(t, err)
+
+	server := NewServer(store, mapper)
+	require.NoError(t, server.Listen("127.0.0.1:0", "127.0.0.1:0"))
+	defer server.Close()
+
+	plaintext, err := net.Dial("tcp", server.PlaintextAddr().String())
+	require.NoError(t, err)
+	_, err = plaintext.Write([]byte("servers.web2.cpu.load 1.5 -1\ninvalid\n"))
+	require.NoError(t, err)
+	require.NoError(t, plaintext.Close())
+
+	pickle, err := net.Dial("tcp", server.PickleAddr().String())
+	require.NoError(t, err)
+	_, err = pickle.Write(frame(pickles["protocol 2"]))
+	require.NoError(t, err)
+	require.NoError(t, pickle.Close())
+
+	get := func(host, name string) *metricModel.Metric {
+		m, err := store.Get(metricModel.SeriesKey(name, map[string]string{"host": host}))
+		if err != nil {
+			return nil
+		}
+		return &m
+	}
+
+	// Значения принимаются асинхронно
+	require.Eventually(t, func() bool {
+		return get("web2", "cpu.load") != nil && get("web1", "mem") != nil
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, metricModel.MetricTypeGauge, get("web2", "cpu.load").MType)
+	assert.Equal(t, 1.5, *get("web2", "cpu.load").Value)
+	assert.Equal(t, 0.5, *get("web1", "cpu.load").Value)
+	assert.Equal(t, 42.0, *get("web1", "mem").Value)
+}
+
+func TestServerSave(t *testing.T) {
+	store := mem.NewStorage()
+	mapper, err := NewMapper([]string{"servers.* .host.measurement*"})
+	require.NoError(t, err)
+	server := NewServer(store, mapper)
+
+	// Несколько значений одного ряда в одной пачке сохраняются каждое со своим временем
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, server.save([]Point{
+		{Path: "servers.web1.cpu.load", Value: 2, Timestamp: start.Add(time.Minute)},
+		{Path: "servers.web1.cpu.load", Value: 1, Timestamp: start},
+	}))
+
+	key := metricModel.SeriesKey("cpu.load", map[string]string{"host": "web1"})
+	history, err := store.GetRange(key, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, start, history[0].Timestamp)
+	assert.Equal(t, 1.0, *history[0].Value)
+	assert.Equal(t, 2.0, *history[1].Value)
+
+	// Значение старше последнего значения ряда отбрасывается
+	require.NoError(t, server.save([]Point{{Path: "servers.web1.cpu.load", Value: 3, Timestamp: start.Add(30 * time.Second)}}))
+
+	load, err := store.Get(key)
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, *load.Value)
+}
@@ -0,0 +1,58 @@
+// Package graphite принимает метрики по протоколам Graphite plaintext и pickle через TCP.
+//
+// Путь метрики сопоставляется имени и меткам по шаблонам (см. Template),
+// значения сохраняются в хранилище как gauge со своей меткой времени,
+// а значения без метки времени - со временем приема.
+package graphite
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point - значение метрики Graphite.
+type Point struct {
+	Path  string
+	Value float64
+	// Timestamp - время значения, нулевое, если клиент его не передал.
+	Timestamp time.Time
+}
+
+// ParseLine разбирает строку plaintext протокола вида "path value [timestamp]".
+// Метка времени -1 означает текущее время.
+func ParseLine(line string) (Point, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return Point{}, fmt.Errorf("invalid line %q: expected path value [timestamp]", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("invalid line %q: %w", line, err)
+	}
+
+	point := Point{Path: fields[0], Value: value}
+
+	if len(fields) == 3 {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return Point{}, fmt.Errorf("invalid line %q: invalid timestamp: %w", line, err)
+		}
+		point.Timestamp = unixTime(ts)
+	}
+
+	return point, nil
+}
+
+// unixTime преобразует время Unix в секундах. Отрицательное время означает текущее время.
+func unixTime(ts float64) time.Time {
+	if ts < 0 || math.IsNaN(ts) || math.IsInf(ts, 0) {
+		return time.Time{}
+	}
+
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second)))
+}
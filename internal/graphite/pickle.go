@@ -0,0 +1,441 @@
+package graphite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxPickleSize - максимальный размер одного сообщения pickle.
+const maxPickleSize = 1 << 20
+
+// ReadPickle читает одно сообщение pickle протокола: 4 байта длины в порядке big-endian
+// и список [(path, (timestamp, value)), ...], сериализованный pickle.
+func ReadPickle(r io.Reader) ([]Point, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+
+	if size > maxPickleSize {
+		return nil, fmt.Errorf("pickle message is too large: %d bytes", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	value, err := unpickle(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := value.([]any)
+	if !ok {
+		return nil, errors.New("pickle message is not a list")
+	}
+
+	points := make([]Point, 0, len(list))
+	for _, item := range list {
+		point, err := pickledPoint(item)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// pickledPoint преобразует элемент (path, (timestamp, value)) в значение метрики.
+func pickledPoint(item any) (Point, error) {
+	pair, ok := item.([]any)
+	if !ok || len(pair) != 2 {
+		return Point{}, errors.New("pickle item is not a (path, (timestamp, value)) tuple")
+	}
+
+	path, ok := pair[0].(string)
+	if !ok {
+		return Point{}, errors.New("pickle item path is not a string")
+	}
+
+	datapoint, ok := pair[1].([]any)
+	if !ok || len(datapoint) != 2 {
+		return Point{}, fmt.Errorf("pickle item %s is not a (timestamp, value) tuple", path)
+	}
+
+	ts, err := pickledNumber(datapoint[0])
+	if err != nil {
+		return Point{}, fmt.Errorf("invalid timestamp of %s: %w", path, err)
+	}
+
+	value, err := pickledNumber(datapoint[1])
+	if err != nil {
+		return Point{}, fmt.Errorf("invalid value of %s: %w", path, err)
+	}
+
+	return Point{Path: path, Value: value, Timestamp: unixTime(ts)}, nil
+}
+
+func pickledNumber(v any) (float64, error) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case string:
+		return strconv.ParseFloat(n, 64)
+	default:
+		return 0, fmt.Errorf("unexpected type %T", v)
+	}
+}
+
+// mark - маркер начала последовательности на стеке.
+type mark struct{}
+
+// list - изменяемый список, на который могут ссылаться несколько элементов стека и memo.
+type list struct {
+	items []any
+}
+
+// unpickle разбирает данные pickle протоколов 0-4, содержащие только списки, кортежи,
+// строки, числа, None и булевы значения. Кортежи возвращаются как []any.
+// Опкоды, создающие произвольные объекты, не поддерживаются, поэтому разбор безопасен.
+func unpickle(data []byte) (any, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	var stack []any
+	memo := make(map[int]any)
+
+	pop := func() (any, error) {
+		if len(stack) == 0 {
+			return nil, errors.New("pickle stack underflow")
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v, nil
+	}
+
+	popMark := func() ([]any, error) {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if _, ok := stack[i].(mark); ok {
+				items := append([]any{}, stack[i+1:]...)
+				stack = stack[:i]
+				return items, nil
+			}
+		}
+		return nil, errors.New("pickle mark not found")
+	}
+
+	readN := func(n int) ([]byte, error) {
+		if n < 0 || n > len(data) {
+			return nil, errors.New("invalid pickle length")
+		}
+		buf := make([]byte, n)
+		_, err := io.ReadFull(r, buf)
+		return buf, err
+	}
+
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		return strings.TrimSuffix(line, "\n"), err
+	}
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("unexpected end of pickle: %w", err)
+		}
+
+		switch op {
+		case 0x80: // PROTO
+			if _, err := r.ReadByte(); err != nil {
+				return nil, err
+			}
+		case 0x95: // FRAME
+			if _, err := readN(8); err != nil {
+				return nil, err
+			}
+		case '.': // STOP
+			v, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			return plain(v), nil
+		case '(': // MARK
+			stack = append(stack, mark{})
+		case ']': // EMPTY_LIST
+			stack = append(stack, &list{})
+		case ')': // EMPTY_TUPLE
+			stack = append(stack, []any{})
+		case 'l': // LIST
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, &list{items: items})
+		case 't': // TUPLE
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, items)
+		case 0x85, 0x86, 0x87: // TUPLE1, TUPLE2, TUPLE3
+			n := int(op-0x85) + 1
+			if len(stack) < n {
+				return nil, errors.New("pickle stack underflow")
+			}
+			items := append([]any{}, stack[len(stack)-n:]...)
+			stack = append(stack[:len(stack)-n], items)
+		case 'a': // APPEND
+			item, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			if err := appendTo(stack, item); err != nil {
+				return nil, err
+			}
+		case 'e': // APPENDS
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			}
+			if err := appendTo(stack, items...); err != nil {
+				return nil, err
+			}
+		case 'N': // NONE
+			stack = append(stack, nil)
+		case 0x88, 0x89: // NEWTRUE, NEWFALSE
+			stack = append(stack, op == 0x88)
+		case 'J': // BININT
+			b, err := readN(4)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(int32(binary.LittleEndian.Uint32(b))))
+		case 'K': // BININT1
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(b))
+		case 'M': // BININT2
+			b, err := readN(2)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(binary.LittleEndian.Uint16(b)))
+		case 0x8a: // LONG1
+			n, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if n > 8 {
+				return nil, errors.New("pickle integer is too large")
+			}
+			b, err := readN(int(n))
+			if err != nil {
+				return nil, err
+			}
+			var v int64
+			for i := len(b) - 1; i >= 0; i-- {
+				v = v<<8 | int64(b[i])
+			}
+			// Знаковое расширение отрицательных чисел
+			if n > 0 && n < 8 && b[n-1]&0x80 != 0 {
+				v -= 1 << (8 * uint(n))
+			}
+			stack = append(stack, v)
+		case 'I', 'L': // INT, LONG
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			line = strings.TrimSuffix(line, "L")
+			switch line {
+			case "00":
+				stack = append(stack, false)
+			case "01":
+				stack = append(stack, true)
+			default:
+				v, err := strconv.ParseInt(line, 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				stack = append(stack, v)
+			}
+		case 'F': // FLOAT
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			v, err := strconv.ParseFloat(line, 64)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, v)
+		case 'G': // BINFLOAT
+			b, err := readN(8)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, math.Float64frombits(binary.BigEndian.Uint64(b)))
+		case 'S', 'V': // STRING, UNICODE
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			if op == 'S' {
+				if line, err = unquote(line); err != nil {
+					return nil, err
+				}
+			}
+			stack = append(stack, line)
+		case 'U', 0x8c: // SHORT_BINSTRING, SHORT_BINUNICODE
+			n, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			b, err := readN(int(n))
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, string(b))
+		case 'T', 'X': // BINSTRING, BINUNICODE
+			b, err := readN(4)
+			if err != nil {
+				return nil, err
+			}
+			s, err := readN(int(binary.LittleEndian.Uint32(b)))
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, string(s))
+		case 'p': // PUT
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			idx, err := strconv.Atoi(line)
+			if err != nil {
+				return nil, err
+			}
+			if err := put(memo, stack, idx); err != nil {
+				return nil, err
+			}
+		case 'q': // BINPUT
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if err := put(memo, stack, int(b)); err != nil {
+				return nil, err
+			}
+		case 'r': // LONG_BINPUT
+			b, err := readN(4)
+			if err != nil {
+				return nil, err
+			}
+			if err := put(memo, stack, int(binary.LittleEndian.Uint32(b))); err != nil {
+				return nil, err
+			}
+		case 0x94: // MEMOIZE
+			if err := put(memo, stack, len(memo)); err != nil {
+				return nil, err
+			}
+		case 'g', 'h', 'j': // GET, BINGET, LONG_BINGET
+			var idx int
+			switch op {
+			case 'g':
+				line, err := readLine()
+				if err != nil {
+					return nil, err
+				}
+				if idx, err = strconv.Atoi(line); err != nil {
+					return nil, err
+				}
+			case 'h':
+				b, err := r.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				idx = int(b)
+			default:
+				b, err := readN(4)
+				if err != nil {
+					return nil, err
+				}
+				idx = int(binary.LittleEndian.Uint32(b))
+			}
+			v, ok := memo[idx]
+			if !ok {
+				return nil, fmt.Errorf("pickle memo %d not found", idx)
+			}
+			stack = append(stack, v)
+		default:
+			return nil, fmt.Errorf("unsupported pickle opcode 0x%02x", op)
+		}
+	}
+}
+
+// appendTo добавляет элементы в список на вершине стека.
+func appendTo(stack []any, items ...any) error {
+	if len(stack) == 0 {
+		return errors.New("pickle stack underflow")
+	}
+
+	l, ok := stack[len(stack)-1].(*list)
+	if !ok {
+		return errors.New("pickle append target is not a list")
+	}
+
+	l.items = append(l.items, items...)
+	return nil
+}
+
+// put сохраняет вершину стека в memo под индексом idx.
+func put(memo map[int]any, stack []any, idx int) error {
+	if len(stack) == 0 {
+		return errors.New("pickle stack underflow")
+	}
+
+	memo[idx] = stack[len(stack)-1]
+	return nil
+}
+
+// plain заменяет списки на срезы элементов.
+func plain(v any) any {
+	switch t := v.(type) {
+	case *list:
+		return plain(t.items)
+	case []any:
+		result := make([]any, len(t))
+		for i, item := range t {
+			result[i] = plain(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// unquote разбирает строку в кавычках в формате repr языка Python.
+func unquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != s[len(s)-1] || (s[0] != '\'' && s[0] != '"') {
+		return "", fmt.Errorf("invalid pickle string %q", s)
+	}
+
+	if s[0] == '"' {
+		return strconv.Unquote(s)
+	}
+
+	inner := strings.ReplaceAll(s[1:len(s)-1], `\'`, `'`)
+	inner = strings.ReplaceAll(inner, `"`, `\"`)
+	return strconv.Unquote(`"` + inner + `"`)
+}
@@ -0,0 +1,234 @@
+package graphite
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxLineSize - максимальная длина строки plaintext протокола.
+const maxLineSize = 64 * 1024
+
+// Server принимает метрики Graphite и сохраняет их в хранилище как gauge.
+type Server struct {
+	store  storage.StorageInterface
+	mapper *Mapper
+
+	plaintext net.Listener
+	pickle    net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewServer создает сервер, который сохраняет метрики в store, сопоставляя пути по mapper.
+func NewServer(store storage.StorageInterface, mapper *Mapper) *Server {
+	return &Server{
+		store:  store,
+		mapper: mapper,
+		conns:  make(map[net.Conn]struct{}),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Listen начинает прием plaintext протокола на адресе plaintextAddr и pickle протокола на адресе pickleAddr.
+// Пустой адрес отключает соответствующий протокол.
+func (s *Server) Listen(plaintextAddr, pickleAddr string) error {
+	if plaintextAddr != "" {
+		l, err := net.Listen("tcp", plaintextAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen graphite plaintext: %w", err)
+		}
+		s.plaintext = l
+	}
+
+	if pickleAddr != "" {
+		l, err := net.Listen("tcp", pickleAddr)
+		if err != nil {
+			if s.plaintext != nil {
+				s.plaintext.Close()
+			}
+			return fmt.Errorf("failed to listen graphite pickle: %w", err)
+		}
+		s.pickle = l
+	}
+
+	if s.plaintext != nil {
+		s.wg.Add(1)
+		go s.serve(s.plaintext, s.servePlaintext)
+	}
+
+	if s.pickle != nil {
+		s.wg.Add(1)
+		go s.serve(s.pickle, s.servePickle)
+	}
+
+	return nil
+}
+
+// PlaintextAddr возвращает адрес приема plaintext протокола или nil, если прием отключен.
+func (s *Server) PlaintextAddr() net.Addr {
+	if s.plaintext == nil {
+		return nil
+	}
+	return s.plaintext.Addr()
+}
+
+// PickleAddr возвращает адрес приема pickle протокола или nil, если прием отключен.
+func (s *Server) PickleAddr() net.Addr {
+	if s.pickle == nil {
+		return nil
+	}
+	return s.pickle.Addr()
+}
+
+// Close прекращает прием метрик и закрывает открытые соединения.
+func (s *Server) Close() error {
+	close(s.stop)
+
+	if s.plaintext != nil {
+		s.plaintext.Close()
+	}
+
+	if s.pickle != nil {
+		s.pickle.Close()
+	}
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// serve принимает соединения listener и обрабатывает каждое функцией handle.
+func (s *Server) serve(listener net.Listener, handle func(net.Conn)) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Errorf("Failed to accept graphite connection: %v", err)
+			continue
+		}
+
+		// Соединение, принятое во время остановки, закрывается сразу, иначе Close не дождется его завершения
+		s.mu.Lock()
+		select {
+		case <-s.stop:
+			s.mu.Unlock()
+			conn.Close()
+			continue
+		default:
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+
+			handle(conn)
+		}()
+	}
+}
+
+func (s *Server) servePlaintext(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+
+		point, err := ParseLine(scanner.Text())
+		if err != nil {
+			log.Debugf("Invalid graphite line: %v", err)
+			continue
+		}
+
+		if err := s.save([]Point{point}); err != nil {
+			log.Errorf("Failed to save graphite metrics: %v", err)
+		}
+	}
+}
+
+func (s *Server) servePickle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+
+	for {
+		points, err := ReadPickle(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Debugf("Invalid graphite pickle message: %v", err)
+			}
+			return
+		}
+
+		if err := s.save(points); err != nil {
+			log.Errorf("Failed to save graphite metrics: %v", err)
+		}
+	}
+}
+
+// save сохраняет значения как gauge, каждое со своей меткой времени, в порядке времени.
+// Значения с некорректным путем пропускаются, значения старше последнего значения ряда отбрасываются.
+func (s *Server) save(points []Point) error {
+	metrics := make([]metricModel.Metric, 0, len(points))
+
+	for _, point := range points {
+		name, labels, err := s.mapper.Map(point.Path)
+		if err != nil {
+			log.Debugf("Invalid graphite path: %v", err)
+			continue
+		}
+
+		value := point.Value
+		m := metricModel.Metric{ID: name, MType: metricModel.MetricTypeGauge, Value: &value, Labels: labels}
+		if !point.Timestamp.IsZero() {
+			ts := point.Timestamp
+			m.Timestamp = &ts
+		}
+		metrics = append(metrics, m)
+	}
+
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	metricModel.SortByTimestamp(metrics)
+
+	written, err := s.store.Append(metrics)
+	if err != nil {
+		return err
+	}
+
+	if dropped := len(metrics) - len(written); dropped > 0 {
+		log.Warnf("Dropped %d graphite values older than the last values of their series", dropped)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// partMeasurement - часть пути, которая входит в имя метрики.
+	partMeasurement = "measurement"
+	// partMeasurementRest - эта и все оставшиеся части пути входят в имя метрики.
+	partMeasurementRest = "measurement*"
+)
+
+// Template - правило разбора пути Graphite на имя метрики и метки.
+//
+// Правило задается строкой "[фильтр] шаблон". Фильтр - путь, в котором * совпадает с любой частью,
+// он должен совпадать с началом пути. Шаблон - части, разделенные точкой:
+// measurement добавляет часть пути в имя метрики, measurement* - эту и все оставшиеся части,
+// пустая часть пропускается, любое другое слово становится именем метки со значением части пути.
+// Например, правило "servers.* .host.measurement*" превращает servers.web1.cpu.load
+// в метрику cpu.load с меткой host=web1.
+type Template struct {
+	filter []string
+	parts  []string
+}
+
+// ParseTemplate разбирает правило шаблона.
+func ParseTemplate(rule string) (Template, error) {
+	fields := strings.Fields(rule)
+
+	var t Template
+	switch len(fields) {
+	case 1:
+		t.parts = strings.Split(fields[0], ".")
+	case 2:
+		t.filter = strings.Split(fields[0], ".")
+		t.parts = strings.Split(fields[1], ".")
+	default:
+		return Template{}, fmt.Errorf("invalid template %q: expected [filter] template", rule)
+	}
+
+	hasMeasurement := false
+	for i, part := range t.parts {
+		switch part {
+		case partMeasurement:
+			hasMeasurement = true
+		case partMeasurementRest:
+			if i != len(t.parts)-1 {
+				return Template{}, fmt.Errorf("invalid template %q: %s must be the last part", rule, partMeasurementRest)
+			}
+			hasMeasurement = true
+		}
+	}
+
+	if !hasMeasurement {
+		return Template{}, fmt.Errorf("invalid template %q: no %s part", rule, partMeasurement)
+	}
+
+	return t, nil
+}
+
+// matches проверяет, что фильтр шаблона совпадает с началом пути.
+func (t Template) matches(segments []string) bool {
+	if len(t.filter) > len(segments) {
+		return false
+	}
+
+	for i, f := range t.filter {
+		if f != "*" && f != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// apply разбирает части пути по шаблону.
+// Части пути за пределами шаблона пропускаются.
+func (t Template) apply(segments []string) (string, map[string]string, error) {
+	var name []string
+	var labels map[string]string
+
+	for i, part := range t.parts {
+		if i >= len(segments) {
+			break
+		}
+
+		switch part {
+		case partMeasurement:
+			name = append(name, segments[i])
+		case partMeasurementRest:
+			name = append(name, segments[i:]...)
+		case "":
+		default:
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[part] = segments[i]
+		}
+	}
+
+	if len(name) == 0 {
+		return "", nil, errors.New("path is too short for template")
+	}
+
+	return strings.Join(name, "."), labels, nil
+}
+
+// Mapper сопоставляет пути Graphite именам метрик и меткам по набору шаблонов.
+type Mapper struct {
+	templates []Template
+}
+
+// NewMapper создает сопоставление по правилам rules.
+func NewMapper(rules []string) (*Mapper, error) {
+	m := &Mapper{}
+
+	for _, rule := range rules {
+		t, err := ParseTemplate(rule)
+		if err != nil {
+			return nil, err
+		}
+		m.templates = append(m.templates, t)
+	}
+
+	return m, nil
+}
+
+// Map возвращает имя метрики и метки для пути path.
+// Используется шаблон с самым длинным совпавшим фильтром. Если ни один шаблон не подходит,
+// путь целиком становится именем метрики.
+func (m *Mapper) Map(path string) (string, map[string]string, error) {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return "", nil, fmt.Errorf("invalid path %q: empty part", path)
+		}
+	}
+
+	var best *Template
+	for i := range m.templates {
+		t := &m.templates[i]
+		if t.matches(segments) && (best == nil || len(t.filter) > len(best.filter)) {
+			best = t
+		}
+	}
+
+	if best == nil {
+		return path, nil, nil
+	}
+
+	name, labels, err := best.apply(segments)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid path %q: %w", path, err)
+	}
+
+	return name, labels, nil
+}
@@ -0,0 +1,62 @@
+package metric
+
+import (
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	pbBase "github.com/dip96/metrics/protobuf/protos/metric/base"
+)
+
+// histogramFromProto преобразует гистограмму из формата protobuf в модель.
+func histogramFromProto(h *pbBase.Histogram) *metricModel.Histogram {
+	if h == nil {
+		return nil
+	}
+
+	histogram := &metricModel.Histogram{Sum: h.Sum, Count: h.Count}
+	for _, b := range h.Buckets {
+		histogram.Buckets = append(histogram.Buckets, metricModel.Bucket{UpperBound: b.UpperBound, Count: b.Count})
+	}
+
+	return histogram
+}
+
+// HistogramToProto преобразует гистограмму модели в формат protobuf.
+func HistogramToProto(h *metricModel.Histogram) *pbBase.Histogram {
+	if h == nil {
+		return nil
+	}
+
+	histogram := &pbBase.Histogram{Sum: h.Sum, Count: h.Count}
+	for _, b := range h.Buckets {
+		histogram.Buckets = append(histogram.Buckets, &pbBase.Bucket{UpperBound: b.UpperBound, Count: b.Count})
+	}
+
+	return histogram
+}
+
+// summaryFromProto преобразует summary из формата protobuf в модель.
+func summaryFromProto(s *pbBase.Summary) *metricModel.Summary {
+	if s == nil {
+		return nil
+	}
+
+	summary := &metricModel.Summary{Sum: s.Sum, Count: s.Count}
+	for _, q := range s.Quantiles {
+		summary.Quantiles = append(summary.Quantiles, metricModel.Quantile{Quantile: q.Quantile, Value: q.Value})
+	}
+
+	return summary
+}
+
+// SummaryToProto преобразует summary модели в формат protobuf.
+func SummaryToProto(s *metricModel.Summary) *pbBase.Summary {
+	if s == nil {
+		return nil
+	}
+
+	summary := &pbBase.Summary{Sum: s.Sum, Count: s.Count}
+	for _, q := range s.Quantiles {
+		summary.Quantiles = append(summary.Quantiles, &pbBase.Quantile{Quantile: q.Quantile, Value: q.Value})
+	}
+
+	return summary
+}
@@ -3,18 +3,29 @@ package metric
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/query"
 	"github.com/dip96/metrics/internal/storage"
 	pbBase "github.com/dip96/metrics/protobuf/protos/metric/base"
 	pbV1 "github.com/dip96/metrics/protobuf/protos/metric/v1"
 	pbV2 "github.com/dip96/metrics/protobuf/protos/metric/v2"
+	pbV3 "github.com/dip96/metrics/protobuf/protos/metric/v3"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"html"
+	"io"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// MetricService реализует gRPC сервисы metrics.v1 и metrics.v2 поверх хранилища метрик.
 type MetricService struct {
 	pbV2.UnimplementedMetricServiceServer
 	storage storage.StorageInterface
@@ -24,9 +35,63 @@ func NewMetricService(storage storage.StorageInterface) *MetricService {
 	return &MetricService{storage: storage}
 }
 
+// metricServiceV1 - обертка для регистрации MetricService как сервиса metrics.v1.
+// Оба сгенерированных Unimplemented типа содержат метод mustEmbedUnimplementedMetricServiceServer,
+// поэтому встроить их в MetricService одновременно нельзя.
+type metricServiceV1 struct {
+	pbV1.UnimplementedMetricServiceServer
+	service *MetricService
+}
+
+func (s *metricServiceV1) AddMetric(ctx context.Context, req *pbV1.AddMetricRequest) (*pbV1.AddMetricResponse, error) {
+	return s.service.AddMetric(ctx, req)
+}
+
+func (s *metricServiceV1) GetMetric(ctx context.Context, req *pbV1.GetMetricRequest) (*pbV1.GetMetricResponse, error) {
+	return s.service.GetMetric(ctx, req)
+}
+
+func (s *metricServiceV1) GetAllMetricsHTML(ctx context.Context, req *pbV1.GetAllMetricsHTMLRequest) (*pbV1.GetAllMetricsHTMLResponse, error) {
+	return s.service.GetAllMetricsHTML(ctx, req)
+}
+
+func (s *metricServiceV1) SendMetricsBatch(ctx context.Context, req *pbV1.SendMetricsBatchRequest) (*pbV1.SendMetricsBatchResponse, error) {
+	return s.service.SendMetricsBatch(ctx, req)
+}
+
+// V1 возвращает реализацию сервиса metrics.v1.
+func (s *MetricService) V1() pbV1.MetricServiceServer {
+	return &metricServiceV1{service: s}
+}
+
+// metricServiceV3 - обертка для регистрации MetricService как сервиса metrics.v3.
+type metricServiceV3 struct {
+	pbV3.UnimplementedMetricServiceServer
+	service *MetricService
+}
+
+func (s *metricServiceV3) StreamMetrics(stream pbV3.MetricService_StreamMetricsServer) error {
+	return s.service.StreamMetrics(stream)
+}
+
+func (s *metricServiceV3) QueryRange(ctx context.Context, req *pbV3.QueryRangeRequest) (*pbV3.QueryRangeResponse, error) {
+	return s.service.QueryRange(ctx, req)
+}
+
+// V3 возвращает реализацию сервиса metrics.v3.
+func (s *MetricService) V3() pbV3.MetricServiceServer {
+	return &metricServiceV3{service: s}
+}
+
+// Register регистрирует сервисы metrics.v1, metrics.v2 и metrics.v3 на gRPC сервере.
+func Register(registrar grpc.ServiceRegistrar, service *MetricService) {
+	pbV1.RegisterMetricServiceServer(registrar, service.V1())
+	pbV2.RegisterMetricServiceServer(registrar, service)
+	pbV3.RegisterMetricServiceServer(registrar, service.V3())
+}
+
 func (s *MetricService) AddMetric(ctx context.Context, req *pbV1.AddMetricRequest) (*pbV1.AddMetricResponse, error) {
-	metric, _ := storage.Storage.Get(req.Name)
-	metric.ID = req.Name
+	metric := metricModel.Metric{ID: req.Name}
 
 	switch req.Type {
 	case pbBase.MetricType_GAUGE:
@@ -38,53 +103,75 @@ func (s *MetricService) AddMetric(ctx context.Context, req *pbV1.AddMetricReques
 		metric.Value = &value
 		metric.FullValueGauge = req.Value
 
+		if err := s.storage.Set(metric); err != nil {
+			return &pbV1.AddMetricResponse{Success: false}, nil
+		}
+
 	case pbBase.MetricType_COUNTER:
 		value, err := strconv.ParseInt(req.Value, 10, 64)
 		if err != nil {
 			return &pbV1.AddMetricResponse{Success: false}, nil
 		}
 		metric.MType = metricModel.MetricTypeCounter
-		if metric.Delta == nil {
-			metric.Delta = &value
-		} else {
-			*metric.Delta += value
+		metric.Delta = &value
+
+		if _, err := s.storage.Increment(metric); err != nil {
+			return &pbV1.AddMetricResponse{Success: false}, nil
 		}
 
 	default:
 		return &pbV1.AddMetricResponse{Success: false}, nil
 	}
 
-	err := storage.Storage.Set(metric)
-	if err != nil {
-		return &pbV1.AddMetricResponse{Success: false}, nil
-	}
-
 	return &pbV1.AddMetricResponse{Success: true}, nil
 }
 
 func (s *MetricService) AddMetricV2(ctx context.Context, req *pbV2.AddMetricV2Request) (*pbV2.AddMetricV2Response, error) {
+	if req.Metric == nil {
+		return nil, status.Error(codes.InvalidArgument, "метрика не передана")
+	}
+
 	metric := metricModel.Metric{
-		ID:    req.Metric.Id,
-		MType: protoMetricTypeToModelMetricType(req.Metric.Type),
+		ID:     req.Metric.Id,
+		MType:  protoMetricTypeToModelMetricType(req.Metric.Type),
+		Labels: req.Metric.Labels,
 	}
 
 	if req.Metric.Type == pbBase.MetricType_GAUGE {
 		metric.Value = &req.Metric.Value
 		metric.FullValueGauge = fmt.Sprintf("%f", req.Metric.Value)
+
+		if err := s.storage.Set(metric); err != nil {
+			return nil, err
+		}
 	} else if req.Metric.Type == pbBase.MetricType_COUNTER {
 		metric.Delta = &req.Metric.Delta
+
+		updated, err := s.storage.Increment(metric)
+		if err != nil {
+			return nil, err
+		}
+		metric = updated
+	} else if req.Metric.Type == pbBase.MetricType_HISTOGRAM || req.Metric.Type == pbBase.MetricType_SUMMARY {
+		metric.Histogram = histogramFromProto(req.Metric.Histogram)
+		metric.Summary = summaryFromProto(req.Metric.Summary)
+		if err := metric.Validate(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		updated, err := s.storage.Increment(metric)
+		if err != nil {
+			return nil, err
+		}
+		metric = updated
 	} else {
 		return nil, fmt.Errorf("invalid metric type")
 	}
 
-	err := s.storage.Set(metric)
-	if err != nil {
-		return nil, err
-	}
-
 	respMetric := &pbBase.Metric{
-		Id:   metric.ID,
-		Type: MetricTypeToProto(metric.MType),
+		Id:     metric.ID,
+		Type:   MetricTypeToProto(metric.MType),
+		Labels: metric.Labels,
 	}
 
 	switch req.Metric.Type {
@@ -92,6 +179,10 @@ func (s *MetricService) AddMetricV2(ctx context.Context, req *pbV2.AddMetricV2Re
 		respMetric.Value = *metric.Value
 	case pbBase.MetricType_COUNTER:
 		respMetric.Delta = *metric.Delta
+	case pbBase.MetricType_HISTOGRAM:
+		respMetric.Histogram = HistogramToProto(metric.Histogram)
+	case pbBase.MetricType_SUMMARY:
+		respMetric.Summary = SummaryToProto(metric.Summary)
 	}
 
 	return &pbV2.AddMetricV2Response{
@@ -100,7 +191,11 @@ func (s *MetricService) AddMetricV2(ctx context.Context, req *pbV2.AddMetricV2Re
 }
 
 func (s *MetricService) GetMetricV2(ctx context.Context, req *pbV2.AddMetricV2Request) (*pbV2.AddMetricV2Response, error) {
-	nameMetric := req.Metric.Id
+	if req.Metric == nil {
+		return nil, status.Error(codes.InvalidArgument, "метрика не передана")
+	}
+
+	nameMetric := metricModel.SeriesKey(req.Metric.Id, req.Metric.Labels)
 	metric, err := s.storage.Get(nameMetric)
 	if err != nil {
 		return nil, status.Errorf(codes.NotFound, "метрика не найдена: %v", err)
@@ -108,22 +203,36 @@ func (s *MetricService) GetMetricV2(ctx context.Context, req *pbV2.AddMetricV2Re
 
 	// Преобразование метрики в формат protobuf
 	pbMetric := &pbBase.Metric{
-		Id:   metric.ID,
-		Type: MetricTypeToProto(metric.MType),
+		Id:     metric.ID,
+		Type:   MetricTypeToProto(metric.MType),
+		Labels: metric.Labels,
+	}
+
+	resp := &pbV2.AddMetricV2Response{
+		Metric: pbMetric,
 	}
 
 	switch metric.MType {
 	case metricModel.MetricTypeCounter:
 		pbMetric.Delta = *metric.Delta
+
+		counter, err := query.Counter(s.storage, nameMetric, time.Now(), query.DefaultRateWindow)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "ошибка расчета скорости счетчика: %v", err)
+		}
+		resp.Rate = counter.Rate
+		resp.Increase = counter.Increase
 	case metricModel.MetricTypeGauge:
 		pbMetric.Value = *metric.Value
+	case metricModel.MetricTypeHistogram:
+		pbMetric.Histogram = HistogramToProto(metric.Histogram)
+	case metricModel.MetricTypeSummary:
+		pbMetric.Summary = SummaryToProto(metric.Summary)
 	default:
 		return nil, status.Errorf(codes.Internal, "неподдерживаемый тип метрики")
 	}
 
-	return &pbV2.AddMetricV2Response{
-		Metric: pbMetric,
-	}, nil
+	return resp, nil
 }
 
 func (s *MetricService) GetMetric(ctx context.Context, req *pbV1.GetMetricRequest) (*pbV1.GetMetricResponse, error) {
@@ -132,6 +241,10 @@ func (s *MetricService) GetMetric(ctx context.Context, req *pbV1.GetMetricReques
 		return nil, status.Errorf(codes.NotFound, "метрика не найдена: %v", err)
 	}
 
+	if metric.MType != protoMetricTypeToModelMetricType(req.Type) {
+		return nil, status.Errorf(codes.NotFound, "метрика %s типа %s не найдена", req.Name, protoMetricTypeToModelMetricType(req.Type))
+	}
+
 	value, err := metric.GetValueForDisplay()
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "ошибка получения значения метрики: %v", err)
@@ -148,15 +261,22 @@ func (s *MetricService) GetAllMetricsHTML(ctx context.Context, req *pbV1.GetAllM
 		return nil, status.Errorf(codes.Internal, "ошибка при получении метрик: %v", err)
 	}
 
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	var buf bytes.Buffer
 	buf.WriteString("<html><body><ul>")
 
-	for name, metric := range metrics {
+	for _, name := range names {
+		metric := metrics[name]
 		value, err := metric.GetValue()
 		if err != nil {
 			value = "Not found"
 		}
-		buf.WriteString(fmt.Sprintf("<li>%s: %v</li>", name, value))
+		buf.WriteString(fmt.Sprintf("<li>%s: %v</li>", html.EscapeString(name), html.EscapeString(value)))
 	}
 
 	buf.WriteString("</ul></body></html>")
@@ -166,39 +286,185 @@ func (s *MetricService) GetAllMetricsHTML(ctx context.Context, req *pbV1.GetAllM
 	}, nil
 }
 
+// SendMetricsBatch сохраняет пачку метрик. Сначала проверяются все метрики пачки,
+// поэтому пачка с некорректной метрикой не сохраняется частично.
 func (s *MetricService) SendMetricsBatch(ctx context.Context, req *pbV1.SendMetricsBatchRequest) (*pbV1.SendMetricsBatchResponse, error) {
-	for _, pbMetric := range req.Metrics {
+	if err := s.saveBatch(req.Metrics); err != nil {
+		return &pbV1.SendMetricsBatchResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pbV1.SendMetricsBatchResponse{
+		Success: true,
+		Message: fmt.Sprintf("Successfully processed %d metrics", len(req.Metrics)),
+	}, nil
+}
+
+// StreamMetrics принимает пачки метрик по одному долгоживущему потоку.
+// Каждая пачка сохраняется и подтверждается отдельным сообщением с тем же sequence.
+// Ошибка сохранения пачки не закрывает поток, а возвращается в подтверждении.
+func (s *MetricService) StreamMetrics(stream pbV3.MetricService_StreamMetricsServer) error {
+	for {
+		batch, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := &pbV3.BatchAck{
+			Sequence: batch.Sequence,
+			Success:  true,
+			Message:  fmt.Sprintf("Successfully processed %d metrics", len(batch.Metrics)),
+		}
+
+		if err := s.saveBatch(batch.Metrics); err != nil {
+			ack.Success = false
+			ack.Message = err.Error()
+		}
+
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// QueryRange возвращает историю значений рядов метрики за период с шагом и агрегацией.
+func (s *MetricService) QueryRange(ctx context.Context, req *pbV3.QueryRangeRequest) (*pbV3.QueryRangeResponse, error) {
+	queryReq, err := queryRequestFromProto(req)
+	if err == nil {
+		err = queryReq.Validate()
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	series, err := query.Execute(s.storage, queryReq)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ошибка выполнения запроса: %v", err)
+	}
+
+	resp := &pbV3.QueryRangeResponse{Series: make([]*pbV3.Series, len(series))}
+	for i, sr := range series {
+		pbSeries := &pbV3.Series{
+			Name:   sr.Name,
+			Type:   MetricTypeToProto(sr.Type),
+			Labels: sr.Labels,
+			Points: make([]*pbV3.Point, len(sr.Points)),
+		}
+
+		for j, p := range sr.Points {
+			pbSeries.Points[j] = &pbV3.Point{Timestamp: timestamppb.New(p.Timestamp), Value: p.Value}
+		}
+
+		resp.Series[i] = pbSeries
+	}
+
+	return resp, nil
+}
+
+// queryRequestFromProto преобразует запрос истории из формата protobuf.
+// Не заданные период и шаг заменяются значениями по умолчанию.
+func queryRequestFromProto(req *pbV3.QueryRangeRequest) (query.Request, error) {
+	queryReq := query.Request{
+		Name:        req.Name,
+		End:         time.Now(),
+		Step:        query.DefaultStep,
+		Aggregation: query.Aggregation(strings.ToLower(req.Aggregation.String())),
+	}
+
+	if req.End != nil {
+		queryReq.End = req.End.AsTime()
+	}
+
+	queryReq.Start = queryReq.End.Add(-query.DefaultRange)
+	if req.Start != nil {
+		queryReq.Start = req.Start.AsTime()
+	}
+
+	if req.Step != nil {
+		queryReq.Step = req.Step.AsDuration()
+	}
+
+	for _, pbMatcher := range req.Matchers {
+		var matchType query.MatchType
+		switch pbMatcher.Type {
+		case pbV3.LabelMatcher_EQUAL:
+			matchType = query.MatchEqual
+		case pbV3.LabelMatcher_NOT_EQUAL:
+			matchType = query.MatchNotEqual
+		case pbV3.LabelMatcher_REGEXP:
+			matchType = query.MatchRegexp
+		case pbV3.LabelMatcher_NOT_REGEXP:
+			matchType = query.MatchNotRegexp
+		}
+
+		matcher, err := query.NewMatcher(matchType, pbMatcher.Name, pbMatcher.Value)
+		if err != nil {
+			return query.Request{}, err
+		}
+
+		queryReq.Matchers = append(queryReq.Matchers, matcher)
+	}
+
+	return queryReq, nil
+}
+
+// saveBatch проверяет и сохраняет пачку метрик в хранилище.
+func (s *MetricService) saveBatch(metrics []*pbBase.Metric) error {
+	for _, pbMetric := range metrics {
+		if pbMetric == nil || pbMetric.Id == "" {
+			return errors.New("metric without id in batch")
+		}
+
 		metric := metricModel.Metric{
-			ID:    pbMetric.Id,
-			MType: protoMetricTypeToModelMetricType(pbMetric.Type),
+			ID:        pbMetric.Id,
+			MType:     protoMetricTypeToModelMetricType(pbMetric.Type),
+			Histogram: histogramFromProto(pbMetric.Histogram),
+			Summary:   summaryFromProto(pbMetric.Summary),
+		}
+
+		switch metric.MType {
+		case "":
+			return fmt.Errorf("invalid metric type for metric %s", pbMetric.Id)
+		case metricModel.MetricTypeHistogram, metricModel.MetricTypeSummary:
+			if err := metric.Validate(); err != nil {
+				return fmt.Errorf("invalid metric %s: %w", pbMetric.Id, err)
+			}
 		}
+	}
 
+	for _, pbMetric := range metrics {
+		metric := metricModel.Metric{
+			ID:     pbMetric.Id,
+			MType:  protoMetricTypeToModelMetricType(pbMetric.Type),
+			Labels: pbMetric.Labels,
+		}
+
+		var err error
 		switch pbMetric.Type {
 		case pbBase.MetricType_GAUGE:
 			metric.Value = &pbMetric.Value
 			metric.FullValueGauge = fmt.Sprintf("%f", pbMetric.Value)
+			err = s.storage.Set(metric)
 		case pbBase.MetricType_COUNTER:
 			metric.Delta = &pbMetric.Delta
-		default:
-			return &pbV1.SendMetricsBatchResponse{
-				Success: false,
-				Message: fmt.Sprintf("Invalid metric type for metric %s", pbMetric.Id),
-			}, nil
+			_, err = s.storage.Increment(metric)
+		case pbBase.MetricType_HISTOGRAM, pbBase.MetricType_SUMMARY:
+			metric.Histogram = histogramFromProto(pbMetric.Histogram)
+			metric.Summary = summaryFromProto(pbMetric.Summary)
+			_, err = s.storage.Increment(metric)
 		}
 
-		err := s.storage.Set(metric)
 		if err != nil {
-			return &pbV1.SendMetricsBatchResponse{
-				Success: false,
-				Message: fmt.Sprintf("Failed to set metric %s: %v", pbMetric.Id, err),
-			}, nil
+			return fmt.Errorf("failed to set metric %s: %w", pbMetric.Id, err)
 		}
 	}
 
-	return &pbV1.SendMetricsBatchResponse{
-		Success: true,
-		Message: fmt.Sprintf("Successfully processed %d metrics", len(req.Metrics)),
-	}, nil
+	return nil
 }
 
 func MetricTypeToProto(mType metricModel.MetricType) pbBase.MetricType {
@@ -207,6 +473,10 @@ func MetricTypeToProto(mType metricModel.MetricType) pbBase.MetricType {
 		return pbBase.MetricType_GAUGE
 	case metricModel.MetricTypeCounter:
 		return pbBase.MetricType_COUNTER
+	case metricModel.MetricTypeHistogram:
+		return pbBase.MetricType_HISTOGRAM
+	case metricModel.MetricTypeSummary:
+		return pbBase.MetricType_SUMMARY
 	default:
 		log.Printf("Unknown metric type: %v", mType)
 		return pbBase.MetricType_GAUGE
@@ -219,6 +489,10 @@ func protoMetricTypeToModelMetricType(protoType pbBase.MetricType) metricModel.M
 		return metricModel.MetricTypeGauge
 	case pbBase.MetricType_COUNTER:
 		return metricModel.MetricTypeCounter
+	case pbBase.MetricType_HISTOGRAM:
+		return metricModel.MetricTypeHistogram
+	case pbBase.MetricType_SUMMARY:
+		return metricModel.MetricTypeSummary
 	default:
 		return ""
 	}
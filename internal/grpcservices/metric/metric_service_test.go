@@ -4,17 +4,22 @@ import (
 	"context"
 	metricModel "github.com/dip96/metrics/internal/model/metric"
 	"github.com/dip96/metrics/internal/storage"
+	memStorage "github.com/dip96/metrics/internal/storage/mem"
 	postgresStorage "github.com/dip96/metrics/internal/storage/postgres"
 	pbBase "github.com/dip96/metrics/protobuf/protos/metric/base"
 	pbV1 "github.com/dip96/metrics/protobuf/protos/metric/v1"
 	pbV2 "github.com/dip96/metrics/protobuf/protos/metric/v2"
+	pbV3 "github.com/dip96/metrics/protobuf/protos/metric/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func InitTestDB() (*postgresStorage.DB, error) {
@@ -163,6 +168,36 @@ func TestMetricService_AddMetricV2(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Add Histogram Metric",
+			req: &pbV2.AddMetricV2Request{
+				Metric: &pbBase.Metric{
+					Id:        "test_histogram",
+					Type:      pbBase.MetricType_HISTOGRAM,
+					Histogram: &pbBase.Histogram{Buckets: []*pbBase.Bucket{{UpperBound: 1, Count: 2}}, Sum: 1.5, Count: 3},
+				},
+			},
+			want: &pbV2.AddMetricV2Response{
+				Metric: &pbBase.Metric{
+					Id:        "test_histogram",
+					Type:      pbBase.MetricType_HISTOGRAM,
+					Histogram: &pbBase.Histogram{Buckets: []*pbBase.Bucket{{UpperBound: 1, Count: 2}}, Sum: 1.5, Count: 3},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid Histogram",
+			req: &pbV2.AddMetricV2Request{
+				Metric: &pbBase.Metric{
+					Id:        "invalid_histogram",
+					Type:      pbBase.MetricType_HISTOGRAM,
+					Histogram: &pbBase.Histogram{Buckets: []*pbBase.Bucket{{UpperBound: 1, Count: 5}}, Count: 3},
+				},
+			},
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name: "Invalid Metric Type",
 			req: &pbV2.AddMetricV2Request{
@@ -200,6 +235,9 @@ func TestMetricService_AddMetricV2(t *testing.T) {
 			case pbBase.MetricType_COUNTER:
 				assert.Equal(t, tt.req.Metric.Delta, *metric.Delta)
 				assert.Equal(t, metricModel.MetricTypeCounter, metric.MType)
+			case pbBase.MetricType_HISTOGRAM:
+				assert.Equal(t, tt.req.Metric.Histogram.Count, metric.Histogram.Count)
+				assert.Equal(t, metricModel.MetricTypeHistogram, metric.MType)
 			}
 		})
 	}
@@ -446,3 +484,52 @@ func TestMetricService_GetAllMetricsHTML(t *testing.T) {
 	})
 	db.Clear()
 }
+
+func TestMetricService_QueryRange(t *testing.T) {
+	store := memStorage.NewStorage()
+	service := NewMetricService(store)
+
+	for _, delta := range []int64{2, 3} {
+		_, err := store.Increment(metricModel.Metric{
+			ID:     "test_counter",
+			MType:  metricModel.MetricTypeCounter,
+			Delta:  &delta,
+			Labels: map[string]string{"host": "a"},
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("last value", func(t *testing.T) {
+		resp, err := service.QueryRange(context.Background(), &pbV3.QueryRangeRequest{
+			Name: "test_counter",
+			Matchers: []*pbV3.LabelMatcher{
+				{Type: pbV3.LabelMatcher_REGEXP, Name: "host", Value: "a|b"},
+			},
+			End:         timestamppb.New(time.Now().Add(time.Second)),
+			Step:        durationpb.New(time.Hour),
+			Aggregation: pbV3.Aggregation_LAST,
+		})
+		require.NoError(t, err)
+		require.Len(t, resp.Series, 1)
+
+		series := resp.Series[0]
+		assert.Equal(t, pbBase.MetricType_COUNTER, series.Type)
+		assert.Equal(t, map[string]string{"host": "a"}, series.Labels)
+		require.NotEmpty(t, series.Points)
+		assert.Equal(t, 5.0, series.Points[len(series.Points)-1].Value)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		_, err := service.QueryRange(context.Background(), &pbV3.QueryRangeRequest{
+			Name: "test_counter",
+			Step: durationpb.New(-time.Second),
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		_, err = service.QueryRange(context.Background(), &pbV3.QueryRangeRequest{
+			Name:     "test_counter",
+			Matchers: []*pbV3.LabelMatcher{{Type: pbV3.LabelMatcher_REGEXP, Name: "host", Value: "("}},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
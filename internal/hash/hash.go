@@ -15,7 +15,7 @@ func CalculateHashAgent(b []byte) string {
 	}
 
 	if cfg.Key != "" {
-		calculateHash(b, cfg.Key)
+		return Calculate(b, cfg.Key)
 	}
 
 	return ""
@@ -30,13 +30,14 @@ func CalculateHashServer(b []byte) string {
 	}
 
 	if cfg.Key != "" {
-		return calculateHash(b, cfg.Key)
+		return Calculate(b, cfg.Key)
 	}
 
 	return ""
 }
 
-func calculateHash(b []byte, key string) string {
+// Calculate вычисляет подпись данных b ключом key в формате, который проверяет сервер.
+func Calculate(b []byte, key string) string {
 	// вычисляем хеш SHA256 от тела запроса и ключа
 	hash := sha256.Sum256(append(b, []byte(key)...))
 	return fmt.Sprintf("%x", hash[:])
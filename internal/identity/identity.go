@@ -0,0 +1,31 @@
+// Package identity хранит в контексте запроса идентификатор агента,
+// полученный из клиентского сертификата при mTLS.
+package identity
+
+import (
+	"context"
+	"crypto/tls"
+)
+
+type contextKey struct{}
+
+// NewContext возвращает контекст с идентификатором агента agent.
+func NewContext(ctx context.Context, agent string) context.Context {
+	return context.WithValue(ctx, contextKey{}, agent)
+}
+
+// FromContext возвращает идентификатор агента из контекста.
+func FromContext(ctx context.Context) (string, bool) {
+	agent, ok := ctx.Value(contextKey{}).(string)
+	return agent, ok && agent != ""
+}
+
+// FromTLS возвращает CN проверенного клиентского сертификата.
+// Если сертификат не передан или не проверен, возвращает пустую строку.
+func FromTLS(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
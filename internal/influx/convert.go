@@ -0,0 +1,93 @@
+package influx
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"time"
+
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+)
+
+// Converter преобразует значения line protocol в метрики.
+// Поля сохраняются как gauge, кроме полей, подходящих под шаблоны накопительных счетчиков.
+type Converter struct {
+	counterFields []string
+}
+
+// NewConverter создает преобразование, в котором поля measurement.field, подходящие
+// под шаблоны counterFields (синтаксис path.Match, например net.bytes_*), сохраняются как counter.
+func NewConverter(counterFields []string) (*Converter, error) {
+	for _, pattern := range counterFields {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid counter field pattern %q: %w", pattern, err)
+		}
+	}
+
+	return &Converter{counterFields: counterFields}, nil
+}
+
+// Metrics преобразует значения в метрики measurement_field с метками из тегов.
+// Строковые поля пропускаются, булевы сохраняются как 0 или 1.
+// Счетчики содержат накопленное значение поля, а не приращение.
+// Метрика получает время точки (см. metricModel.Metric.Timestamp), метрики упорядочены по нему,
+// а метрики точек без времени идут последними и записываются со временем записи.
+func (c *Converter) Metrics(points []Point) ([]metricModel.Metric, error) {
+	var metrics []metricModel.Metric
+
+	for _, p := range points {
+		var timestamp *time.Time
+		if !p.Timestamp.IsZero() {
+			ts := p.Timestamp
+			timestamp = &ts
+		}
+
+		for field, raw := range p.Fields {
+			var value float64
+			switch v := raw.(type) {
+			case float64:
+				value = v
+			case int64:
+				value = float64(v)
+			case uint64:
+				value = float64(v)
+			case bool:
+				if v {
+					value = 1
+				}
+			default:
+				continue
+			}
+
+			m := metricModel.Metric{ID: p.Measurement + "_" + field, Labels: metricModel.CopyLabels(p.Tags), Timestamp: timestamp}
+
+			if c.isCounter(p.Measurement, field) {
+				if value < 0 || value >= math.MaxInt64 || math.IsNaN(value) {
+					return nil, fmt.Errorf("invalid counter value %v of %s", value, m.ID)
+				}
+				delta := int64(math.Round(value))
+				m.MType = metricModel.MetricTypeCounter
+				m.Delta = &delta
+			} else {
+				m.MType = metricModel.MetricTypeGauge
+				m.Value = &value
+			}
+
+			metrics = append(metrics, m)
+		}
+	}
+
+	metricModel.SortByTimestamp(metrics)
+
+	return metrics, nil
+}
+
+func (c *Converter) isCounter(measurement, field string) bool {
+	for _, pattern := range c.counterFields {
+		if ok, _ := path.Match(pattern, measurement+"."+field); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,121 @@
+package influx
+
+import (
+	"testing"
+	"time"
+
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Point
+		wantErr bool
+	}{
+		{
+			name: "tags and timestamp",
+			line: "cpu,host=a,region=eu usage=0.5,count=3i,total=7u,up=t 1700000000000000000",
+			want: Point{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": "a", "region": "eu"},
+				Fields:      map[string]any{"usage": 0.5, "count": int64(3), "total": uint64(7), "up": true},
+				Timestamp:   time.Unix(1700000000, 0),
+			},
+		},
+		{
+			name: "escapes and string field",
+			line: `disk\ io,path=C:\ drive,mode\=x=rw used=1,msg="a \"b\", c d"`,
+			want: Point{
+				Measurement: "disk io",
+				Tags:        map[string]string{"path": "C: drive", "mode=x": "rw"},
+				Fields:      map[string]any{"used": 1.0, "msg": `a "b", c d`},
+			},
+		},
+		{name: "missing fields", line: "cpu,host=a", wantErr: true},
+		{name: "invalid tag", line: "cpu,host usage=1", wantErr: true},
+		{name: "invalid field", line: "cpu usage=abc", wantErr: true},
+		{name: "unterminated string", line: `cpu msg="abc`, wantErr: true},
+		{name: "invalid timestamp", line: "cpu usage=1 abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line, time.Nanosecond)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	precision, err := ParsePrecision("s")
+	require.NoError(t, err)
+
+	points, err := Parse("# comment\n\ncpu usage=1 1700000000\nmem used=2i\n", precision)
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	assert.Equal(t, time.Unix(1700000000, 0), points[0].Timestamp)
+	assert.True(t, points[1].Timestamp.IsZero())
+
+	// Время в секундах, которое не помещается в наносекунды int64, отклоняется
+	_, err = Parse("cpu usage=1 10000000000\n", precision)
+	assert.ErrorContains(t, err, "out of range")
+
+	_, err = Parse("cpu usage=1\ncpu usage=\n", precision)
+	assert.ErrorContains(t, err, "line 2")
+
+	_, err = ParsePrecision("d")
+	assert.Error(t, err)
+}
+
+func TestConverter(t *testing.T) {
+	converter, err := NewConverter([]string{"net.bytes_*"})
+	require.NoError(t, err)
+
+	metrics, err := converter.Metrics([]Point{{
+		Measurement: "net",
+		Tags:        map[string]string{"host": "a"},
+		Fields:      map[string]any{"bytes_recv": int64(10), "drop_in": 0.5, "name": "eth0"},
+	}})
+	require.NoError(t, err)
+
+	byID := make(map[string]metricModel.Metric)
+	for _, m := range metrics {
+		byID[m.ID] = m
+	}
+	require.Len(t, byID, 2)
+
+	assert.Equal(t, metricModel.MetricTypeCounter, byID["net_bytes_recv"].MType)
+	assert.Equal(t, int64(10), *byID["net_bytes_recv"].Delta)
+	assert.Equal(t, metricModel.MetricTypeGauge, byID["net_drop_in"].MType)
+	assert.Equal(t, 0.5, *byID["net_drop_in"].Value)
+	assert.Equal(t, map[string]string{"host": "a"}, byID["net_drop_in"].Labels)
+
+	// Метрики получают время точки и упорядочены по нему, точки без времени идут последними
+	metrics, err = converter.Metrics([]Point{
+		{Measurement: "cpu", Fields: map[string]any{"usage": 3.0}},
+		{Measurement: "cpu", Fields: map[string]any{"usage": 2.0}, Timestamp: time.Unix(1700000010, 0)},
+		{Measurement: "cpu", Fields: map[string]any{"usage": 1.0}, Timestamp: time.Unix(1700000000, 0)},
+	})
+	require.NoError(t, err)
+	require.Len(t, metrics, 3)
+	assert.Equal(t, time.Unix(1700000000, 0), *metrics[0].Timestamp)
+	assert.Equal(t, time.Unix(1700000010, 0), *metrics[1].Timestamp)
+	assert.Nil(t, metrics[2].Timestamp)
+	assert.Equal(t, 3.0, *metrics[2].Value)
+
+	_, err = converter.Metrics([]Point{{Measurement: "net", Fields: map[string]any{"bytes_sent": int64(-1)}}})
+	assert.Error(t, err)
+
+	_, err = NewConverter([]string{"net.["})
+	assert.Error(t, err)
+}
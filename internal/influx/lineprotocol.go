@@ -0,0 +1,197 @@
+// Package influx разбирает метрики в формате InfluxDB line protocol.
+//
+// Строка имеет вид measurement[,tag=value...] field=value[,field=value...] [timestamp].
+// Каждое поле становится отдельной метрикой measurement_field с метками из тегов.
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point - одна строка line protocol.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	// Fields - значения полей: float64, int64, uint64, bool или string.
+	Fields map[string]any
+	// Timestamp - время значения, нулевое, если клиент его не передал.
+	Timestamp time.Time
+}
+
+// ParsePrecision возвращает единицу времени меток по значению параметра precision.
+// Пустое значение означает наносекунды.
+func ParsePrecision(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	default:
+		return 0, fmt.Errorf("unknown precision %q", precision)
+	}
+}
+
+// Parse разбирает строки line protocol. Пустые строки и комментарии (#) пропускаются.
+// Метки времени задаются в единицах precision.
+func Parse(data string, precision time.Duration) ([]Point, error) {
+	var points []Point
+
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		point, err := ParseLine(line, precision)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// ParseLine разбирает одну строку line protocol.
+func ParseLine(line string, precision time.Duration) (Point, error) {
+	key, rest := cut(line, ' ', false)
+	fields, timestamp := cut(rest, ' ', true)
+
+	parts := split(key, ',', false)
+	point := Point{Measurement: unescape(parts[0]), Fields: make(map[string]any)}
+	if point.Measurement == "" {
+		return Point{}, errors.New("missing measurement")
+	}
+
+	for _, tag := range parts[1:] {
+		name, value := cut(tag, '=', false)
+		if name == "" || value == "" {
+			return Point{}, fmt.Errorf("invalid tag %q", tag)
+		}
+		if point.Tags == nil {
+			point.Tags = make(map[string]string)
+		}
+		point.Tags[unescape(name)] = unescape(value)
+	}
+
+	if fields == "" {
+		return Point{}, errors.New("missing fields")
+	}
+
+	for _, field := range split(fields, ',', true) {
+		name, raw := cut(field, '=', false)
+		if name == "" || raw == "" {
+			return Point{}, fmt.Errorf("invalid field %q", field)
+		}
+
+		value, err := parseFieldValue(raw)
+		if err != nil {
+			return Point{}, fmt.Errorf("invalid field %q: %w", field, err)
+		}
+		point.Fields[unescape(name)] = value
+	}
+
+	if timestamp = strings.TrimSpace(timestamp); timestamp != "" {
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return Point{}, fmt.Errorf("invalid timestamp %q", timestamp)
+		}
+
+		// Время в наносекундах должно помещаться в int64
+		if ts > math.MaxInt64/int64(precision) || ts < math.MinInt64/int64(precision) {
+			return Point{}, fmt.Errorf("timestamp %q is out of range", timestamp)
+		}
+		point.Timestamp = time.Unix(0, ts*int64(precision))
+	}
+
+	return point, nil
+}
+
+// parseFieldValue разбирает значение поля: строку в кавычках, целое (i), беззнаковое (u),
+// булево или число с плавающей точкой.
+func parseFieldValue(raw string) (any, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		if len(raw) < 2 || !strings.HasSuffix(raw, `"`) {
+			return nil, errors.New("unterminated string")
+		}
+		return unescapeString(raw[1 : len(raw)-1]), nil
+	case strings.HasSuffix(raw, "i"):
+		return strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+	case strings.HasSuffix(raw, "u"):
+		return strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+	}
+
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+
+	return strconv.ParseFloat(raw, 64)
+}
+
+// cut делит строку по первому неэкранированному разделителю sep.
+// Если quoted, разделители внутри строк в кавычках не учитываются.
+func cut(s string, sep byte, quoted bool) (string, string) {
+	if i := index(s, sep, quoted); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// split делит строку по всем неэкранированным разделителям sep.
+func split(s string, sep byte, quoted bool) []string {
+	var parts []string
+	for {
+		i := index(s, sep, quoted)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+func index(s string, sep byte, quoted bool) int {
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quoted && s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			return i
+		}
+	}
+	return -1
+}
+
+// unescape убирает экранирование запятых, пробелов и знаков равенства в именах и тегах.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	return strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=").Replace(s)
+}
+
+// unescapeString убирает экранирование кавычек и обратной косой черты в строковом поле.
+func unescapeString(s string) string {
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(s)
+}
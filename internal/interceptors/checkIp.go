@@ -0,0 +1,87 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/dip96/metrics/internal/config"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+)
+
+// CheckIPUnary проверяет, что агент находится в доверенной подсети.
+func CheckIPUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := checkIP(ctx); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// CheckIPStream проверяет, что агент находится в доверенной подсети, при открытии потока.
+func CheckIPStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := checkIP(ss.Context()); err != nil {
+		return err
+	}
+
+	return handler(srv, ss)
+}
+
+// checkIP проверяет IP-адрес агента из метаданных x-real-ip,
+// а если их нет - адрес соединения.
+func checkIP(ctx context.Context) error {
+	cfg, err := config.LoadServer()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	// Если trusted_subnet пуст, пропускаем проверку
+	if cfg.TrustedSubnet == "" {
+		return nil
+	}
+
+	ip := realIP(ctx)
+	if ip == nil {
+		log.Error("Not found agent IP address")
+		return status.Error(codes.PermissionDenied, "agent IP address is not found")
+	}
+
+	// Парсим доверенную подсеть
+	_, trustedIPNet, err := net.ParseCIDR(cfg.TrustedSubnet)
+	if err != nil {
+		log.Error("Invalid trusted subnet configuration")
+		return status.Error(codes.PermissionDenied, "invalid trusted subnet configuration")
+	}
+
+	// Проверяем, входит ли IP-адрес в доверенную подсеть
+	if !trustedIPNet.Contains(ip) {
+		log.Error("Untrusted network")
+		return status.Error(codes.PermissionDenied, "untrusted network")
+	}
+
+	return nil
+}
+
+// realIP возвращает IP-адрес агента.
+func realIP(ctx context.Context) net.IP {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ipStr := metadataValue(md, MetadataRealIP); ipStr != "" {
+			return net.ParseIP(ipStr)
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return nil
+	}
+
+	return net.ParseIP(host)
+}
@@ -0,0 +1,75 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/dip96/metrics/internal/hash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// UnaryClient возвращает клиентский перехватчик агента, который добавляет к унарным вызовам
+// метаданные x-real-ip и подпись hashsha256 ключом key. Пустые значения не передаются.
+func UnaryClient(realIP, key string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = withRealIP(ctx, realIP)
+
+		if key != "" {
+			payload, err := signedPayload(req)
+			if err != nil {
+				return err
+			}
+			ctx = metadata.AppendToOutgoingContext(ctx, MetadataHash, hash.Calculate(payload, key))
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClient возвращает клиентский перехватчик агента, который добавляет при открытии потока
+// метаданные x-real-ip и подпись hashsha256 ключом key, а каждое отправляемое сообщение
+// подписывает в его поле hash. Пустые значения не передаются.
+func StreamClient(realIP, key string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = withRealIP(ctx, realIP)
+
+		if key == "" {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		ctx = metadata.AppendToOutgoingContext(ctx, MetadataHash, hash.Calculate(signedStreamPayload(method), key))
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		return &signingClientStream{ClientStream: stream, key: key}, nil
+	}
+}
+
+// signingClientStream - клиентский поток, подписывающий каждое отправляемое сообщение.
+type signingClientStream struct {
+	grpc.ClientStream
+	key string
+}
+
+// SendMsg записывает подпись в поле hash сообщения m и отправляет его.
+func (s *signingClientStream) SendMsg(m any) error {
+	payload, field, err := signedStreamMessage(m)
+	if err != nil {
+		return err
+	}
+
+	m.(proto.Message).ProtoReflect().Set(field, protoreflect.ValueOfString(hash.Calculate(payload, s.key)))
+
+	return s.ClientStream.SendMsg(m)
+}
+
+func withRealIP(ctx context.Context, realIP string) context.Context {
+	if realIP == "" {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, MetadataRealIP, realIP)
+}
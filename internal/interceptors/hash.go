@@ -0,0 +1,105 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/dip96/metrics/internal/config"
+	"github.com/dip96/metrics/internal/hash"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// CheckHashUnary проверяет подпись запроса из метаданных hashsha256.
+// Подписывается детерминированно сериализованное сообщение запроса.
+// Методы приемников сторонних форматов не проверяются.
+func CheckHashUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if ingestMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	payload, err := signedPayload(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := checkHash(ctx, payload); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// CheckHashStream проверяет подпись из метаданных hashsha256 при открытии потока
+// и подпись каждого полученного сообщения из его поля hash.
+// Подпись открытия потока покрывает только полное имя метода и одинакова для всех потоков,
+// поэтому целостность пачек обеспечивают подписи сообщений.
+func CheckHashStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := checkHash(ss.Context(), signedStreamPayload(info.FullMethod)); err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadServer()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	// Ключ не задан, проверка отключена
+	if cfg.Key == "" {
+		return handler(srv, ss)
+	}
+
+	return handler(srv, &hashCheckingStream{ServerStream: ss, key: cfg.Key})
+}
+
+// hashCheckingStream - серверный поток, проверяющий подпись каждого полученного сообщения.
+type hashCheckingStream struct {
+	grpc.ServerStream
+	key string
+}
+
+// RecvMsg получает сообщение и проверяет его подпись.
+// При неверной подписи возвращается ошибка Unauthenticated, и обработчик завершает поток.
+func (s *hashCheckingStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	payload, field, err := signedStreamMessage(m)
+	if err != nil {
+		log.Error(err)
+		return status.Error(codes.Unauthenticated, "message is not signed")
+	}
+
+	received := m.(proto.Message).ProtoReflect().Get(field).String()
+	if received != hash.Calculate(payload, s.key) {
+		log.Error("Different message hash")
+		return status.Error(codes.Unauthenticated, "invalid message hash")
+	}
+
+	return nil
+}
+
+// checkHash сравнивает подпись из метаданных с подписью payload ключом сервера.
+func checkHash(ctx context.Context, payload []byte) error {
+	expectedHash := hash.CalculateHashServer(payload)
+
+	// Ключ не задан, проверка отключена
+	if expectedHash == "" {
+		return nil
+	}
+
+	var receivedHash string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		receivedHash = metadataValue(md, MetadataHash)
+	}
+
+	if receivedHash != expectedHash {
+		log.Error("Different hash")
+		return status.Error(codes.Unauthenticated, "invalid hash")
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/dip96/metrics/internal/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// AgentIdentityUnary сохраняет в контексте вызова идентификатор агента -
+// CN клиентского сертификата, проверенного при mTLS.
+func AgentIdentityUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(withAgentIdentity(ctx), req)
+}
+
+// AgentIdentityStream сохраняет в контексте потока идентификатор агента.
+func AgentIdentityStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextStream{ServerStream: ss, ctx: withAgentIdentity(ss.Context())})
+}
+
+// contextStream - поток с подмененным контекстом.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func withAgentIdentity(ctx context.Context) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ctx
+	}
+
+	if agent := identity.FromTLS(&tlsInfo.State); agent != "" {
+		return identity.NewContext(ctx, agent)
+	}
+
+	return ctx
+}
@@ -0,0 +1,22 @@
+package interceptors
+
+import (
+	pbCollector "github.com/dip96/metrics/protobuf/protos/opentelemetry/proto/collector/metrics/v1"
+	"google.golang.org/grpc"
+)
+
+// ingestMethods - методы приемников сторонних форматов. Их клиенты не подписывают запросы ключом агента,
+// поэтому проверка подписи к ним не применяется, как и к маршрутам группы ingest HTTP сервера.
+// Подсеть проверяется по адресу соединения, если клиент не передал x-real-ip.
+var ingestMethods = map[string]bool{
+	pbCollector.MetricsService_Export_FullMethodName: true,
+}
+
+// ServerOptions возвращает перехватчики gRPC сервера в том же порядке, что и HTTP middleware:
+// восстановление после паники, идентификация агента, логирование, проверка подсети и проверка подписи.
+func ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(RecoveryUnary, AgentIdentityUnary, LoggerUnary, CheckIPUnary, CheckHashUnary),
+		grpc.ChainStreamInterceptor(RecoveryStream, AgentIdentityStream, LoggerStream, CheckIPStream, CheckHashStream),
+	}
+}
@@ -0,0 +1,221 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/dip96/metrics/internal/config"
+	grpcMetric "github.com/dip96/metrics/internal/grpcservices/metric"
+	"github.com/dip96/metrics/internal/otlp"
+	memStorage "github.com/dip96/metrics/internal/storage/mem"
+	pbBase "github.com/dip96/metrics/protobuf/protos/metric/base"
+	pbV1 "github.com/dip96/metrics/protobuf/protos/metric/v1"
+	pbV3 "github.com/dip96/metrics/protobuf/protos/metric/v3"
+	pbCollector "github.com/dip96/metrics/protobuf/protos/opentelemetry/proto/collector/metrics/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+)
+
+// dial запускает сервер метрик с перехватчиками поверх bufconn
+// и подключается к нему с клиентскими перехватчиками агента.
+// Перехватчики streams выполняются после перехватчика агента.
+func dial(t *testing.T, realIP, key string, streams ...grpc.StreamClientInterceptor) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(ServerOptions()...)
+	store := memStorage.NewStorage()
+	grpcMetric.Register(server, grpcMetric.NewMetricService(store))
+	otlp.Register(server, otlp.NewReceiver(store))
+
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(UnaryClient(realIP, key)),
+		grpc.WithChainStreamInterceptor(append([]grpc.StreamClientInterceptor{StreamClient(realIP, key)}, streams...)...),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return conn
+}
+
+// configureServer задает ключ и доверенную подсеть сервера на время теста.
+func configureServer(t *testing.T, key, trustedSubnet string) {
+	t.Helper()
+
+	cfg, err := config.LoadServer()
+	require.NoError(t, err)
+
+	prevKey, prevSubnet := cfg.Key, cfg.TrustedSubnet
+	cfg.Key, cfg.TrustedSubnet = key, trustedSubnet
+	t.Cleanup(func() {
+		cfg.Key, cfg.TrustedSubnet = prevKey, prevSubnet
+	})
+}
+
+func sendBatch(conn *grpc.ClientConn) error {
+	_, err := pbV1.NewMetricServiceClient(conn).SendMetricsBatch(context.Background(), &pbV1.SendMetricsBatchRequest{
+		Metrics: []*pbBase.Metric{
+			{Id: "PollCount", Type: pbBase.MetricType_COUNTER, Delta: 1, Labels: map[string]string{"host": "a", "dc": "b"}},
+		},
+	})
+	return err
+}
+
+func streamBatch(conn *grpc.ClientConn) error {
+	stream, err := pbV3.NewMetricServiceClient(conn).StreamMetrics(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if err := stream.Send(&pbV3.MetricsBatch{Sequence: 1}); err != nil {
+		_, err = stream.Recv()
+		return err
+	}
+
+	_, err = stream.Recv()
+	return err
+}
+
+func TestCheckIP(t *testing.T) {
+	configureServer(t, "", "192.168.1.0/24")
+
+	t.Run("trusted ip", func(t *testing.T) {
+		conn := dial(t, "192.168.1.10", "")
+		assert.NoError(t, sendBatch(conn))
+		assert.NoError(t, streamBatch(conn))
+	})
+
+	t.Run("untrusted ip", func(t *testing.T) {
+		conn := dial(t, "10.0.0.1", "")
+		assert.Equal(t, codes.PermissionDenied, status.Code(sendBatch(conn)))
+		assert.Equal(t, codes.PermissionDenied, status.Code(streamBatch(conn)))
+	})
+
+	t.Run("without ip", func(t *testing.T) {
+		// bufconn не передает адрес агента, а метаданных нет
+		conn := dial(t, "", "")
+		assert.Equal(t, codes.PermissionDenied, status.Code(sendBatch(conn)))
+	})
+}
+
+func TestCheckHash(t *testing.T) {
+	configureServer(t, "secret", "")
+
+	t.Run("valid hash", func(t *testing.T) {
+		conn := dial(t, "", "secret")
+		assert.NoError(t, sendBatch(conn))
+		assert.NoError(t, streamBatch(conn))
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		conn := dial(t, "", "other")
+		assert.Equal(t, codes.Unauthenticated, status.Code(sendBatch(conn)))
+		assert.Equal(t, codes.Unauthenticated, status.Code(streamBatch(conn)))
+	})
+
+	t.Run("without hash", func(t *testing.T) {
+		conn := dial(t, "", "")
+		assert.Equal(t, codes.Unauthenticated, status.Code(sendBatch(conn)))
+	})
+}
+
+// tamperingStream подменяет содержимое пачки после того, как перехватчик агента ее подписал.
+type tamperingStream struct {
+	grpc.ClientStream
+}
+
+func (s *tamperingStream) SendMsg(m any) error {
+	if batch, ok := m.(*pbV3.MetricsBatch); ok {
+		batch.Sequence++
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func tamper(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &tamperingStream{ClientStream: stream}, nil
+}
+
+func TestCheckHashStreamMessages(t *testing.T) {
+	configureServer(t, "secret", "")
+
+	t.Run("signed batches", func(t *testing.T) {
+		stream, err := pbV3.NewMetricServiceClient(dial(t, "", "secret")).StreamMetrics(context.Background())
+		require.NoError(t, err)
+
+		for sequence := uint64(1); sequence <= 3; sequence++ {
+			require.NoError(t, stream.Send(&pbV3.MetricsBatch{Sequence: sequence}))
+			ack, err := stream.Recv()
+			require.NoError(t, err)
+			assert.Equal(t, sequence, ack.GetSequence())
+		}
+	})
+
+	t.Run("tampered batch", func(t *testing.T) {
+		// Подпись открытия потока верна, но пачка изменена после подписи
+		conn := dial(t, "", "secret", tamper)
+		assert.Equal(t, codes.Unauthenticated, status.Code(streamBatch(conn)))
+	})
+}
+
+func TestIngestMethods(t *testing.T) {
+	configureServer(t, "secret", "192.168.1.0/24")
+
+	export := func(conn *grpc.ClientConn) error {
+		_, err := pbCollector.NewMetricsServiceClient(conn).Export(context.Background(), &pbCollector.ExportMetricsServiceRequest{})
+		return err
+	}
+
+	t.Run("trusted ip", func(t *testing.T) {
+		// Клиент OpenTelemetry не подписывает запросы
+		conn := dial(t, "192.168.1.10", "")
+		assert.NoError(t, export(conn))
+
+		// Методы агента на том же сервере по-прежнему требуют подпись
+		assert.Equal(t, codes.Unauthenticated, status.Code(sendBatch(conn)))
+	})
+
+	t.Run("untrusted ip", func(t *testing.T) {
+		conn := dial(t, "10.0.0.1", "")
+		assert.Equal(t, codes.PermissionDenied, status.Code(export(conn)))
+	})
+
+	t.Run("without ip", func(t *testing.T) {
+		// bufconn не передает адрес клиента, а метаданных нет
+		conn := dial(t, "", "")
+		assert.Equal(t, codes.PermissionDenied, status.Code(export(conn)))
+	})
+}
+
+func TestRecovery(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Panic"}
+	_, err := RecoveryUnary(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		panic("boom")
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/test/PanicStream"}
+	err = RecoveryStream(nil, nil, streamInfo, func(srv any, stream grpc.ServerStream) error {
+		panic("boom")
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
@@ -0,0 +1,43 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/dip96/metrics/internal/identity"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// LoggerUnary логирует унарные вызовы: метод, время выполнения и код ответа.
+func LoggerUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+
+	resp, err := handler(ctx, req)
+	logCall(ctx, info.FullMethod, time.Since(start), err)
+
+	return resp, err
+}
+
+// LoggerStream логирует потоковые вызовы: метод, время жизни потока и код завершения.
+func LoggerStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+
+	err := handler(srv, ss)
+	logCall(ss.Context(), info.FullMethod, time.Since(start), err)
+
+	return err
+}
+
+func logCall(ctx context.Context, method string, duration time.Duration, err error) {
+	if err != nil {
+		log.Errorf("Ошибка - %s", err.Error())
+	}
+
+	if agent, ok := identity.FromContext(ctx); ok {
+		log.Printf("Запрос gRPC: %s, агент - %s, время - %s", method, agent, duration)
+	} else {
+		log.Printf("Запрос gRPC: %s, время - %s", method, duration)
+	}
+	log.Printf("Ответ gRPC: статус код - %s", status.Code(err))
+}
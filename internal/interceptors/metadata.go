@@ -0,0 +1,72 @@
+// Package interceptors содержит gRPC перехватчики, повторяющие цепочку HTTP middleware сервера:
+// проверку доверенной подсети, проверку подписи, логирование и восстановление после паники.
+package interceptors
+
+import (
+	"fmt"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// MetadataRealIP - ключ метаданных с IP-адресом агента, аналог заголовка X-Real-IP.
+	MetadataRealIP = "x-real-ip"
+	// MetadataHash - ключ метаданных с подписью запроса, аналог заголовка HashSHA256.
+	MetadataHash = "hashsha256"
+	// messageHashField - имя поля сообщения потока, в котором передается подпись сообщения.
+	messageHashField = "hash"
+)
+
+// metadataValue возвращает первое значение метаданных с ключом key.
+func metadataValue(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// signedPayload возвращает данные, которые подписываются для унарного вызова.
+// Сообщение сериализуется детерминированно, чтобы агент и сервер получили одинаковые байты.
+func signedPayload(req any) ([]byte, error) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("unexpected request type %T", req)
+	}
+
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+// signedStreamPayload возвращает данные, которые подписываются при открытии потока.
+// Метаданные передаются один раз на поток, поэтому подписывается имя метода.
+func signedStreamPayload(fullMethod string) []byte {
+	return []byte(fullMethod)
+}
+
+// signedStreamMessage возвращает данные, которые подписываются для сообщения потока, и поле подписи.
+// Метаданные передаются один раз на поток, поэтому каждое сообщение несет подпись в поле hash,
+// а подписывается детерминированно сериализованное сообщение с пустым полем hash.
+func signedStreamMessage(m any) ([]byte, protoreflect.FieldDescriptor, error) {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected message type %T", m)
+	}
+
+	descriptor := msg.ProtoReflect().Descriptor()
+	field := descriptor.Fields().ByName(messageHashField)
+	if field == nil || field.Kind() != protoreflect.StringKind || field.Cardinality() == protoreflect.Repeated {
+		return nil, nil, fmt.Errorf("message %s has no hash field", descriptor.FullName())
+	}
+
+	unsigned := proto.Clone(msg)
+	unsigned.ProtoReflect().Clear(field)
+
+	payload, err := proto.MarshalOptions{Deterministic: true}.Marshal(unsigned)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payload, field, nil
+}
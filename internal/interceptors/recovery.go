@@ -0,0 +1,37 @@
+package interceptors
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"runtime/debug"
+)
+
+// RecoveryUnary перехватывает панику в обработчике и возвращает клиенту codes.Internal.
+func RecoveryUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recovered(info.FullMethod, r)
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+// RecoveryStream перехватывает панику в потоковом обработчике и возвращает клиенту codes.Internal.
+func RecoveryStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recovered(info.FullMethod, r)
+		}
+	}()
+
+	return handler(srv, ss)
+}
+
+func recovered(method string, r any) error {
+	log.Errorf("Паника в %s: %v\n%s", method, r, debug.Stack())
+	return status.Error(codes.Internal, "internal server error")
+}
@@ -0,0 +1,188 @@
+// Package janitor удаляет из хранилища ряды, которые давно не обновлялись,
+// например метрики выведенных из эксплуатации агентов.
+//
+// Время жизни ряда задается глобально и по префиксам имени метрики.
+// Количество удаленных рядов и отсчетов сохраняется в хранилище в виде счетчиков
+// ExpiredSeries и ExpiredSamples, поэтому видно, сколько данных было освобождено.
+package janitor
+
+import (
+	"github.com/dip96/metrics/internal/config"
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+const (
+	// ExpiredSeriesMetric - счетчик удаленных устаревших рядов.
+	ExpiredSeriesMetric = "ExpiredSeries"
+	// ExpiredSamplesMetric - счетчик удаленных отсчетов истории устаревших рядов.
+	ExpiredSamplesMetric = "ExpiredSamples"
+)
+
+// Rules - правила времени жизни рядов.
+type Rules struct {
+	// TTL - время жизни ряда без обновлений. 0 - ряды не удаляются.
+	TTL time.Duration
+	// Prefixes - время жизни рядов по префиксу имени метрики.
+	// Используется самый длинный подходящий префикс, 0 - ряды с префиксом не удаляются.
+	Prefixes map[string]time.Duration
+}
+
+// NewRules создает правила из конфигурации сервера.
+func NewRules(cfg *config.Server) Rules {
+	rules := Rules{
+		TTL:      time.Duration(cfg.SeriesTTL) * time.Second,
+		Prefixes: make(map[string]time.Duration, len(cfg.SeriesTTLPrefixes)),
+	}
+
+	for prefix, ttl := range cfg.SeriesTTLPrefixes {
+		rules.Prefixes[prefix] = time.Duration(ttl) * time.Second
+	}
+
+	return rules
+}
+
+// Enabled сообщает, может ли по правилам быть удален хотя бы один ряд.
+func (r Rules) Enabled() bool {
+	if r.TTL > 0 {
+		return true
+	}
+
+	for _, ttl := range r.Prefixes {
+		if ttl > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TTLFor возвращает время жизни рядов метрики name.
+func (r Rules) TTLFor(name string) time.Duration {
+	ttl := r.TTL
+	longest := -1
+
+	for prefix, prefixTTL := range r.Prefixes {
+		if len(prefix) > longest && strings.HasPrefix(name, prefix) {
+			ttl = prefixTTL
+			longest = len(prefix)
+		}
+	}
+
+	return ttl
+}
+
+// Result - результат очистки хранилища.
+type Result struct {
+	// Series - количество удаленных рядов.
+	Series int
+	// Samples - количество удаленных отсчетов истории.
+	Samples int
+}
+
+// Expire удаляет из хранилища store ряды, не обновлявшиеся дольше их времени жизни на момент now.
+// Собственные счетчики очистки не удаляются.
+func Expire(store storage.StorageInterface, rules Rules, now time.Time) (Result, error) {
+	updated, err := store.Updated()
+	if err != nil {
+		return Result{}, err
+	}
+
+	stale := make(map[string]time.Time)
+	for key, ts := range updated {
+		name, _, err := metricModel.ParseSeriesKey(key)
+		if err != nil {
+			log.Errorf("Skipping series %s: %v", key, err)
+			continue
+		}
+
+		if name == ExpiredSeriesMetric || name == ExpiredSamplesMetric {
+			continue
+		}
+
+		// Ряд удаляется, только если не был обновлен и после чтения времени обновления
+		ttl := rules.TTLFor(name)
+		if cutoff := now.Add(-ttl); ttl > 0 && ts.Before(cutoff) {
+			stale[key] = cutoff
+		}
+	}
+
+	if len(stale) == 0 {
+		return Result{}, nil
+	}
+
+	deleted, samples, err := store.Delete(stale)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{Series: len(deleted), Samples: samples}, nil
+}
+
+// Janitor периодически удаляет устаревшие ряды из хранилища.
+type Janitor struct {
+	store    storage.StorageInterface
+	rules    Rules
+	interval time.Duration
+}
+
+// NewJanitor создает очистку хранилища store с интервалом проверки interval.
+func NewJanitor(store storage.StorageInterface, rules Rules, interval time.Duration) *Janitor {
+	return &Janitor{
+		store:    store,
+		rules:    rules,
+		interval: interval,
+	}
+}
+
+// Run запускает очистку до закрытия канала stop.
+// Если правила не удаляют ни одного ряда, Run сразу завершается.
+func (j *Janitor) Run(stop <-chan struct{}) {
+	if !j.rules.Enabled() || j.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if _, err := j.RunOnce(now); err != nil {
+				log.Errorf("Failed to expire stale series: %v", err)
+			}
+		}
+	}
+}
+
+// RunOnce выполняет одну очистку на момент now и увеличивает счетчики освобожденных данных.
+func (j *Janitor) RunOnce(now time.Time) (Result, error) {
+	result, err := Expire(j.store, j.rules, now)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if result.Series == 0 {
+		return result, nil
+	}
+
+	log.Printf("Expired %d stale series with %d samples", result.Series, result.Samples)
+
+	for name, delta := range map[string]int64{
+		ExpiredSeriesMetric:  int64(result.Series),
+		ExpiredSamplesMetric: int64(result.Samples),
+	} {
+		value := delta
+		_, err := j.store.Increment(metricModel.Metric{ID: name, MType: metricModel.MetricTypeCounter, Delta: &value})
+		if err != nil {
+			log.Errorf("Failed to update %s: %v", name, err)
+		}
+	}
+
+	return result, nil
+}
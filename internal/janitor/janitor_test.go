@@ -0,0 +1,67 @@
+package janitor
+
+import (
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage/mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRulesTTLFor(t *testing.T) {
+	rules := Rules{
+		TTL: time.Hour,
+		Prefixes: map[string]time.Duration{
+			"Heap":        time.Minute,
+			"HeapObjects": 0,
+		},
+	}
+
+	assert.Equal(t, time.Hour, rules.TTLFor("Alloc"))
+	assert.Equal(t, time.Minute, rules.TTLFor("HeapAlloc"))
+	// Самый длинный префикс отключает удаление
+	assert.Equal(t, time.Duration(0), rules.TTLFor("HeapObjects"))
+
+	assert.True(t, rules.Enabled())
+	assert.False(t, Rules{Prefixes: map[string]time.Duration{"Heap": 0}}.Enabled())
+}
+
+func TestJanitorRunOnce(t *testing.T) {
+	store := mem.NewStorage()
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+
+	value := 1.0
+	stale := metricModel.Metric{ID: "Alloc", MType: metricModel.MetricTypeGauge, Value: &value, Labels: map[string]string{"host": "old"}, UpdatedAt: &old}
+	require.NoError(t, store.Set(stale))
+	require.NoError(t, store.Set(stale))
+	require.NoError(t, store.Set(metricModel.Metric{ID: "Alloc", MType: metricModel.MetricTypeGauge, Value: &value, Labels: map[string]string{"host": "new"}}))
+	require.NoError(t, store.Set(metricModel.Metric{ID: "Kept", MType: metricModel.MetricTypeGauge, Value: &value, UpdatedAt: &old}))
+
+	j := NewJanitor(store, Rules{TTL: time.Hour, Prefixes: map[string]time.Duration{"Kept": 0}}, time.Minute)
+
+	result, err := j.RunOnce(now)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Series: 1, Samples: 2}, result)
+
+	_, err = store.Get(stale.Key())
+	assert.Error(t, err)
+	_, err = store.Get("Kept")
+	assert.NoError(t, err)
+
+	series, err := store.Get(ExpiredSeriesMetric)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *series.Delta)
+
+	samples, err := store.Get(ExpiredSamplesMetric)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *samples.Delta)
+
+	// Собственные счетчики очистки не устаревают
+	result, err = j.RunOnce(now.Add(24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Series)
+	_, err = store.Get(ExpiredSeriesMetric)
+	assert.NoError(t, err)
+}
@@ -31,27 +31,96 @@ func CheckIP(next echo.HandlerFunc) echo.HandlerFunc {
 			return c.HTML(http.StatusForbidden, "")
 		}
 
-		// Парсим IP-адрес
-		ip := net.ParseIP(ipStr)
-		if ip == nil {
-			log.Error("Invalid IP address")
+		if !inSubnet(ipStr, cfg.TrustedSubnet) {
 			return c.HTML(http.StatusForbidden, "")
 		}
 
-		// Парсим доверенную подсеть
-		_, trustedIPNet, err := net.ParseCIDR(cfg.TrustedSubnet)
+		err = next(c)
+		return err
+	}
+}
+
+// CheckIngestIP пропускает к приемникам сторонних форматов только запросы из подсети trusted_subnet.
+// Telegraf, Prometheus и SDK OpenTelemetry не передают X-Real-IP, поэтому без заголовка проверяется адрес соединения.
+func CheckIngestIP(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cfg, err := config.LoadServer()
+
 		if err != nil {
-			log.Error("Invalid trusted subnet configuration")
+			return err
+		}
+
+		// Если trusted_subnet пуст, пропускаем проверку
+		if cfg.TrustedSubnet == "" {
+			return next(c)
+		}
+
+		if !inSubnet(clientIP(c), cfg.TrustedSubnet) {
 			return c.HTML(http.StatusForbidden, "")
 		}
 
-		// Проверяем, входит ли IP-адрес в доверенную подсеть
-		if !trustedIPNet.Contains(ip) {
-			log.Error("Untrusted network")
+		return next(c)
+	}
+}
+
+// CheckMetricsIP пропускает к странице метрик сервера только запросы из подсети metrics_trusted_subnet.
+// Prometheus обращается к серверу напрямую, поэтому без заголовка X-Real-IP проверяется адрес соединения.
+func CheckMetricsIP(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cfg, err := config.LoadServer()
+
+		if err != nil {
+			return err
+		}
+
+		// Если metrics_trusted_subnet пуст, пропускаем проверку
+		if cfg.MetricsTrustedSubnet == "" {
+			return next(c)
+		}
+
+		if !inSubnet(clientIP(c), cfg.MetricsTrustedSubnet) {
 			return c.HTML(http.StatusForbidden, "")
 		}
 
-		err = next(c)
-		return err
+		return next(c)
 	}
 }
+
+// clientIP возвращает адрес клиента из заголовка X-Real-IP, а без него - адрес соединения.
+func clientIP(c echo.Context) string {
+	if ipStr := c.Request().Header.Get("X-Real-IP"); ipStr != "" {
+		return ipStr
+	}
+
+	host, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+	if err != nil {
+		return c.Request().RemoteAddr
+	}
+
+	return host
+}
+
+// inSubnet проверяет, входит ли адрес ipStr в подсеть subnet.
+func inSubnet(ipStr, subnet string) bool {
+	// Парсим IP-адрес
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		log.Error("Invalid IP address")
+		return false
+	}
+
+	// Парсим доверенную подсеть
+	_, trustedIPNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		log.Error("Invalid trusted subnet configuration")
+		return false
+	}
+
+	// Проверяем, входит ли IP-адрес в доверенную подсеть
+	if !trustedIPNet.Contains(ip) {
+		log.Error("Untrusted network")
+		return false
+	}
+
+	return true
+}
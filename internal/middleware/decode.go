@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"github.com/dip96/metrics/internal/asymmetricEncryption/decode"
 	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
 	"io"
+	"net/http"
 	"strings"
 )
 
+// DecodeMiddleware расшифровывает тело запроса, если в Content-Encoding указано encrypted.
+// Поддерживаются сообщения в формате envelope (RSA-OAEP + AES-GCM) и данные,
+// зашифрованные только RSA агентами предыдущих версий.
 func DecodeMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		ce := c.Request().Header.Get("Content-Encoding")
@@ -23,11 +28,12 @@ func DecodeMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		c.Request().Body = io.NopCloser(bytes.NewBuffer(body))
 
 		for i := len(headerEncoding) - 1; i >= 0; i-- {
-			if headerEncoding[i] == "encrypted" {
+			if strings.TrimSpace(headerEncoding[i]) == "encrypted" {
 				// Расшифровываем данные
 				data2, err := decode.DecryptData(body)
 				if err != nil {
-					return err
+					log.Error("Error when decrypting data: ", err)
+					return c.String(http.StatusBadRequest, "")
 				}
 
 				c.Request().Body = io.NopCloser(bytes.NewBuffer(data2))
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dip96/metrics/internal/asymmetricEncryption/envelope"
+	"github.com/dip96/metrics/internal/config"
+	"github.com/dip96/metrics/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeMiddleware(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keyPath := filepath.Join(t.TempDir(), "private.pem")
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}), 0600)
+	require.NoError(t, err)
+
+	cfg, err := config.LoadServer()
+	require.NoError(t, err)
+	cfg.CryptoKey = keyPath
+
+	var received []byte
+	handler := UnzipMiddleware(DecodeMiddleware(func(c echo.Context) error {
+		received, err = io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, "")
+	}))
+
+	t.Run("gzip and envelope", func(t *testing.T) {
+		plaintext := bytes.Repeat([]byte(`{"id":"HeapAlloc","type":"gauge","value":1},`), 100)
+
+		sealed, err := envelope.Seal(&privateKey.PublicKey, plaintext)
+		require.NoError(t, err)
+		body, err := utils.GzipCompress(sealed)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", "gzip, encrypted")
+		rec := httptest.NewRecorder()
+
+		err = handler(echo.New().NewContext(req, rec))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, plaintext, received)
+	})
+
+	t.Run("invalid ciphertext", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader([]byte("not encrypted")))
+		req.Header.Set("Content-Encoding", "encrypted")
+		rec := httptest.NewRecorder()
+
+		err := handler(echo.New().NewContext(req, rec))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/dip96/metrics/internal/identity"
+	"github.com/labstack/echo/v4"
+)
+
+// AgentIdentity сохраняет в контексте запроса идентификатор агента -
+// CN клиентского сертификата, проверенного при mTLS.
+func AgentIdentity(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if agent := identity.FromTLS(c.Request().TLS); agent != "" {
+			c.SetRequest(c.Request().WithContext(identity.NewContext(c.Request().Context(), agent)))
+		}
+
+		return next(c)
+	}
+}
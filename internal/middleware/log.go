@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"github.com/dip96/metrics/internal/identity"
 	"github.com/labstack/echo/v4"
 	log "github.com/sirupsen/logrus"
 	"time"
@@ -17,7 +18,11 @@ func Logger(next echo.HandlerFunc) echo.HandlerFunc {
 		}
 
 		duration := time.Since(start)
-		log.Printf("Запрос: %s %s, время - %s", c.Request().URL.Path, c.Request().Method, duration)
+		if agent, ok := identity.FromContext(c.Request().Context()); ok {
+			log.Printf("Запрос: %s %s, агент - %s, время - %s", c.Request().URL.Path, c.Request().Method, agent, duration)
+		} else {
+			log.Printf("Запрос: %s %s, время - %s", c.Request().URL.Path, c.Request().Method, duration)
+		}
 
 		statusCode := c.Response().Status
 		responseSize := c.Response().Size
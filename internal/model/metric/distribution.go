@@ -0,0 +1,189 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Bucket представляет собой кумулятивный бакет гистограммы.
+type Bucket struct {
+	// UpperBound - верхняя граница бакета.
+	UpperBound float64 `json:"le"`
+	// Count - количество наблюдений со значением не больше UpperBound.
+	Count uint64 `json:"count"`
+}
+
+// Histogram представляет собой значение метрики типа histogram.
+// Бакет +Inf не хранится: его значение всегда равно Count.
+type Histogram struct {
+	// Buckets - бакеты в порядке возрастания верхней границы.
+	Buckets []Bucket `json:"buckets"`
+	// Sum - сумма значений наблюдений.
+	Sum float64 `json:"sum"`
+	// Count - общее количество наблюдений.
+	Count uint64 `json:"count"`
+}
+
+// Validate проверяет, что границы бакетов конечны и возрастают,
+// а количества наблюдений в бакетах не убывают и не превышают Count.
+func (h Histogram) Validate() error {
+	var prev *Bucket
+	for i := range h.Buckets {
+		b := h.Buckets[i]
+
+		if math.IsNaN(b.UpperBound) || math.IsInf(b.UpperBound, 0) {
+			return fmt.Errorf("invalid bucket upper bound %v", b.UpperBound)
+		}
+
+		if prev != nil && b.UpperBound <= prev.UpperBound {
+			return errors.New("bucket upper bounds must be increasing")
+		}
+
+		if prev != nil && b.Count < prev.Count {
+			return errors.New("bucket counts must be cumulative")
+		}
+
+		if b.Count > h.Count {
+			return fmt.Errorf("bucket count %d exceeds histogram count %d", b.Count, h.Count)
+		}
+
+		prev = &h.Buckets[i]
+	}
+
+	return nil
+}
+
+// Merge добавляет к гистограмме наблюдения гистограммы other.
+// Если границы бакетов различаются, результат содержит объединение границ,
+// а для отсутствующей границы берется значение ближайшего меньшего бакета той же гистограммы.
+// Такая оценка не превышает точное количество наблюдений.
+func (h *Histogram) Merge(other Histogram) {
+	bounds := make([]float64, 0, len(h.Buckets)+len(other.Buckets))
+	for _, b := range h.Buckets {
+		bounds = append(bounds, b.UpperBound)
+	}
+	for _, b := range other.Buckets {
+		bounds = append(bounds, b.UpperBound)
+	}
+	sort.Float64s(bounds)
+
+	buckets := make([]Bucket, 0, len(bounds))
+	for i, bound := range bounds {
+		if i > 0 && bound == bounds[i-1] {
+			continue
+		}
+
+		buckets = append(buckets, Bucket{
+			UpperBound: bound,
+			Count:      cumulativeCount(h.Buckets, bound) + cumulativeCount(other.Buckets, bound),
+		})
+	}
+
+	h.Buckets = buckets
+	h.Sum += other.Sum
+	h.Count += other.Count
+}
+
+// cumulativeCount возвращает количество наблюдений со значением не больше bound
+// по значению ближайшего бакета с границей не больше bound.
+func cumulativeCount(buckets []Bucket, bound float64) uint64 {
+	i := sort.Search(len(buckets), func(i int) bool { return buckets[i].UpperBound > bound })
+	if i == 0 {
+		return 0
+	}
+
+	return buckets[i-1].Count
+}
+
+// Quantile представляет собой значение квантиля summary.
+type Quantile struct {
+	// Quantile - уровень квантиля от 0 до 1.
+	Quantile float64 `json:"quantile"`
+	// Value - значение квантиля.
+	Value float64 `json:"value"`
+}
+
+// Summary представляет собой значение метрики типа summary.
+type Summary struct {
+	// Quantiles - квантили, посчитанные клиентом, в порядке возрастания уровня.
+	Quantiles []Quantile `json:"quantiles"`
+	// Sum - сумма значений наблюдений.
+	Sum float64 `json:"sum"`
+	// Count - общее количество наблюдений.
+	Count uint64 `json:"count"`
+}
+
+// Validate проверяет, что уровни квантилей лежат в [0, 1] и возрастают.
+func (s Summary) Validate() error {
+	for i, q := range s.Quantiles {
+		if math.IsNaN(q.Quantile) || q.Quantile < 0 || q.Quantile > 1 {
+			return fmt.Errorf("invalid quantile %v", q.Quantile)
+		}
+
+		if i > 0 && q.Quantile <= s.Quantiles[i-1].Quantile {
+			return errors.New("quantiles must be increasing")
+		}
+	}
+
+	return nil
+}
+
+// Merge добавляет к summary наблюдения summary other.
+// Квантили нельзя объединить, поэтому сохраняются последние переданные квантили.
+func (s *Summary) Merge(other Summary) {
+	s.Quantiles = append([]Quantile(nil), other.Quantiles...)
+	s.Sum += other.Sum
+	s.Count += other.Count
+}
+
+// Copy возвращает копию гистограммы, не разделяющую бакеты с исходной.
+func (h *Histogram) Copy() *Histogram {
+	if h == nil {
+		return nil
+	}
+
+	c := *h
+	c.Buckets = append([]Bucket(nil), h.Buckets...)
+	return &c
+}
+
+// Copy возвращает копию summary, не разделяющую квантили с исходной.
+func (s *Summary) Copy() *Summary {
+	if s == nil {
+		return nil
+	}
+
+	c := *s
+	c.Quantiles = append([]Quantile(nil), s.Quantiles...)
+	return &c
+}
+
+// Validate проверяет, что значение метрики соответствует ее типу.
+func (m Metric) Validate() error {
+	switch m.MType {
+	case MetricTypeGauge:
+		if m.Value == nil {
+			return errors.New("the gauge value is empty")
+		}
+	case MetricTypeCounter:
+		if m.Delta == nil {
+			return errors.New("the counter delta is empty")
+		}
+	case MetricTypeHistogram:
+		if m.Histogram == nil {
+			return errors.New("the histogram is empty")
+		}
+		return m.Histogram.Validate()
+	case MetricTypeSummary:
+		if m.Summary == nil {
+			return errors.New("the summary is empty")
+		}
+		return m.Summary.Validate()
+	default:
+		return errors.New("the metric type is incorrect")
+	}
+
+	return nil
+}
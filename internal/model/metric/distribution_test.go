@@ -0,0 +1,80 @@
+package metric_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dip96/metrics/internal/model/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramMerge(t *testing.T) {
+	t.Run("same buckets", func(t *testing.T) {
+		h := metric.Histogram{Buckets: []metric.Bucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 1, Count: 3}}, Sum: 1.5, Count: 4}
+		h.Merge(metric.Histogram{Buckets: []metric.Bucket{{UpperBound: 0.1, Count: 2}, {UpperBound: 1, Count: 2}}, Sum: 0.1, Count: 2})
+
+		assert.Equal(t, metric.Histogram{Buckets: []metric.Bucket{{UpperBound: 0.1, Count: 3}, {UpperBound: 1, Count: 5}}, Sum: 1.6, Count: 6}, h)
+	})
+
+	t.Run("different buckets", func(t *testing.T) {
+		h := metric.Histogram{Buckets: []metric.Bucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 1, Count: 3}}, Sum: 1.5, Count: 4}
+		h.Merge(metric.Histogram{Buckets: []metric.Bucket{{UpperBound: 0.5, Count: 2}}, Sum: 0.6, Count: 3})
+
+		// Для границы 0.5 первой гистограммы берется бакет 0.1, для границы 0.1 второй - ноль
+		assert.Equal(t, []metric.Bucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 0.5, Count: 3}, {UpperBound: 1, Count: 5}}, h.Buckets)
+		assert.Equal(t, uint64(7), h.Count)
+		assert.NoError(t, h.Validate())
+	})
+
+	t.Run("empty histogram", func(t *testing.T) {
+		var h metric.Histogram
+		other := metric.Histogram{Buckets: []metric.Bucket{{UpperBound: 1, Count: 1}}, Sum: 0.5, Count: 1}
+		h.Merge(other)
+		assert.Equal(t, other, h)
+	})
+}
+
+func TestHistogramValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets []metric.Bucket
+		count   uint64
+		wantErr bool
+	}{
+		{name: "valid", buckets: []metric.Bucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 1, Count: 2}}, count: 3},
+		{name: "decreasing bounds", buckets: []metric.Bucket{{UpperBound: 1, Count: 1}, {UpperBound: 0.1, Count: 2}}, count: 3, wantErr: true},
+		{name: "not cumulative", buckets: []metric.Bucket{{UpperBound: 0.1, Count: 2}, {UpperBound: 1, Count: 1}}, count: 3, wantErr: true},
+		{name: "exceeds count", buckets: []metric.Bucket{{UpperBound: 0.1, Count: 4}}, count: 3, wantErr: true},
+		{name: "infinite bound", buckets: []metric.Bucket{{UpperBound: math.Inf(1), Count: 3}}, count: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := metric.Histogram{Buckets: tt.buckets, Count: tt.count}.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSummaryMerge(t *testing.T) {
+	s := metric.Summary{Quantiles: []metric.Quantile{{Quantile: 0.5, Value: 1}}, Sum: 10, Count: 5}
+	s.Merge(metric.Summary{Quantiles: []metric.Quantile{{Quantile: 0.5, Value: 2}, {Quantile: 0.99, Value: 4}}, Sum: 6, Count: 3})
+
+	assert.Equal(t, metric.Summary{Quantiles: []metric.Quantile{{Quantile: 0.5, Value: 2}, {Quantile: 0.99, Value: 4}}, Sum: 16, Count: 8}, s)
+	assert.NoError(t, s.Validate())
+
+	assert.Error(t, metric.Summary{Quantiles: []metric.Quantile{{Quantile: 1.5}}}.Validate())
+	assert.Error(t, metric.Summary{Quantiles: []metric.Quantile{{Quantile: 0.9}, {Quantile: 0.5}}}.Validate())
+}
+
+func TestMetricValidate(t *testing.T) {
+	assert.NoError(t, metric.Metric{MType: metric.MetricTypeGauge, Value: Float64Ptr(1)}.Validate())
+	assert.Error(t, metric.Metric{MType: metric.MetricTypeCounter}.Validate())
+	assert.Error(t, metric.Metric{MType: metric.MetricTypeHistogram}.Validate())
+	assert.NoError(t, metric.Metric{MType: metric.MetricTypeSummary, Summary: &metric.Summary{}}.Validate())
+	assert.Error(t, metric.Metric{MType: "invalid"}.Validate())
+}
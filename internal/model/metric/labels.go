@@ -0,0 +1,160 @@
+package metric
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Key возвращает идентификатор ряда метрики: имя вместе с набором меток.
+// Для метрики без меток ключ совпадает с ID, если ID не содержит символов \ и {.
+func (m Metric) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// SeriesKey формирует идентификатор ряда в виде name{label1="value1",label2="value2"}.
+// Метки сортируются по имени, поэтому ключ не зависит от порядка их передачи.
+// Служебные символы в имени, именах и значениях меток экранируются обратной косой чертой,
+// поэтому ParseSeriesKey разбирает ключ с любыми именами и метками.
+func SeriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return escapeKeyPart(name, "{")
+	}
+
+	names := make([]string, 0, len(labels))
+	for labelName := range labels {
+		names = append(names, labelName)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(escapeKeyPart(name, "{"))
+	b.WriteByte('{')
+	for i, labelName := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(escapeKeyPart(labelName, `=",{}`))
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(labels[labelName]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// ParseSeriesKey разбирает идентификатор ряда, сформированный SeriesKey, на имя и метки.
+func ParseSeriesKey(key string) (string, map[string]string, error) {
+	errIncorrect := errors.New("the series key is incorrect")
+
+	name, rest, found, err := readKeyPart(key, '{')
+	if err != nil {
+		return "", nil, errIncorrect
+	}
+	if !found {
+		return name, nil, nil
+	}
+
+	if !strings.HasSuffix(rest, "}") {
+		return "", nil, errIncorrect
+	}
+	rest = rest[:len(rest)-1]
+
+	labels := make(map[string]string)
+	for rest != "" {
+		var labelName, value string
+
+		labelName, rest, found, err = readKeyPart(rest, '=')
+		if err != nil || !found || !strings.HasPrefix(rest, `"`) {
+			return "", nil, errIncorrect
+		}
+
+		value, rest, found, err = readKeyPart(rest[1:], '"')
+		if err != nil || !found {
+			return "", nil, errIncorrect
+		}
+		labels[labelName] = value
+
+		if rest != "" {
+			if rest[0] != ',' {
+				return "", nil, errIncorrect
+			}
+			rest = rest[1:]
+		}
+	}
+
+	if len(labels) == 0 {
+		return name, nil, nil
+	}
+
+	return name, labels, nil
+}
+
+// readKeyPart читает часть ключа до первого неэкранированного символа stop, снимая экранирование.
+// Возвращает прочитанное значение, остаток после stop и признак того, что stop найден.
+func readKeyPart(s string, stop byte) (string, string, bool, error) {
+	var value strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", false, errors.New("unterminated escape sequence")
+			}
+			i++
+			if s[i] == 'n' {
+				value.WriteByte('\n')
+			} else {
+				value.WriteByte(s[i])
+			}
+		case stop:
+			return value.String(), s[i+1:], true, nil
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+
+	return value.String(), "", false, nil
+}
+
+// CopyLabels возвращает копию набора меток.
+func CopyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+
+	result := make(map[string]string, len(labels))
+	for name, value := range labels {
+		result[name] = value
+	}
+
+	return result
+}
+
+// escapeKeyPart экранирует в имени метрики или метки обратную косую черту и символы special.
+func escapeKeyPart(value, special string) string {
+	if !strings.ContainsAny(value, "\\"+special) {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' || strings.IndexByte(special, value[i]) != -1 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(value[i])
+	}
+
+	return b.String()
+}
+
+func escapeLabelValue(value string) string {
+	if !strings.ContainsAny(value, "\\\"\n") {
+		return value
+	}
+
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
@@ -0,0 +1,66 @@
+package metric_test
+
+import (
+	"testing"
+
+	"github.com/dip96/metrics/internal/model/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetric_Key(t *testing.T) {
+	t.Run("without labels", func(t *testing.T) {
+		m := metric.Metric{ID: "HeapAlloc"}
+		assert.Equal(t, "HeapAlloc", m.Key())
+	})
+
+	t.Run("labels are sorted", func(t *testing.T) {
+		m := metric.Metric{ID: "HeapAlloc", Labels: map[string]string{"region": "eu", "host": "a"}}
+		assert.Equal(t, `HeapAlloc{host="a",region="eu"}`, m.Key())
+	})
+}
+
+func TestParseSeriesKey(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		labels := map[string]string{"host": `we"ird\,`, "region": "eu\nwest", "empty": ""}
+		key := metric.SeriesKey("HeapAlloc", labels)
+
+		name, parsed, err := metric.ParseSeriesKey(key)
+		require.NoError(t, err)
+		assert.Equal(t, "HeapAlloc", name)
+		assert.Equal(t, labels, parsed)
+	})
+
+	t.Run("special characters in names", func(t *testing.T) {
+		for _, tt := range []struct {
+			name   string
+			labels map[string]string
+		}{
+			{name: `cpu{core="0"}`},
+			{name: `back\slash`, labels: map[string]string{`a="b",c`: "1", "x}": `y\`}},
+			{name: "net{", labels: map[string]string{"{=": "", "": "empty name"}},
+		} {
+			key := metric.SeriesKey(tt.name, tt.labels)
+
+			name, parsed, err := metric.ParseSeriesKey(key)
+			require.NoError(t, err, key)
+			assert.Equal(t, tt.name, name, key)
+			assert.Equal(t, tt.labels, parsed, key)
+		}
+	})
+
+	t.Run("without labels", func(t *testing.T) {
+		name, parsed, err := metric.ParseSeriesKey("PollCount")
+		require.NoError(t, err)
+		assert.Equal(t, "PollCount", name)
+		assert.Nil(t, parsed)
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, _, err := metric.ParseSeriesKey(`HeapAlloc{host="a"`)
+		assert.Error(t, err)
+
+		_, _, err = metric.ParseSeriesKey(`HeapAlloc{host}`)
+		assert.Error(t, err)
+	})
+}
@@ -1,6 +1,7 @@
 package metric
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 )
@@ -17,7 +18,7 @@ func (m Metric) GetValueForDisplay() (string, error) {
 		return m.FullValueGauge, nil
 	}
 
-	return "", errors.New("the metric type is incorrect")
+	return m.distributionValue()
 }
 
 func (m Metric) GetValue() (string, error) {
@@ -29,5 +30,25 @@ func (m Metric) GetValue() (string, error) {
 		return fmt.Sprintf("%f", *m.Value), nil
 	}
 
-	return "", errors.New("the metric type is incorrect")
+	return m.distributionValue()
+}
+
+// distributionValue возвращает значение метрики типа histogram или summary в формате JSON.
+func (m Metric) distributionValue() (string, error) {
+	var value any
+	switch {
+	case m.MType == MetricTypeHistogram && m.Histogram != nil:
+		value = m.Histogram
+	case m.MType == MetricTypeSummary && m.Summary != nil:
+		value = m.Summary
+	default:
+		return "", errors.New("the metric type is incorrect")
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
 }
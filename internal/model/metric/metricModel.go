@@ -1,6 +1,8 @@
 // Package metric содержит типы и структуры для работы с метриками.
 package metric
 
+import "time"
+
 // MetricType представляет собой тип метрики.
 type MetricType string
 
@@ -9,13 +11,17 @@ const (
 	MetricTypeGauge MetricType = "gauge"
 	// MetricTypeCounter - тип метрики для подсчета количества событий или значений в течение определенного периода времени.
 	MetricTypeCounter MetricType = "counter"
+	// MetricTypeHistogram - тип метрики для распределения наблюдений по бакетам (например, задержек запросов).
+	MetricTypeHistogram MetricType = "histogram"
+	// MetricTypeSummary - тип метрики для распределения наблюдений, посчитанного клиентом в виде квантилей.
+	MetricTypeSummary MetricType = "summary"
 )
 
 // Metric представляет собой структуру для хранения информации о метрике.
 type Metric struct {
 	// ID - уникальный идентификатор метрики.
 	ID string `json:"id"`
-	// MType - тип метрики (gauge или counter).
+	// MType - тип метрики (gauge, counter, histogram или summary).
 	MType MetricType `json:"type"`
 	// Delta - значение метрики в случае передачи counter.
 	// Используется только для MetricTypeCounter.
@@ -23,6 +29,27 @@ type Metric struct {
 	// Value - значение метрики в случае передачи gauge.
 	// Используется только для MetricTypeGauge.
 	Value *float64 `json:"value,omitempty"`
+	// Histogram - значение метрики в случае передачи histogram.
+	// Используется только для MetricTypeHistogram.
+	Histogram *Histogram `json:"histogram,omitempty"`
+	// Summary - значение метрики в случае передачи summary.
+	// Используется только для MetricTypeSummary.
+	Summary *Summary `json:"summary,omitempty"`
+	// Labels - набор меток метрики (например, host или region).
+	// Ряд метрики идентифицируется именем вместе с набором меток, см. Key.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Rate - скорость роста счетчика в секунду за окно с учетом сбросов.
+	// Заполняется сервером только в ответах на запрос значения MetricTypeCounter.
+	Rate *float64 `json:"rate,omitempty"`
+	// Increase - прирост счетчика за то же окно с учетом сбросов.
+	Increase *float64 `json:"increase,omitempty"`
+	// UpdatedAt - время последнего обновления ряда.
+	// Заполняется только в снимке хранилища в файле, чтобы после восстановления
+	// устаревшие ряды не получали новый срок жизни. Хранилище учитывает его в Set.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// Timestamp - время отсчета, переданное источником (remote write, InfluxDB, Graphite, OTLP).
+	// Хранилище записывает отсчет в историю с этим временем, а если оно не задано - со временем записи.
+	Timestamp *time.Time `json:"-"`
 	// FullValueGauge - строковое представление значения метрики типа gauge с сохранением всех десятичных знаков после запятой.
 	FullValueGauge string
 }
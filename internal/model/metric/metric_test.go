@@ -32,6 +32,17 @@ func TestMetric_GetValueForDisplay(t *testing.T) {
 		assert.Equal(t, "3.140000", value)
 	})
 
+	t.Run("histogram metric", func(t *testing.T) {
+		m := metric.Metric{
+			MType:     metric.MetricTypeHistogram,
+			Histogram: &metric.Histogram{Buckets: []metric.Bucket{{UpperBound: 0.5, Count: 1}}, Sum: 0.7, Count: 2},
+		}
+
+		value, err := m.GetValueForDisplay()
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"buckets":[{"le":0.5,"count":1}],"sum":0.7,"count":2}`, value)
+	})
+
 	t.Run("invalid metric type", func(t *testing.T) {
 		m := metric.Metric{
 			MType: "invalid",
@@ -0,0 +1,49 @@
+package metric
+
+import "time"
+
+// Rollup представляет собой агрегат отсчетов ряда за окно фиксированной длины.
+// Для gauge используются Min, Max, Sum и Count, для counter - Last и Increase.
+type Rollup struct {
+	// Series - ключ ряда, см. SeriesKey.
+	Series string `json:"series"`
+	// Start - начало окна.
+	Start time.Time `json:"start"`
+	// Min, Max - минимальное и максимальное значение в окне.
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	// Sum - сумма значений в окне.
+	Sum float64 `json:"sum"`
+	// Count - количество отсчетов в окне.
+	Count int64 `json:"count"`
+	// Last - последнее значение в окне.
+	Last float64 `json:"last"`
+	// Increase - изменение значения с последнего отсчета перед окном.
+	// Для counter учитываются сбросы: уменьшение значения считается сбросом счетчика.
+	Increase float64 `json:"increase"`
+}
+
+// Merge добавляет к агрегату r агрегат более поздних отсчетов того же окна.
+func (r *Rollup) Merge(other Rollup) {
+	if r.Count == 0 {
+		*r = other
+		return
+	}
+
+	if other.Count == 0 {
+		return
+	}
+
+	if other.Min < r.Min {
+		r.Min = other.Min
+	}
+
+	if other.Max > r.Max {
+		r.Max = other.Max
+	}
+
+	r.Sum += other.Sum
+	r.Count += other.Count
+	r.Last = other.Last
+	r.Increase += other.Increase
+}
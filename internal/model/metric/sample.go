@@ -0,0 +1,44 @@
+package metric
+
+import (
+	"sort"
+	"time"
+)
+
+// Sample представляет собой значение метрики, зафиксированное в определенный момент времени.
+type Sample struct {
+	// Timestamp - время, в которое было принято значение метрики.
+	Timestamp time.Time `json:"timestamp"`
+	// Delta - значение метрики типа counter после обновления.
+	Delta *int64 `json:"delta,omitempty"`
+	// Value - значение метрики типа gauge.
+	Value *float64 `json:"value,omitempty"`
+}
+
+// SortByTimestamp упорядочивает метрики по времени отсчета (см. Metric.Timestamp), сохраняя порядок
+// метрик с одинаковым временем. Метрики без времени записываются со временем записи, поэтому идут последними.
+func SortByTimestamp(metrics []Metric) {
+	sort.SliceStable(metrics, func(i, j int) bool {
+		if metrics[i].Timestamp == nil || metrics[j].Timestamp == nil {
+			return metrics[i].Timestamp != nil && metrics[j].Timestamp == nil
+		}
+		return metrics[i].Timestamp.Before(*metrics[j].Timestamp)
+	})
+}
+
+// NewSample создает отсчет временного ряда из текущего значения метрики.
+func NewSample(m Metric, ts time.Time) Sample {
+	sample := Sample{Timestamp: ts}
+
+	if m.Delta != nil {
+		delta := *m.Delta
+		sample.Delta = &delta
+	}
+
+	if m.Value != nil {
+		value := *m.Value
+		sample.Value = &value
+	}
+
+	return sample
+}
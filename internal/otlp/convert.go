@@ -0,0 +1,353 @@
+// Package otlp реализует прием метрик по протоколу OpenTelemetry (OTLP).
+package otlp
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	pbCommon "github.com/dip96/metrics/protobuf/protos/opentelemetry/proto/common/v1"
+	pbMetrics "github.com/dip96/metrics/protobuf/protos/opentelemetry/proto/metrics/v1"
+)
+
+// Batch - результат преобразования запроса OTLP в метрики.
+type Batch struct {
+	// Set - значения, заменяющие сохраненные: gauge, накопленные счетчики и распределения.
+	Set []metricModel.Metric
+	// Increment - приращения счетчиков, немонотонных sum и гистограмм с временной агрегацией delta.
+	Increment []metricModel.Metric
+	// Rejected - количество точек, которые не удалось преобразовать.
+	Rejected int64
+	// Errors - причины отклонения точек.
+	Errors []error
+}
+
+// Convert преобразует метрики OTLP в метрики хранилища.
+// Атрибуты ресурса и точки становятся метками, при совпадении имен приоритет у атрибутов точки.
+// Gauge и немонотонные sum сохраняются как gauge, монотонные sum - как counter,
+// histogram и summary - как распределения. Приращения немонотонных sum с агрегацией delta
+// прибавляются к сохраненному значению gauge. Точки exponential histogram и точки
+// с неизвестной временной агрегацией отклоняются.
+// Метрика получает время точки TimeUnixNano (см. metricModel.Metric.Timestamp).
+func Convert(resourceMetrics []*pbMetrics.ResourceMetrics) *Batch {
+	b := &Batch{}
+
+	for _, rm := range resourceMetrics {
+		resourceLabels := attributesToLabels(nil, rm.GetResource().GetAttributes())
+
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				b.addMetric(m, resourceLabels)
+			}
+		}
+	}
+
+	return b
+}
+
+// Err возвращает объединенные причины отклонения точек или nil.
+func (b *Batch) Err() error {
+	return errors.Join(b.Errors...)
+}
+
+func (b *Batch) reject(name string, count int, err error) {
+	if count == 0 {
+		return
+	}
+
+	b.Rejected += int64(count)
+	b.Errors = append(b.Errors, fmt.Errorf("metric %s: %w", name, err))
+}
+
+func (b *Batch) addMetric(m *pbMetrics.Metric, resourceLabels map[string]string) {
+	name := m.GetName()
+	if name == "" {
+		b.reject("<empty>", countPoints(m), errors.New("the metric name is empty"))
+		return
+	}
+
+	switch data := m.GetData().(type) {
+	case *pbMetrics.Metric_Gauge:
+		for _, dp := range data.Gauge.GetDataPoints() {
+			b.addNumber(name, resourceLabels, dp, metricModel.MetricTypeGauge, false)
+		}
+
+	case *pbMetrics.Metric_Sum:
+		sum := data.Sum
+		if !sum.GetIsMonotonic() {
+			// Приращения немонотонной sum с агрегацией delta прибавляются к значению gauge
+			delta := sum.GetAggregationTemporality() == pbMetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+			for _, dp := range sum.GetDataPoints() {
+				b.addNumber(name, resourceLabels, dp, metricModel.MetricTypeGauge, delta)
+			}
+			return
+		}
+
+		delta, err := isDelta(sum.GetAggregationTemporality())
+		if err != nil {
+			b.reject(name, len(sum.GetDataPoints()), err)
+			return
+		}
+
+		for _, dp := range sum.GetDataPoints() {
+			b.addNumber(name, resourceLabels, dp, metricModel.MetricTypeCounter, delta)
+		}
+
+	case *pbMetrics.Metric_Histogram:
+		delta, err := isDelta(data.Histogram.GetAggregationTemporality())
+		if err != nil {
+			b.reject(name, len(data.Histogram.GetDataPoints()), err)
+			return
+		}
+
+		for _, dp := range data.Histogram.GetDataPoints() {
+			b.addHistogram(name, resourceLabels, dp, delta)
+		}
+
+	case *pbMetrics.Metric_Summary:
+		for _, dp := range data.Summary.GetDataPoints() {
+			b.addSummary(name, resourceLabels, dp)
+		}
+
+	case *pbMetrics.Metric_ExponentialHistogram:
+		b.reject(name, len(data.ExponentialHistogram.GetDataPoints()), errors.New("exponential histograms are not supported"))
+
+	default:
+		b.reject(name, 1, errors.New("the metric has no data"))
+	}
+}
+
+func (b *Batch) addNumber(name string, resourceLabels map[string]string, dp *pbMetrics.NumberDataPoint, mType metricModel.MetricType, delta bool) {
+	if noRecordedValue(dp.GetFlags()) {
+		return
+	}
+
+	timestamp, err := pointTime(dp.GetTimeUnixNano())
+	if err != nil {
+		b.reject(name, 1, err)
+		return
+	}
+
+	m := metricModel.Metric{ID: name, MType: mType, Labels: attributesToLabels(resourceLabels, dp.GetAttributes()), Timestamp: timestamp}
+
+	var value float64
+	switch v := dp.GetValue().(type) {
+	case *pbMetrics.NumberDataPoint_AsDouble:
+		value = v.AsDouble
+	case *pbMetrics.NumberDataPoint_AsInt:
+		value = float64(v.AsInt)
+	default:
+		b.reject(name, 1, errors.New("the data point has no value"))
+		return
+	}
+
+	if mType == metricModel.MetricTypeGauge {
+		m.Value = &value
+		if delta {
+			b.Increment = append(b.Increment, m)
+		} else {
+			b.Set = append(b.Set, m)
+		}
+		return
+	}
+
+	if value < 0 || value >= math.MaxInt64 || math.IsNaN(value) {
+		b.reject(name, 1, fmt.Errorf("invalid counter value %v", value))
+		return
+	}
+
+	counter := int64(math.Round(value))
+	m.Delta = &counter
+
+	if delta {
+		b.Increment = append(b.Increment, m)
+	} else {
+		b.Set = append(b.Set, m)
+	}
+}
+
+func (b *Batch) addHistogram(name string, resourceLabels map[string]string, dp *pbMetrics.HistogramDataPoint, delta bool) {
+	if noRecordedValue(dp.GetFlags()) {
+		return
+	}
+
+	bounds := dp.GetExplicitBounds()
+	counts := dp.GetBucketCounts()
+	if len(counts) != 0 && len(counts) != len(bounds)+1 {
+		b.reject(name, 1, fmt.Errorf("%d bucket counts do not match %d explicit bounds", len(counts), len(bounds)))
+		return
+	}
+
+	timestamp, err := pointTime(dp.GetTimeUnixNano())
+	if err != nil {
+		b.reject(name, 1, err)
+		return
+	}
+
+	h := &metricModel.Histogram{Sum: dp.GetSum(), Count: dp.GetCount()}
+
+	// В OTLP количества бакетов не кумулятивные, последний бакет соответствует +Inf
+	if len(counts) != 0 {
+		var cumulative uint64
+		h.Buckets = make([]metricModel.Bucket, 0, len(bounds))
+		for i, bound := range bounds {
+			cumulative += counts[i]
+			h.Buckets = append(h.Buckets, metricModel.Bucket{UpperBound: bound, Count: cumulative})
+		}
+	}
+
+	m := metricModel.Metric{
+		ID:        name,
+		MType:     metricModel.MetricTypeHistogram,
+		Histogram: h,
+		Labels:    attributesToLabels(resourceLabels, dp.GetAttributes()),
+		Timestamp: timestamp,
+	}
+
+	if err := m.Validate(); err != nil {
+		b.reject(name, 1, err)
+		return
+	}
+
+	if delta {
+		b.Increment = append(b.Increment, m)
+	} else {
+		b.Set = append(b.Set, m)
+	}
+}
+
+func (b *Batch) addSummary(name string, resourceLabels map[string]string, dp *pbMetrics.SummaryDataPoint) {
+	if noRecordedValue(dp.GetFlags()) {
+		return
+	}
+
+	timestamp, err := pointTime(dp.GetTimeUnixNano())
+	if err != nil {
+		b.reject(name, 1, err)
+		return
+	}
+
+	s := &metricModel.Summary{Sum: dp.GetSum(), Count: dp.GetCount()}
+	for _, q := range dp.GetQuantileValues() {
+		s.Quantiles = append(s.Quantiles, metricModel.Quantile{Quantile: q.GetQuantile(), Value: q.GetValue()})
+	}
+
+	m := metricModel.Metric{
+		ID:        name,
+		MType:     metricModel.MetricTypeSummary,
+		Summary:   s,
+		Labels:    attributesToLabels(resourceLabels, dp.GetAttributes()),
+		Timestamp: timestamp,
+	}
+
+	if err := m.Validate(); err != nil {
+		b.reject(name, 1, err)
+		return
+	}
+
+	// Summary в OTLP всегда содержит накопленные значения
+	b.Set = append(b.Set, m)
+}
+
+func isDelta(temporality pbMetrics.AggregationTemporality) (bool, error) {
+	switch temporality {
+	case pbMetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA:
+		return true, nil
+	case pbMetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unsupported aggregation temporality %v", temporality)
+	}
+}
+
+// pointTime возвращает время точки или nil, если точка его не содержит.
+func pointTime(unixNano uint64) (*time.Time, error) {
+	if unixNano == 0 {
+		return nil, nil
+	}
+
+	if unixNano > math.MaxInt64 {
+		return nil, fmt.Errorf("invalid data point time %d", unixNano)
+	}
+
+	ts := time.Unix(0, int64(unixNano))
+	return &ts, nil
+}
+
+func noRecordedValue(flags uint32) bool {
+	return flags&uint32(pbMetrics.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+func countPoints(m *pbMetrics.Metric) int {
+	switch data := m.GetData().(type) {
+	case *pbMetrics.Metric_Gauge:
+		return len(data.Gauge.GetDataPoints())
+	case *pbMetrics.Metric_Sum:
+		return len(data.Sum.GetDataPoints())
+	case *pbMetrics.Metric_Histogram:
+		return len(data.Histogram.GetDataPoints())
+	case *pbMetrics.Metric_ExponentialHistogram:
+		return len(data.ExponentialHistogram.GetDataPoints())
+	case *pbMetrics.Metric_Summary:
+		return len(data.Summary.GetDataPoints())
+	default:
+		return 1
+	}
+}
+
+// attributesToLabels возвращает копию меток base, дополненную атрибутами attributes.
+func attributesToLabels(base map[string]string, attributes []*pbCommon.KeyValue) map[string]string {
+	labels := metricModel.CopyLabels(base)
+	if len(attributes) == 0 {
+		return labels
+	}
+
+	if labels == nil {
+		labels = make(map[string]string, len(attributes))
+	}
+
+	for _, kv := range attributes {
+		if kv.GetKey() == "" {
+			continue
+		}
+		labels[kv.GetKey()] = anyValueToString(kv.GetValue())
+	}
+
+	return labels
+}
+
+// anyValueToString преобразует значение атрибута в строку.
+// Массивы и списки ключ-значение записываются в виде [a,b] и {k=v}.
+func anyValueToString(v *pbCommon.AnyValue) string {
+	switch value := v.GetValue().(type) {
+	case *pbCommon.AnyValue_StringValue:
+		return value.StringValue
+	case *pbCommon.AnyValue_BoolValue:
+		return strconv.FormatBool(value.BoolValue)
+	case *pbCommon.AnyValue_IntValue:
+		return strconv.FormatInt(value.IntValue, 10)
+	case *pbCommon.AnyValue_DoubleValue:
+		return strconv.FormatFloat(value.DoubleValue, 'g', -1, 64)
+	case *pbCommon.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(value.BytesValue)
+	case *pbCommon.AnyValue_ArrayValue:
+		items := make([]string, 0, len(value.ArrayValue.GetValues()))
+		for _, item := range value.ArrayValue.GetValues() {
+			items = append(items, anyValueToString(item))
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	case *pbCommon.AnyValue_KvlistValue:
+		items := make([]string, 0, len(value.KvlistValue.GetValues()))
+		for _, kv := range value.KvlistValue.GetValues() {
+			items = append(items, kv.GetKey()+"="+anyValueToString(kv.GetValue()))
+		}
+		return "{" + strings.Join(items, ",") + "}"
+	default:
+		return ""
+	}
+}
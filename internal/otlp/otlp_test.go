@@ -0,0 +1,231 @@
+package otlp
+
+import (
+	"context"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	memStorage "github.com/dip96/metrics/internal/storage/mem"
+	pbCollector "github.com/dip96/metrics/protobuf/protos/opentelemetry/proto/collector/metrics/v1"
+	pbCommon "github.com/dip96/metrics/protobuf/protos/opentelemetry/proto/common/v1"
+	pbMetrics "github.com/dip96/metrics/protobuf/protos/opentelemetry/proto/metrics/v1"
+	pbResource "github.com/dip96/metrics/protobuf/protos/opentelemetry/proto/resource/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+func stringAttr(key, value string) *pbCommon.KeyValue {
+	return &pbCommon.KeyValue{Key: key, Value: &pbCommon.AnyValue{Value: &pbCommon.AnyValue_StringValue{StringValue: value}}}
+}
+
+func resourceMetrics(metrics ...*pbMetrics.Metric) []*pbMetrics.ResourceMetrics {
+	return []*pbMetrics.ResourceMetrics{{
+		Resource: &pbResource.Resource{Attributes: []*pbCommon.KeyValue{
+			stringAttr("service.name", "api"),
+			stringAttr("host", "resource"),
+		}},
+		ScopeMetrics: []*pbMetrics.ScopeMetrics{{Metrics: metrics}},
+	}}
+}
+
+func sumMetric(name string, temporality pbMetrics.AggregationTemporality, monotonic bool, value int64) *pbMetrics.Metric {
+	return &pbMetrics.Metric{Name: name, Data: &pbMetrics.Metric_Sum{Sum: &pbMetrics.Sum{
+		AggregationTemporality: temporality,
+		IsMonotonic:            monotonic,
+		DataPoints: []*pbMetrics.NumberDataPoint{{
+			Attributes: []*pbCommon.KeyValue{stringAttr("host", "a")},
+			Value:      &pbMetrics.NumberDataPoint_AsInt{AsInt: value},
+		}},
+	}}}
+}
+
+func TestConvert(t *testing.T) {
+	cumulative := pbMetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	delta := pbMetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+
+	gauge := &pbMetrics.Metric{Name: "cpu.usage", Data: &pbMetrics.Metric_Gauge{Gauge: &pbMetrics.Gauge{
+		DataPoints: []*pbMetrics.NumberDataPoint{
+			{Value: &pbMetrics.NumberDataPoint_AsDouble{AsDouble: 0.5}},
+			// Точка без значения пропускается без ошибки
+			{Flags: uint32(pbMetrics.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK)},
+		},
+	}}}
+
+	histogram := &pbMetrics.Metric{Name: "http.duration", Data: &pbMetrics.Metric_Histogram{Histogram: &pbMetrics.Histogram{
+		AggregationTemporality: delta,
+		DataPoints: []*pbMetrics.HistogramDataPoint{
+			{Count: 6, Sum: proto.Float64(3.5), ExplicitBounds: []float64{0.1, 1}, BucketCounts: []uint64{2, 3, 1}},
+			{Count: 1, ExplicitBounds: []float64{0.1}, BucketCounts: []uint64{1}},
+		},
+	}}}
+
+	exponential := &pbMetrics.Metric{Name: "exp", Data: &pbMetrics.Metric_ExponentialHistogram{
+		ExponentialHistogram: &pbMetrics.ExponentialHistogram{DataPoints: []*pbMetrics.ExponentialHistogramDataPoint{{Count: 1}}},
+	}}
+
+	batch := Convert(resourceMetrics(
+		gauge,
+		sumMetric("requests", cumulative, true, 10),
+		sumMetric("sent", delta, true, 3),
+		sumMetric("queue", cumulative, false, -2),
+		sumMetric("unknown", pbMetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED, true, 1),
+		histogram,
+		exponential,
+	))
+
+	require.Len(t, batch.Set, 3)
+
+	assert.Equal(t, "cpu.usage", batch.Set[0].ID)
+	assert.Equal(t, metricModel.MetricTypeGauge, batch.Set[0].MType)
+	assert.Equal(t, 0.5, *batch.Set[0].Value)
+	assert.Equal(t, map[string]string{"service.name": "api", "host": "resource"}, batch.Set[0].Labels)
+
+	// Атрибуты точки важнее атрибутов ресурса
+	assert.Equal(t, "requests", batch.Set[1].ID)
+	assert.Equal(t, metricModel.MetricTypeCounter, batch.Set[1].MType)
+	assert.Equal(t, int64(10), *batch.Set[1].Delta)
+	assert.Equal(t, map[string]string{"service.name": "api", "host": "a"}, batch.Set[1].Labels)
+
+	assert.Equal(t, "queue", batch.Set[2].ID)
+	assert.Equal(t, metricModel.MetricTypeGauge, batch.Set[2].MType)
+	assert.Equal(t, -2.0, *batch.Set[2].Value)
+
+	require.Len(t, batch.Increment, 2)
+	assert.Equal(t, "sent", batch.Increment[0].ID)
+	assert.Equal(t, int64(3), *batch.Increment[0].Delta)
+
+	assert.Equal(t, "http.duration", batch.Increment[1].ID)
+	assert.Equal(t, &metricModel.Histogram{
+		Buckets: []metricModel.Bucket{{UpperBound: 0.1, Count: 2}, {UpperBound: 1, Count: 5}},
+		Sum:     3.5,
+		Count:   6,
+	}, batch.Increment[1].Histogram)
+
+	// Отклонены: точка с неизвестной агрегацией, гистограмма с лишним бакетом и exponential histogram
+	assert.Equal(t, int64(3), batch.Rejected)
+	assert.ErrorContains(t, batch.Err(), "metric unknown")
+	assert.ErrorContains(t, batch.Err(), "metric http.duration")
+	assert.ErrorContains(t, batch.Err(), "metric exp")
+
+	t.Run("non-monotonic delta", func(t *testing.T) {
+		batch := Convert(resourceMetrics(sumMetric("connections", delta, false, -2)))
+
+		// Приращение немонотонной sum прибавляется к gauge
+		require.Empty(t, batch.Set)
+		require.Len(t, batch.Increment, 1)
+		assert.Equal(t, metricModel.MetricTypeGauge, batch.Increment[0].MType)
+		assert.Equal(t, -2.0, *batch.Increment[0].Value)
+	})
+
+	t.Run("point time", func(t *testing.T) {
+		sum := sumMetric("requests", cumulative, true, 1)
+		sum.GetSum().GetDataPoints()[0].TimeUnixNano = uint64(time.Unix(1700000000, 0).UnixNano())
+		batch := Convert(resourceMetrics(sum, sumMetric("sent", delta, true, 1)))
+
+		require.Len(t, batch.Set, 1)
+		assert.Equal(t, time.Unix(1700000000, 0), *batch.Set[0].Timestamp)
+		require.Len(t, batch.Increment, 1)
+		assert.Nil(t, batch.Increment[0].Timestamp)
+
+		sum.GetSum().GetDataPoints()[0].TimeUnixNano = math.MaxUint64
+		batch = Convert(resourceMetrics(sum))
+		assert.Equal(t, int64(1), batch.Rejected)
+	})
+}
+
+func TestAnyValueToString(t *testing.T) {
+	value := &pbCommon.AnyValue{Value: &pbCommon.AnyValue_ArrayValue{ArrayValue: &pbCommon.ArrayValue{Values: []*pbCommon.AnyValue{
+		{Value: &pbCommon.AnyValue_IntValue{IntValue: 1}},
+		{Value: &pbCommon.AnyValue_BoolValue{BoolValue: true}},
+		{Value: &pbCommon.AnyValue_DoubleValue{DoubleValue: 0.25}},
+	}}}}
+
+	assert.Equal(t, "[1,true,0.25]", anyValueToString(value))
+}
+
+func TestReceiverExport(t *testing.T) {
+	store := memStorage.NewStorage()
+	receiver := NewReceiver(store)
+
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	Register(server, receiver)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := pbCollector.NewMetricsServiceClient(conn)
+	delta := pbMetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	req := &pbCollector.ExportMetricsServiceRequest{ResourceMetrics: resourceMetrics(
+		sumMetric("sent", delta, true, 3),
+		&pbMetrics.Metric{Name: "empty"},
+	)}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Export(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), resp.GetPartialSuccess().GetRejectedDataPoints())
+		assert.Contains(t, resp.GetPartialSuccess().GetErrorMessage(), "metric empty")
+	}
+
+	// Приращения с агрегацией delta суммируются
+	sent, err := store.Get(metricModel.SeriesKey("sent", map[string]string{"service.name": "api", "host": "a"}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), *sent.Delta)
+
+	t.Run("non-monotonic delta", func(t *testing.T) {
+		for _, value := range []int64{5, -2} {
+			_, err := client.Export(context.Background(), &pbCollector.ExportMetricsServiceRequest{
+				ResourceMetrics: resourceMetrics(sumMetric("connections", delta, false, value)),
+			})
+			require.NoError(t, err)
+		}
+
+		connections, err := store.Get(metricModel.SeriesKey("connections", map[string]string{"service.name": "api", "host": "a"}))
+		require.NoError(t, err)
+		assert.Equal(t, metricModel.MetricTypeGauge, connections.MType)
+		assert.Equal(t, 3.0, *connections.Value)
+	})
+
+	t.Run("point time", func(t *testing.T) {
+		start := time.Now().Add(-time.Hour).Truncate(time.Second)
+		export := func(value int64, ts time.Time) *pbCollector.ExportMetricsServiceResponse {
+			sum := sumMetric("requests", pbMetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, true, value)
+			sum.GetSum().GetDataPoints()[0].TimeUnixNano = uint64(ts.UnixNano())
+			resp, err := client.Export(context.Background(), &pbCollector.ExportMetricsServiceRequest{ResourceMetrics: resourceMetrics(sum)})
+			require.NoError(t, err)
+			return resp
+		}
+
+		export(1, start)
+		export(2, start.Add(time.Minute))
+
+		// Точка старше последней точки ряда отклоняется
+		resp := export(3, start.Add(30*time.Second))
+		assert.Equal(t, int64(1), resp.GetPartialSuccess().GetRejectedDataPoints())
+
+		key := metricModel.SeriesKey("requests", map[string]string{"service.name": "api", "host": "a"})
+		history, err := store.GetRange(key, start, start.Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Equal(t, start, history[0].Timestamp)
+		assert.Equal(t, int64(2), *history[1].Delta)
+	})
+}
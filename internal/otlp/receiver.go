@@ -0,0 +1,87 @@
+package otlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage"
+	pbCollector "github.com/dip96/metrics/protobuf/protos/opentelemetry/proto/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Receiver реализует сервис OTLP opentelemetry.proto.collector.metrics.v1.MetricsService
+// и сохраняет полученные метрики в хранилище.
+type Receiver struct {
+	pbCollector.UnimplementedMetricsServiceServer
+	storage storage.StorageInterface
+}
+
+// NewReceiver создает приемник метрик OTLP, сохраняющий метрики в store.
+func NewReceiver(store storage.StorageInterface) *Receiver {
+	return &Receiver{storage: store}
+}
+
+// Register регистрирует сервис OTLP MetricsService на gRPC сервере.
+func Register(registrar grpc.ServiceRegistrar, receiver *Receiver) {
+	pbCollector.RegisterMetricsServiceServer(registrar, receiver)
+}
+
+// Export сохраняет метрики запроса. Отклоненные точки не прерывают сохранение остальных
+// и возвращаются в ответе как частичный успех.
+func (r *Receiver) Export(_ context.Context, req *pbCollector.ExportMetricsServiceRequest) (*pbCollector.ExportMetricsServiceResponse, error) {
+	resp, err := r.Save(req)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+// Save преобразует и сохраняет метрики запроса.
+// Точки старше последнего обновления своего ряда и приращения ряда другого типа
+// отклоняются и возвращаются в ответе как частичный успех.
+// Ошибка возвращается только при ошибке хранилища.
+func (r *Receiver) Save(req *pbCollector.ExportMetricsServiceRequest) (*pbCollector.ExportMetricsServiceResponse, error) {
+	batch := Convert(req.GetResourceMetrics())
+
+	if len(batch.Set) > 0 {
+		metricModel.SortByTimestamp(batch.Set)
+
+		written, err := r.storage.Append(batch.Set)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save metrics: %w", err)
+		}
+
+		if rejected := len(batch.Set) - len(written); rejected > 0 {
+			batch.Rejected += int64(rejected)
+			batch.Errors = append(batch.Errors, fmt.Errorf("%d data points: %w", rejected, storage.ErrOutOfOrder))
+		}
+	}
+
+	metricModel.SortByTimestamp(batch.Increment)
+	for _, m := range batch.Increment {
+		_, err := r.storage.Increment(m)
+		if errors.Is(err, storage.ErrOutOfOrder) || errors.Is(err, storage.ErrTypeMismatch) {
+			batch.reject(m.ID, 1, err)
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to increment metric %s: %w", m.Key(), err)
+		}
+	}
+
+	resp := &pbCollector.ExportMetricsServiceResponse{}
+	if batch.Rejected > 0 {
+		resp.PartialSuccess = &pbCollector.ExportMetricsPartialSuccess{
+			RejectedDataPoints: batch.Rejected,
+			ErrorMessage:       batch.Err().Error(),
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,310 @@
+// Package prometheus содержит сериализацию метрик в текстовые форматы Prometheus и их разбор.
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Format представляет собой формат экспозиции метрик.
+type Format string
+
+const (
+	// FormatText - текстовый формат Prometheus версии 0.0.4.
+	FormatText Format = "text/plain; version=0.0.4; charset=utf-8"
+	// FormatOpenMetrics - формат OpenMetrics версии 1.0.0.
+	FormatOpenMetrics Format = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// NegotiateFormat выбирает формат экспозиции по заголовку Accept.
+// OpenMetrics отдается только если клиент явно его запросил.
+func NegotiateFormat(accept string) Format {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.Split(part, ";")[0])
+		if mediaType == "application/openmetrics-text" {
+			return FormatOpenMetrics
+		}
+	}
+
+	return FormatText
+}
+
+// SanitizeName приводит имя метрики к виду [a-zA-Z_:][a-zA-Z0-9_:]*.
+func SanitizeName(name string) string {
+	if name == "" {
+		return "_"
+	}
+
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	return b.String()
+}
+
+// family - группа метрик с одинаковым именем и типом.
+type family struct {
+	name    string
+	mType   metricModel.MetricType
+	metrics []metricModel.Metric
+}
+
+// Encode сериализует метрики в выбранном формате.
+// Метрики сортируются по имени, чтобы вывод был стабильным между запросами.
+func Encode(w io.Writer, metrics map[string]metricModel.Metric, format Format) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range groupFamilies(metrics, format) {
+		if _, err := fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.mType); err != nil {
+			return err
+		}
+
+		for _, m := range f.metrics {
+			if err := writeSample(bw, f, m, format); err != nil {
+				return err
+			}
+		}
+	}
+
+	if format == FormatOpenMetrics {
+		if _, err := bw.WriteString("# EOF\n"); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// groupFamilies группирует метрики в семейства по имени после очистки.
+// Метрики обходятся в порядке ключей, поэтому при совпадении имен после очистки
+// в вывод всегда попадает одна и та же метрика, а остальные пропускаются с ошибкой в журнале.
+func groupFamilies(metrics map[string]metricModel.Metric, format Format) []*family {
+	keys := make([]string, 0, len(metrics))
+	for key := range metrics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	families := make(map[string]*family)
+	series := make(map[string]string)
+
+	for _, key := range keys {
+		m := metrics[key]
+
+		switch m.MType {
+		case metricModel.MetricTypeGauge, metricModel.MetricTypeCounter,
+			metricModel.MetricTypeHistogram, metricModel.MetricTypeSummary:
+		default:
+			continue
+		}
+
+		name := familyName(m, format)
+		f, ok := families[name]
+		if !ok {
+			f = &family{name: name, mType: m.MType}
+			families[name] = f
+		}
+
+		// Метрики с одинаковым именем после очистки, но разным типом не могут попасть в одно семейство
+		if f.mType != m.MType {
+			log.Errorf("Skipping metric %s: family %s already has type %s, got %s", m.Key(), name, f.mType, m.MType)
+			continue
+		}
+
+		m.Labels = exposedLabels(m)
+
+		seriesKey := metricModel.SeriesKey(name, m.Labels)
+		if first, ok := series[seriesKey]; ok {
+			log.Errorf("Skipping metric %s: it is exposed as %s, as is %s", m.Key(), seriesKey, first)
+			continue
+		}
+		series[seriesKey] = m.Key()
+
+		f.metrics = append(f.metrics, m)
+	}
+
+	result := make([]*family, 0, len(families))
+	for _, f := range families {
+		result = append(result, f)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+
+	return result
+}
+
+// familyName возвращает имя семейства метрик.
+// В OpenMetrics имя семейства счетчика не содержит суффикс _total.
+func familyName(m metricModel.Metric, format Format) string {
+	name := SanitizeName(m.ID)
+
+	if format == FormatOpenMetrics && m.MType == metricModel.MetricTypeCounter {
+		name = strings.TrimSuffix(name, "_total")
+	}
+
+	return name
+}
+
+func writeSample(w io.Writer, f *family, m metricModel.Metric, format Format) error {
+	name := f.name
+	var value string
+
+	switch m.MType {
+	case metricModel.MetricTypeCounter:
+		if m.Delta == nil {
+			return nil
+		}
+		if format == FormatOpenMetrics {
+			name += "_total"
+		}
+		value = strconv.FormatInt(*m.Delta, 10)
+	case metricModel.MetricTypeGauge:
+		if m.Value == nil {
+			return nil
+		}
+		value = formatFloat(*m.Value)
+	case metricModel.MetricTypeHistogram, metricModel.MetricTypeSummary:
+		return writeDistribution(w, name, m)
+	}
+
+	_, err := fmt.Fprintf(w, "%s %s\n", metricModel.SeriesKey(name, sanitizeLabels(m.Labels)), value)
+	return err
+}
+
+// writeDistribution записывает ряды гистограммы или summary:
+// бакеты с меткой le (включая +Inf) или квантили с меткой quantile, затем _sum и _count.
+func writeDistribution(w io.Writer, name string, m metricModel.Metric) error {
+	var sum float64
+	var count uint64
+
+	switch {
+	case m.Histogram != nil:
+		for _, b := range m.Histogram.Buckets {
+			if err := writeLine(w, name+"_bucket", m.Labels, "le", formatFloat(b.UpperBound), strconv.FormatUint(b.Count, 10)); err != nil {
+				return err
+			}
+		}
+		if err := writeLine(w, name+"_bucket", m.Labels, "le", "+Inf", strconv.FormatUint(m.Histogram.Count, 10)); err != nil {
+			return err
+		}
+		sum, count = m.Histogram.Sum, m.Histogram.Count
+	case m.Summary != nil:
+		for _, q := range m.Summary.Quantiles {
+			if err := writeLine(w, name, m.Labels, "quantile", formatFloat(q.Quantile), formatFloat(q.Value)); err != nil {
+				return err
+			}
+		}
+		sum, count = m.Summary.Sum, m.Summary.Count
+	default:
+		return nil
+	}
+
+	if err := writeLine(w, name+"_sum", m.Labels, "", "", formatFloat(sum)); err != nil {
+		return err
+	}
+
+	return writeLine(w, name+"_count", m.Labels, "", "", strconv.FormatUint(count, 10))
+}
+
+// writeLine записывает один ряд с метками labels и, если extraName не пуст, дополнительной меткой.
+func writeLine(w io.Writer, name string, labels map[string]string, extraName, extraValue, value string) error {
+	labels = sanitizeLabels(labels)
+	if extraName != "" {
+		if labels == nil {
+			labels = make(map[string]string, 1)
+		}
+		labels[extraName] = extraValue
+	}
+
+	_, err := fmt.Fprintf(w, "%s %s\n", metricModel.SeriesKey(name, labels), value)
+	return err
+}
+
+// exposedLabels возвращает метки метрики m в том виде, в котором они попадут в вывод.
+// Метки, имена которых совпали после очистки или с меткой le или quantile распределения,
+// отбрасываются с ошибкой в журнале.
+func exposedLabels(m metricModel.Metric) map[string]string {
+	labels := make(map[string]string, len(m.Labels))
+	origins := make(map[string]string, len(m.Labels))
+
+	names := make([]string, 0, len(m.Labels))
+	for name := range m.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sanitized := sanitizeLabelName(name)
+		if origin, ok := origins[sanitized]; ok {
+			log.Errorf("Dropping label %q of metric %s: it is exposed as %s, as is label %q", name, m.Key(), sanitized, origin)
+			continue
+		}
+
+		if (m.MType == metricModel.MetricTypeHistogram && sanitized == "le") ||
+			(m.MType == metricModel.MetricTypeSummary && sanitized == "quantile") {
+			log.Errorf("Dropping label %q of metric %s: the label name is reserved for %s", name, m.Key(), m.MType)
+			continue
+		}
+
+		origins[sanitized] = name
+		labels[sanitized] = m.Labels[name]
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+
+	return labels
+}
+
+// sanitizeLabels приводит имена меток к виду [a-zA-Z_][a-zA-Z0-9_]*.
+func sanitizeLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	result := make(map[string]string, len(labels))
+	for name, value := range labels {
+		result[sanitizeLabelName(name)] = value
+	}
+
+	return result
+}
+
+// sanitizeLabelName приводит имя метки к виду [a-zA-Z_][a-zA-Z0-9_]*.
+func sanitizeLabelName(name string) string {
+	return strings.ReplaceAll(SanitizeName(name), ":", "_")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,149 @@
+package prometheus_test
+
+import (
+	"bytes"
+	"testing"
+
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeName(t *testing.T) {
+	assert.Equal(t, "HeapAlloc", prometheus.SanitizeName("HeapAlloc"))
+	assert.Equal(t, "http_requests_total", prometheus.SanitizeName("http.requests-total"))
+	assert.Equal(t, "_1metric", prometheus.SanitizeName("1metric"))
+	assert.Equal(t, "ns:metric", prometheus.SanitizeName("ns:metric"))
+	assert.Equal(t, "_", prometheus.SanitizeName(""))
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	assert.Equal(t, prometheus.FormatText, prometheus.NegotiateFormat(""))
+	assert.Equal(t, prometheus.FormatText, prometheus.NegotiateFormat("text/plain;version=0.0.4;q=0.5,*/*;q=0.1"))
+	assert.Equal(t, prometheus.FormatOpenMetrics, prometheus.NegotiateFormat("application/openmetrics-text;version=1.0.0,text/plain;q=0.5"))
+}
+
+func TestEncode(t *testing.T) {
+	metrics := map[string]metricModel.Metric{
+		"PollCount": {ID: "PollCount", MType: metricModel.MetricTypeCounter, Delta: Int64Ptr(5)},
+		"HeapAlloc": {ID: "HeapAlloc", MType: metricModel.MetricTypeGauge, Value: Float64Ptr(1.5)},
+		"cpu.usage": {ID: "cpu.usage", MType: metricModel.MetricTypeGauge, Value: Float64Ptr(0.25)},
+	}
+
+	t.Run("text format", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := prometheus.Encode(&buf, metrics, prometheus.FormatText)
+		require.NoError(t, err)
+
+		expected := "# TYPE HeapAlloc gauge\n" +
+			"HeapAlloc 1.5\n" +
+			"# TYPE PollCount counter\n" +
+			"PollCount 5\n" +
+			"# TYPE cpu_usage gauge\n" +
+			"cpu_usage 0.25\n"
+		assert.Equal(t, expected, buf.String())
+	})
+
+	t.Run("openmetrics format", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := prometheus.Encode(&buf, metrics, prometheus.FormatOpenMetrics)
+		require.NoError(t, err)
+
+		expected := "# TYPE HeapAlloc gauge\n" +
+			"HeapAlloc 1.5\n" +
+			"# TYPE PollCount counter\n" +
+			"PollCount_total 5\n" +
+			"# TYPE cpu_usage gauge\n" +
+			"cpu_usage 0.25\n" +
+			"# EOF\n"
+		assert.Equal(t, expected, buf.String())
+	})
+}
+
+func TestEncodeLabels(t *testing.T) {
+	hostA := metricModel.Metric{ID: "HeapAlloc", MType: metricModel.MetricTypeGauge, Value: Float64Ptr(1), Labels: map[string]string{"host": "a", "dc.name": `e"u`}}
+	hostB := metricModel.Metric{ID: "HeapAlloc", MType: metricModel.MetricTypeGauge, Value: Float64Ptr(2), Labels: map[string]string{"host": "b"}}
+	metrics := map[string]metricModel.Metric{
+		hostA.Key(): hostA,
+		hostB.Key(): hostB,
+	}
+
+	var buf bytes.Buffer
+	err := prometheus.Encode(&buf, metrics, prometheus.FormatText)
+	require.NoError(t, err)
+
+	expected := "# TYPE HeapAlloc gauge\n" +
+		"HeapAlloc{dc_name=\"e\\\"u\",host=\"a\"} 1\n" +
+		"HeapAlloc{host=\"b\"} 2\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestEncodeCollisions(t *testing.T) {
+	dotted := metricModel.Metric{ID: "heap.alloc", MType: metricModel.MetricTypeGauge, Value: Float64Ptr(1)}
+	underscored := metricModel.Metric{ID: "heap_alloc", MType: metricModel.MetricTypeGauge, Value: Float64Ptr(2)}
+	counter := metricModel.Metric{ID: "heap-alloc", MType: metricModel.MetricTypeCounter, Delta: Int64Ptr(3)}
+	labeled := metricModel.Metric{ID: "Alloc", MType: metricModel.MetricTypeGauge, Value: Float64Ptr(4), Labels: map[string]string{"dc.name": "a", "dc_name": "b"}}
+	metrics := map[string]metricModel.Metric{
+		dotted.Key():      dotted,
+		underscored.Key(): underscored,
+		counter.Key():     counter,
+		labeled.Key():     labeled,
+	}
+
+	// Из совпавших после очистки рядов и меток выводится первый по ключу, остальные пропускаются
+	var buf bytes.Buffer
+	err := prometheus.Encode(&buf, metrics, prometheus.FormatText)
+	require.NoError(t, err)
+
+	expected := "# TYPE Alloc gauge\n" +
+		"Alloc{dc_name=\"a\"} 4\n" +
+		"# TYPE heap_alloc counter\n" +
+		"heap_alloc 3\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestEncodeDistributions(t *testing.T) {
+	latency := metricModel.Metric{
+		ID:        "latency",
+		MType:     metricModel.MetricTypeHistogram,
+		Histogram: &metricModel.Histogram{Buckets: []metricModel.Bucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 1, Count: 3}}, Sum: 2.5, Count: 4},
+		Labels:    map[string]string{"host": "a"},
+	}
+	size := metricModel.Metric{
+		ID:      "size",
+		MType:   metricModel.MetricTypeSummary,
+		Summary: &metricModel.Summary{Quantiles: []metricModel.Quantile{{Quantile: 0.5, Value: 10}, {Quantile: 0.99, Value: 42}}, Sum: 100, Count: 7},
+	}
+	metrics := map[string]metricModel.Metric{
+		latency.Key(): latency,
+		size.Key():    size,
+	}
+
+	var buf bytes.Buffer
+	err := prometheus.Encode(&buf, metrics, prometheus.FormatText)
+	require.NoError(t, err)
+
+	expected := "# TYPE latency histogram\n" +
+		"latency_bucket{host=\"a\",le=\"0.1\"} 1\n" +
+		"latency_bucket{host=\"a\",le=\"1\"} 3\n" +
+		"latency_bucket{host=\"a\",le=\"+Inf\"} 4\n" +
+		"latency_sum{host=\"a\"} 2.5\n" +
+		"latency_count{host=\"a\"} 4\n" +
+		"# TYPE size summary\n" +
+		"size{quantile=\"0.5\"} 10\n" +
+		"size{quantile=\"0.99\"} 42\n" +
+		"size_sum 100\n" +
+		"size_count 7\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+// Вспомогательная функция для создания указателя на float64
+func Float64Ptr(f float64) *float64 {
+	return &f
+}
+
+// Вспомогательная функция для создания указателя на int64
+func Int64Ptr(i int64) *int64 {
+	return &i
+}
@@ -0,0 +1,178 @@
+package prometheus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Типы семейств метрик из комментария # TYPE.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+	TypeSummary   = "summary"
+	TypeUntyped   = "untyped"
+)
+
+// Sample - отсчет, разобранный из текстового формата.
+type Sample struct {
+	// Name - имя ряда, например http_requests_total или latency_bucket.
+	Name string
+	// Family - имя семейства, к которому относится ряд.
+	Family string
+	// Type - тип семейства. Для рядов без комментария # TYPE - TypeUntyped.
+	Type string
+	// Labels - метки ряда.
+	Labels map[string]string
+	// Value - значение отсчета.
+	Value float64
+}
+
+// familySuffixes - суффиксы, которые ряды гистограмм, summary и счетчиков OpenMetrics добавляют к имени семейства.
+var familySuffixes = []string{"_total", "_created", "_bucket", "_count", "_sum", "_info"}
+
+// ParseText разбирает метрики в текстовом формате Prometheus 0.0.4 или OpenMetrics 1.0.
+// Метки времени отсчетов не учитываются. Ошибка содержит номер некорректной строки.
+func ParseText(r io.Reader) ([]Sample, error) {
+	var samples []Sample
+	types := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		s, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		s.Family, s.Type = s.Name, TypeUntyped
+		if t, ok := types[s.Name]; ok {
+			s.Type = t
+		} else {
+			for _, suffix := range familySuffixes {
+				family, ok := strings.CutSuffix(s.Name, suffix)
+				if t, known := types[family]; ok && known {
+					s.Family, s.Type = family, t
+					break
+				}
+			}
+		}
+
+		samples = append(samples, s)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// parseSample разбирает строку вида name{label="value",...} value [timestamp].
+func parseSample(line string) (Sample, error) {
+	end := strings.IndexAny(line, "{ \t")
+	if end == -1 {
+		return Sample{}, errors.New("the sample has no value")
+	}
+
+	s := Sample{Name: line[:end]}
+	if s.Name == "" {
+		return Sample{}, errors.New("the metric name is empty")
+	}
+
+	rest := line[end:]
+	if rest[0] == '{' {
+		labels, tail, err := parseLabels(rest[1:])
+		if err != nil {
+			return Sample{}, err
+		}
+		s.Labels = labels
+		rest = tail
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return Sample{}, fmt.Errorf("invalid sample %q", rest)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("invalid value %q", fields[0])
+	}
+	s.Value = value
+
+	return s, nil
+}
+
+// parseLabels разбирает метки после открывающей фигурной скобки
+// и возвращает их вместе с остатком строки после закрывающей скобки.
+func parseLabels(s string) (map[string]string, string, error) {
+	var labels map[string]string
+
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if strings.HasPrefix(s, "}") {
+			return labels, s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq == -1 {
+			return nil, "", errors.New("invalid labels")
+		}
+
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		if name == "" || !strings.HasPrefix(s, `"`) {
+			return nil, "", fmt.Errorf("invalid label %q", name)
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i == len(s) {
+			return nil, "", fmt.Errorf("unterminated value of label %q", name)
+		}
+
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[name] = value.String()
+
+		s = strings.TrimLeft(s[i+1:], " \t")
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		} else if !strings.HasPrefix(s, "}") {
+			return nil, "", errors.New("invalid labels")
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package prometheus
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseText(t *testing.T) {
+	text := `# HELP http_requests_total Requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{ method = "get", path="C:\\dir \"x\"\n" , } 3
+# TYPE temperature gauge
+temperature -1.5e1
+# TYPE latency histogram
+latency_bucket{le="+Inf"} 4
+latency_sum 0.5
+# TYPE requests counter
+requests_total 5
+requests_created 1700000000
+no_type NaN
+`
+
+	samples, err := ParseText(strings.NewReader(text))
+	require.NoError(t, err)
+	require.Len(t, samples, 8)
+
+	assert.Equal(t, Sample{
+		Name: "http_requests_total", Family: "http_requests_total", Type: TypeCounter,
+		Labels: map[string]string{"method": "post", "code": "200"}, Value: 1027,
+	}, samples[0])
+	assert.Equal(t, map[string]string{"method": "get", "path": "C:\\dir \"x\"\n"}, samples[1].Labels)
+
+	assert.Equal(t, TypeGauge, samples[2].Type)
+	assert.Equal(t, -15.0, samples[2].Value)
+
+	assert.Equal(t, "latency", samples[3].Family)
+	assert.Equal(t, TypeHistogram, samples[3].Type)
+	assert.Equal(t, "latency", samples[4].Family)
+
+	// Счетчик OpenMetrics: имя семейства без суффикса _total
+	assert.Equal(t, "requests", samples[5].Family)
+	assert.Equal(t, TypeCounter, samples[5].Type)
+	assert.Equal(t, "requests_created", samples[6].Name)
+
+	assert.Equal(t, TypeUntyped, samples[7].Type)
+	assert.True(t, math.IsNaN(samples[7].Value))
+}
+
+func TestParseTextErrors(t *testing.T) {
+	for _, text := range []string{
+		"ok 1\nbroken\n",
+		"ok 1\nbroken{a=\"b\" 1\n",
+		"ok 1\nbroken{a=b} 1\n",
+		"ok 1\nbroken abc\n",
+	} {
+		_, err := ParseText(strings.NewReader(text))
+		assert.ErrorContains(t, err, "line 2", text)
+	}
+}
@@ -0,0 +1,114 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"time"
+)
+
+// DefaultRateWindow - окно расчета скорости и прироста счетчика, если оно не задано.
+const DefaultRateWindow = 5 * time.Minute
+
+// CounterRate - прирост и скорость роста ряда счетчика за окно.
+type CounterRate struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Increase - прирост счетчика за окно с учетом сбросов.
+	Increase float64 `json:"increase"`
+	// Rate - средняя скорость роста счетчика в секунду.
+	Rate float64 `json:"rate"`
+	// Resets - количество сбросов счетчика за окно.
+	Resets int `json:"resets"`
+}
+
+// Increase вычисляет прирост счетчика по отсортированным по времени отсчетам.
+// Уменьшение значения считается сбросом счетчика: прирост после сброса равен новому значению целиком.
+// Агент передает приращения, и сервер суммирует их, поэтому перезапуск агента счетчик не сбрасывает.
+// Сбросы возникают, когда ряд начинается заново после удаления janitor или восстановления
+// более старого снимка хранилища, а также когда приемники сохраняют накопленное значение
+// счетчика целиком (remote write, cumulative-суммы OTLP, поля-счетчики Influx)
+// и источник перезапустился.
+func Increase(samples []metricModel.Sample) (float64, int) {
+	increase := 0.0
+	resets := 0
+
+	for i := 1; i < len(samples); i++ {
+		prev, cur := sampleValue(samples[i-1]), sampleValue(samples[i])
+		if cur < prev {
+			resets++
+			increase += cur
+			continue
+		}
+		increase += cur - prev
+	}
+
+	return increase, resets
+}
+
+// Rate вычисляет среднюю скорость роста счетчика в секунду между первым и последним отсчетом.
+// Если отсчетов меньше двух, скорость не определена.
+func Rate(samples []metricModel.Sample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+
+	seconds := samples[len(samples)-1].Timestamp.Sub(samples[0].Timestamp).Seconds()
+	if seconds <= 0 {
+		return 0, false
+	}
+
+	increase, _ := Increase(samples)
+	return increase / seconds, true
+}
+
+// Counter вычисляет прирост и скорость роста ряда счетчика с ключом key за окно [end-window, end].
+func Counter(source Source, key string, end time.Time, window time.Duration) (CounterRate, error) {
+	if window <= 0 {
+		return CounterRate{}, errors.New("window must be positive")
+	}
+
+	name, labels, err := metricModel.ParseSeriesKey(key)
+	if err != nil {
+		return CounterRate{}, err
+	}
+
+	samples, err := source.GetRange(key, end.Add(-window), end)
+	if err != nil {
+		return CounterRate{}, fmt.Errorf("failed to get history of %s: %w", key, err)
+	}
+
+	result := CounterRate{Name: name, Labels: labels}
+	result.Increase, result.Resets = Increase(samples)
+	result.Rate, _ = Rate(samples)
+
+	return result, nil
+}
+
+// Counters вычисляет прирост и скорость роста всех рядов счетчика name, удовлетворяющих условиям matchers.
+func Counters(source Source, name string, matchers []*Matcher, end time.Time, window time.Duration) ([]CounterRate, error) {
+	if name == "" {
+		return nil, errors.New("metric name is empty")
+	}
+
+	metrics, keys, err := SelectSeries(source, name, matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]CounterRate, 0, len(keys))
+	for _, key := range keys {
+		if metrics[key].MType != metricModel.MetricTypeCounter {
+			continue
+		}
+
+		rate, err := Counter(source, key, end, window)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, rate)
+	}
+
+	return result, nil
+}
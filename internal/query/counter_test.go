@@ -0,0 +1,88 @@
+package query
+
+import (
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func counterSamples(start time.Time, interval time.Duration, values ...int64) []metricModel.Sample {
+	samples := make([]metricModel.Sample, len(values))
+	for i, v := range values {
+		delta := v
+		samples[i] = metricModel.Sample{Timestamp: start.Add(time.Duration(i) * interval), Delta: &delta}
+	}
+
+	return samples
+}
+
+func TestIncrease(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		values   []int64
+		increase float64
+		resets   int
+	}{
+		{name: "empty", values: nil, increase: 0, resets: 0},
+		{name: "single sample", values: []int64{5}, increase: 0, resets: 0},
+		{name: "monotonic", values: []int64{1, 2, 4, 7}, increase: 6, resets: 0},
+		// Агент перезапустился, и PollCount снова начался с 1
+		{name: "reset", values: []int64{5, 6, 7, 1, 2}, increase: 2 + 1 + 1, resets: 1},
+		{name: "reset to zero", values: []int64{10, 0, 3}, increase: 3, resets: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			increase, resets := Increase(counterSamples(start, 10*time.Second, tt.values...))
+			assert.Equal(t, tt.increase, increase)
+			assert.Equal(t, tt.resets, resets)
+		})
+	}
+}
+
+func TestRate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rate, ok := Rate(counterSamples(start, 10*time.Second, 5, 6, 7, 1, 2))
+	require.True(t, ok)
+	assert.InDelta(t, 4.0/40, rate, 1e-9)
+
+	_, ok = Rate(counterSamples(start, 10*time.Second, 5))
+	assert.False(t, ok)
+}
+
+func TestCounters(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := newFakeSource()
+
+	counter := metricModel.Metric{ID: "PollCount", MType: metricModel.MetricTypeCounter, Labels: map[string]string{"host": "a"}}
+	source.metrics[counter.Key()] = counter
+	source.history[counter.Key()] = counterSamples(start, 10*time.Second, 3, 4, 1, 2)
+
+	gauge := metricModel.Metric{ID: "PollCount", MType: metricModel.MetricTypeGauge, Labels: map[string]string{"host": "b"}}
+	source.add(gauge, start, 10*time.Second, 1, 2)
+
+	counters, err := Counters(source, "PollCount", nil, start.Add(30*time.Second), time.Minute)
+	require.NoError(t, err)
+	require.Len(t, counters, 1)
+
+	assert.Equal(t, "PollCount", counters[0].Name)
+	assert.Equal(t, map[string]string{"host": "a"}, counters[0].Labels)
+	assert.Equal(t, 3.0, counters[0].Increase)
+	assert.Equal(t, 1, counters[0].Resets)
+	assert.InDelta(t, 0.1, counters[0].Rate, 1e-9)
+
+	// Окно захватывает только отсчеты после сброса
+	counters, err = Counters(source, "PollCount", nil, start.Add(30*time.Second), 10*time.Second)
+	require.NoError(t, err)
+	require.Len(t, counters, 1)
+	assert.Equal(t, 1.0, counters[0].Increase)
+	assert.Equal(t, 0, counters[0].Resets)
+
+	_, err = Counters(source, "PollCount", nil, start, 0)
+	assert.Error(t, err)
+}
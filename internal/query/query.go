@@ -0,0 +1,410 @@
+// Package query содержит выполнение запросов к истории значений метрик:
+// выборку рядов по имени и меткам, разбиение периода на шаги и агрегацию отсчетов внутри шага.
+package query
+
+import (
+	"errors"
+	"fmt"
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxPoints - максимальное количество точек в одном ряду ответа.
+// Ограничивает размер ответа при слишком маленьком шаге.
+const MaxPoints = 11000
+
+// DefaultRange - период запроса, если начало периода не задано.
+const DefaultRange = time.Hour
+
+// DefaultStep - шаг запроса, если он не задан.
+const DefaultStep = time.Minute
+
+// Aggregation представляет собой функцию агрегации отсчетов внутри шага.
+type Aggregation string
+
+const (
+	// AggregationAvg - среднее значение отсчетов.
+	AggregationAvg Aggregation = "avg"
+	// AggregationMin - минимальное значение отсчетов.
+	AggregationMin Aggregation = "min"
+	// AggregationMax - максимальное значение отсчетов.
+	AggregationMax Aggregation = "max"
+	// AggregationSum - сумма значений отсчетов.
+	AggregationSum Aggregation = "sum"
+	// AggregationRate - скорость изменения значения в секунду.
+	// Для счетчиков учитываются сбросы, см. Increase.
+	AggregationRate Aggregation = "rate"
+	// AggregationIncrease - прирост значения счетчика за шаг с учетом сбросов.
+	AggregationIncrease Aggregation = "increase"
+	// AggregationLast - последнее значение.
+	AggregationLast Aggregation = "last"
+)
+
+// ParseAggregation возвращает функцию агрегации по ее имени.
+// Пустое имя означает AggregationLast.
+func ParseAggregation(name string) (Aggregation, error) {
+	switch agg := Aggregation(strings.ToLower(name)); agg {
+	case "":
+		return AggregationLast, nil
+	case AggregationAvg, AggregationMin, AggregationMax, AggregationSum, AggregationRate, AggregationIncrease, AggregationLast:
+		return agg, nil
+	default:
+		return "", fmt.Errorf("unknown aggregation %q", name)
+	}
+}
+
+// MatchType представляет собой способ сравнения значения метки.
+type MatchType string
+
+const (
+	// MatchEqual - значение метки равно заданному.
+	MatchEqual MatchType = "="
+	// MatchNotEqual - значение метки не равно заданному.
+	MatchNotEqual MatchType = "!="
+	// MatchRegexp - значение метки полностью соответствует регулярному выражению.
+	MatchRegexp MatchType = "=~"
+	// MatchNotRegexp - значение метки не соответствует регулярному выражению.
+	MatchNotRegexp MatchType = "!~"
+)
+
+// Matcher - условие на значение метки ряда.
+// Отсутствующая у ряда метка считается меткой с пустым значением.
+type Matcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+	re    *regexp.Regexp
+}
+
+// NewMatcher создает условие на значение метки name.
+func NewMatcher(matchType MatchType, name, value string) (*Matcher, error) {
+	if name == "" {
+		return nil, errors.New("label matcher without label name")
+	}
+
+	m := &Matcher{Name: name, Type: matchType, Value: value}
+
+	switch matchType {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp in label matcher %s: %w", name, err)
+		}
+		m.re = re
+	default:
+		return nil, fmt.Errorf("unknown label matcher type %q", matchType)
+	}
+
+	return m, nil
+}
+
+// ParseMatcher разбирает условие вида name=value, name!=value, name=~regexp или name!~regexp.
+// Значение может быть заключено в двойные кавычки.
+func ParseMatcher(s string) (*Matcher, error) {
+	i := strings.IndexAny(s, "=!")
+	if i == -1 {
+		return nil, fmt.Errorf("invalid label matcher %q", s)
+	}
+
+	name := strings.TrimSpace(s[:i])
+	rest := s[i:]
+
+	var matchType MatchType
+	for _, t := range []MatchType{MatchNotEqual, MatchRegexp, MatchNotRegexp, MatchEqual} {
+		if strings.HasPrefix(rest, string(t)) {
+			matchType = t
+			break
+		}
+	}
+
+	if matchType == "" {
+		return nil, fmt.Errorf("invalid label matcher %q", s)
+	}
+
+	value := strings.TrimSpace(rest[len(matchType):])
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		value = value[1 : len(value)-1]
+	}
+
+	return NewMatcher(matchType, name, value)
+}
+
+// Matches сообщает, удовлетворяет ли значение метки условию.
+func (m *Matcher) Matches(value string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	default:
+		return false
+	}
+}
+
+// Request - запрос истории значений метрики.
+type Request struct {
+	// Name - имя метрики.
+	Name string
+	// Matchers - условия на метки рядов метрики. Без условий выбираются все ряды.
+	Matchers []*Matcher
+	// Start, End - период запроса.
+	Start time.Time
+	End   time.Time
+	// Step - шаг между точками ответа. Отсчеты агрегируются в окне (t-Step, t].
+	Step time.Duration
+	// Aggregation - функция агрегации отсчетов внутри шага.
+	Aggregation Aggregation
+}
+
+// Validate проверяет корректность запроса.
+func (r Request) Validate() error {
+	if r.Name == "" {
+		return errors.New("metric name is empty")
+	}
+
+	if r.Step <= 0 {
+		return errors.New("step must be positive")
+	}
+
+	if r.End.Before(r.Start) {
+		return errors.New("end must not be before start")
+	}
+
+	if r.End.Sub(r.Start)/r.Step >= MaxPoints {
+		return fmt.Errorf("too many points per series, maximum is %d", MaxPoints)
+	}
+
+	if _, err := ParseAggregation(string(r.Aggregation)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Point - агрегированное значение ряда в момент времени.
+type Point struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// Series - ряд метрики с точками ответа.
+type Series struct {
+	Name   string                 `json:"name"`
+	Type   metricModel.MetricType `json:"type"`
+	Labels map[string]string      `json:"labels,omitempty"`
+	Points []Point                `json:"points"`
+}
+
+// Source - хранилище, из которого читается история метрик.
+// Реализуется storage.StorageInterface.
+type Source interface {
+	GetAll() (map[string]metricModel.Metric, error)
+	GetRange(name string, from, to time.Time) ([]metricModel.Sample, error)
+}
+
+// Execute выполняет запрос к хранилищу source.
+// Ряды возвращаются отсортированными по ключу, шаги без отсчетов пропускаются.
+func Execute(source Source, req Request) ([]Series, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	agg, _ := ParseAggregation(string(req.Aggregation))
+
+	metrics, keys, err := SelectSeries(source, req.Name, req.Matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Series, 0, len(keys))
+	for _, key := range keys {
+		m := metrics[key]
+
+		// Для rate и increase нужен отсчет перед окном первого шага, поэтому история читается с запасом в шаг
+		samples, err := source.GetRange(key, req.Start.Add(-2*req.Step), req.End)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get history of %s: %w", key, err)
+		}
+
+		result = append(result, Series{
+			Name:   m.ID,
+			Type:   m.MType,
+			Labels: metricModel.CopyLabels(m.Labels),
+			Points: evaluate(samples, req.Start, req.End, req.Step, agg, m.MType == metricModel.MetricTypeCounter),
+		})
+	}
+
+	return result, nil
+}
+
+// SelectSeries возвращает все метрики хранилища и отсортированные ключи рядов метрики name,
+// удовлетворяющих условиям matchers.
+func SelectSeries(source Source, name string, matchers []*Matcher) (map[string]metricModel.Metric, []string, error) {
+	metrics, err := source.GetAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([]string, 0)
+	for key, m := range metrics {
+		if m.ID == name && matchLabels(matchers, m.Labels) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return metrics, keys, nil
+}
+
+func matchLabels(matchers []*Matcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// evaluate вычисляет точки ряда по отсортированным по времени отсчетам samples.
+// counter - является ли ряд счетчиком, для которого rate и increase учитывают сбросы.
+func evaluate(samples []metricModel.Sample, start, end time.Time, step time.Duration, agg Aggregation, counter bool) []Point {
+	points := make([]Point, 0)
+
+	// first - индекс первого отсчета окна, last - индекс первого отсчета после окна
+	first, last := 0, 0
+	for ts := start; !ts.After(end); ts = ts.Add(step) {
+		windowStart := ts.Add(-step)
+
+		for first < len(samples) && !samples[first].Timestamp.After(windowStart) {
+			first++
+		}
+
+		if last < first {
+			last = first
+		}
+
+		for last < len(samples) && !samples[last].Timestamp.After(ts) {
+			last++
+		}
+
+		var prev *metricModel.Sample
+		if first > 0 {
+			prev = &samples[first-1]
+		}
+
+		if value, ok := aggregate(samples[first:last], prev, agg, counter); ok {
+			points = append(points, Point{Timestamp: ts, Value: value})
+		}
+	}
+
+	return points
+}
+
+// aggregate агрегирует отсчеты окна window. prev - последний отсчет перед окном, если он есть.
+func aggregate(window []metricModel.Sample, prev *metricModel.Sample, agg Aggregation, counter bool) (float64, bool) {
+	if len(window) == 0 {
+		return 0, false
+	}
+
+	switch agg {
+	case AggregationAvg, AggregationSum:
+		sum := 0.0
+		for _, s := range window {
+			sum += sampleValue(s)
+		}
+		if agg == AggregationAvg {
+			return sum / float64(len(window)), true
+		}
+		return sum, true
+	case AggregationMin, AggregationMax:
+		result := sampleValue(window[0])
+		for _, s := range window[1:] {
+			v := sampleValue(s)
+			if (agg == AggregationMin && v < result) || (agg == AggregationMax && v > result) {
+				result = v
+			}
+		}
+		return result, true
+	case AggregationRate, AggregationIncrease:
+		samples := window
+		if prev != nil {
+			samples = append([]metricModel.Sample{*prev}, window...)
+		}
+
+		if len(samples) < 2 {
+			return 0, false
+		}
+
+		first, lastSample := samples[0], samples[len(samples)-1]
+		change := sampleValue(lastSample) - sampleValue(first)
+		if counter {
+			change, _ = Increase(samples)
+		}
+
+		if agg == AggregationIncrease {
+			return change, true
+		}
+
+		seconds := lastSample.Timestamp.Sub(first.Timestamp).Seconds()
+		if seconds <= 0 {
+			return 0, false
+		}
+
+		return change / seconds, true
+	default:
+		return sampleValue(window[len(window)-1]), true
+	}
+}
+
+// sampleValue возвращает значение отсчета: Value для gauge и Delta для counter.
+func sampleValue(s metricModel.Sample) float64 {
+	if s.Value != nil {
+		return *s.Value
+	}
+
+	if s.Delta != nil {
+		return float64(*s.Delta)
+	}
+
+	return 0
+}
+
+// ParseTime разбирает время в формате RFC3339 или в секундах Unix (допускается дробная часть).
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*float64(time.Second))), nil
+}
+
+// ParseStep разбирает шаг в формате time.Duration (15s, 1m) или в секундах.
+func ParseStep(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid step %q", s)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
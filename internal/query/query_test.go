@@ -0,0 +1,222 @@
+package query
+
+import (
+	"errors"
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// fakeSource - хранилище с заранее заданной историей рядов.
+type fakeSource struct {
+	metrics map[string]metricModel.Metric
+	history map[string][]metricModel.Sample
+}
+
+func (f *fakeSource) GetAll() (map[string]metricModel.Metric, error) {
+	return f.metrics, nil
+}
+
+func (f *fakeSource) GetRange(name string, from, to time.Time) ([]metricModel.Sample, error) {
+	samples, ok := f.history[name]
+	if !ok {
+		return nil, errors.New("the metric was not found")
+	}
+
+	result := make([]metricModel.Sample, 0)
+	for _, s := range samples {
+		if !s.Timestamp.Before(from) && !s.Timestamp.After(to) {
+			result = append(result, s)
+		}
+	}
+
+	return result, nil
+}
+
+func (f *fakeSource) add(m metricModel.Metric, start time.Time, interval time.Duration, values ...float64) {
+	key := m.Key()
+	f.metrics[key] = m
+
+	for i, v := range values {
+		value := v
+		f.history[key] = append(f.history[key], metricModel.Sample{
+			Timestamp: start.Add(time.Duration(i) * interval),
+			Value:     &value,
+		})
+	}
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		metrics: make(map[string]metricModel.Metric),
+		history: make(map[string][]metricModel.Sample),
+	}
+}
+
+func TestExecute(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := newFakeSource()
+
+	// Отсчеты каждые 10 секунд: 0s, 10s, ..., 50s
+	source.add(metricModel.Metric{ID: "Alloc", MType: metricModel.MetricTypeGauge, Labels: map[string]string{"host": "a"}},
+		start, 10*time.Second, 1, 2, 3, 4, 5, 6)
+	source.add(metricModel.Metric{ID: "Alloc", MType: metricModel.MetricTypeGauge, Labels: map[string]string{"host": "b"}},
+		start, 10*time.Second, 10, 20, 30, 40, 50, 60)
+	source.add(metricModel.Metric{ID: "Other", MType: metricModel.MetricTypeGauge},
+		start, 10*time.Second, 100)
+
+	request := func(agg Aggregation) Request {
+		return Request{
+			Name:        "Alloc",
+			Start:       start.Add(20 * time.Second),
+			End:         start.Add(50 * time.Second),
+			Step:        30 * time.Second,
+			Aggregation: agg,
+		}
+	}
+
+	tests := []struct {
+		agg  Aggregation
+		want []float64
+	}{
+		// Окна (-10s, 20s] и (20s, 50s]
+		{agg: AggregationAvg, want: []float64{2, 5}},
+		{agg: AggregationMin, want: []float64{1, 4}},
+		{agg: AggregationMax, want: []float64{3, 6}},
+		{agg: AggregationSum, want: []float64{6, 15}},
+		{agg: AggregationLast, want: []float64{3, 6}},
+		// В первом окне нет отсчета перед окном, во втором базой служит отсчет 20s
+		{agg: AggregationRate, want: []float64{0.1, 0.1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.agg), func(t *testing.T) {
+			series, err := Execute(source, request(tt.agg))
+			require.NoError(t, err)
+			require.Len(t, series, 2)
+
+			assert.Equal(t, map[string]string{"host": "a"}, series[0].Labels)
+			require.Len(t, series[0].Points, len(tt.want))
+			for i, want := range tt.want {
+				assert.Equal(t, start.Add(20*time.Second+time.Duration(i)*30*time.Second), series[0].Points[i].Timestamp)
+				assert.InDelta(t, want, series[0].Points[i].Value, 1e-9)
+			}
+		})
+	}
+
+	t.Run("counter increase with reset", func(t *testing.T) {
+		counter := metricModel.Metric{ID: "PollCount", MType: metricModel.MetricTypeCounter}
+		source.metrics[counter.Key()] = counter
+		source.history[counter.Key()] = counterSamples(start, 10*time.Second, 1, 2, 3, 1, 2, 3)
+
+		req := request(AggregationIncrease)
+		req.Name = "PollCount"
+
+		series, err := Execute(source, req)
+		require.NoError(t, err)
+		require.Len(t, series, 1)
+		// Окна (-10s, 20s] и (20s, 50s], во втором окне счетчик сброшен после 20s
+		assert.Equal(t, []Point{{Timestamp: start.Add(20 * time.Second), Value: 2}, {Timestamp: start.Add(50 * time.Second), Value: 3}}, series[0].Points)
+	})
+
+	t.Run("label matchers", func(t *testing.T) {
+		matcher, err := ParseMatcher(`host="b"`)
+		require.NoError(t, err)
+
+		req := request(AggregationLast)
+		req.Matchers = []*Matcher{matcher}
+
+		series, err := Execute(source, req)
+		require.NoError(t, err)
+		require.Len(t, series, 1)
+		assert.Equal(t, "b", series[0].Labels["host"])
+		assert.Equal(t, []Point{{Timestamp: start.Add(20 * time.Second), Value: 30}, {Timestamp: start.Add(50 * time.Second), Value: 60}}, series[0].Points)
+	})
+
+	t.Run("steps without samples are skipped", func(t *testing.T) {
+		req := request(AggregationLast)
+		req.Start = start.Add(-time.Minute)
+		req.End = start.Add(-30 * time.Second)
+
+		series, err := Execute(source, req)
+		require.NoError(t, err)
+		require.Len(t, series, 2)
+		assert.Empty(t, series[0].Points)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		req := request(AggregationLast)
+		req.Step = 0
+		_, err := Execute(source, req)
+		assert.Error(t, err)
+
+		req = request(AggregationLast)
+		req.Step = time.Nanosecond
+		_, err = Execute(source, req)
+		assert.Error(t, err)
+
+		req = request("median")
+		_, err = Execute(source, req)
+		assert.Error(t, err)
+	})
+}
+
+func TestParseMatcher(t *testing.T) {
+	tests := []struct {
+		input     string
+		matchType MatchType
+		matches   string
+		rejects   string
+	}{
+		{input: "host=a", matchType: MatchEqual, matches: "a", rejects: "b"},
+		{input: `host!="a"`, matchType: MatchNotEqual, matches: "b", rejects: "a"},
+		{input: "host=~web-.*", matchType: MatchRegexp, matches: "web-1", rejects: "db-web-1"},
+		{input: "host!~web-.*", matchType: MatchNotRegexp, matches: "db-1", rejects: "web-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			m, err := ParseMatcher(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, "host", m.Name)
+			assert.Equal(t, tt.matchType, m.Type)
+			assert.True(t, m.Matches(tt.matches))
+			assert.False(t, m.Matches(tt.rejects))
+		})
+	}
+
+	for _, input := range []string{"host", "=a", "host=~("} {
+		_, err := ParseMatcher(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2024, 1, 1, 0, 0, 0, 500000000, time.UTC)
+
+	parsed, err := ParseTime("2024-01-01T00:00:00.5Z")
+	require.NoError(t, err)
+	assert.True(t, want.Equal(parsed))
+
+	parsed, err = ParseTime("1704067200.5")
+	require.NoError(t, err)
+	assert.True(t, want.Equal(parsed))
+
+	_, err = ParseTime("yesterday")
+	assert.Error(t, err)
+}
+
+func TestParseStep(t *testing.T) {
+	step, err := ParseStep("1m")
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, step)
+
+	step, err = ParseStep("15")
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Second, step)
+
+	_, err = ParseStep("often")
+	assert.Error(t, err)
+}
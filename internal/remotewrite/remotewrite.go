@@ -0,0 +1,199 @@
+// Package remotewrite реализует прием отсчетов по протоколу Prometheus remote write 1.0.
+package remotewrite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage"
+	pb "github.com/dip96/metrics/protobuf/protos/prometheus/prompb"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+)
+
+// staleNaN - битовое представление значения, которым Prometheus отмечает исчезнувший ряд.
+// Это отдельное значение NaN, обычный NaN маркером не является.
+const staleNaN uint64 = 0x7ff0000000000002
+
+// IsStaleMarker сообщает, является ли значение маркером устаревания ряда.
+func IsStaleMarker(v float64) bool {
+	return math.Float64bits(v) == staleNaN
+}
+
+// Decode распаковывает тело запроса remote write (protobuf WriteRequest, сжатый snappy в блочном формате).
+func Decode(body []byte) (*pb.WriteRequest, error) {
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress snappy body: %w", err)
+	}
+
+	req := &pb.WriteRequest{}
+	if err := proto.Unmarshal(data, req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal write request: %w", err)
+	}
+
+	return req, nil
+}
+
+// Batch - результат преобразования запроса remote write.
+type Batch struct {
+	// Metrics - отсчеты рядов в порядке возрастания времени.
+	Metrics []metricModel.Metric
+}
+
+// Receiver преобразует запросы remote write в метрики и сохраняет их в хранилище.
+// Типы семейств из метаданных запоминаются: Prometheus отправляет метаданные
+// отдельными запросами, без отсчетов.
+type Receiver struct {
+	storage storage.StorageInterface
+
+	mu    sync.RWMutex
+	types map[string]pb.MetricMetadata_MetricType
+}
+
+// NewReceiver создает приемник remote write, сохраняющий метрики в store.
+func NewReceiver(store storage.StorageInterface) *Receiver {
+	return &Receiver{
+		storage: store,
+		types:   make(map[string]pb.MetricMetadata_MetricType),
+	}
+}
+
+// Convert преобразует ряды запроса в метрики.
+// Имя метрики берется из метки __name__, остальные непустые метки становятся метками метрики.
+// Каждый отсчет ряда становится отдельной метрикой со своим временем, см. metricModel.Metric.Timestamp.
+// Маркеры устаревания пропускаются: ряд перестает обновляться, а его история и агрегаты
+// сохраняются, пока ряд не удалит janitor по истечении срока хранения.
+// Ряд сохраняется как counter, если по метаданным он является счетчиком
+// (или бакетом и количеством наблюдений гистограммы или summary),
+// а без метаданных - если его имя оканчивается на _total. Остальные ряды сохраняются как gauge.
+func (r *Receiver) Convert(req *pb.WriteRequest) (*Batch, error) {
+	r.mu.Lock()
+	for _, md := range req.GetMetadata() {
+		if md.GetMetricFamilyName() != "" {
+			r.types[md.GetMetricFamilyName()] = md.GetType()
+		}
+	}
+	r.mu.Unlock()
+
+	batch := &Batch{}
+
+	for _, ts := range req.GetTimeseries() {
+		if len(ts.GetSamples()) == 0 {
+			continue
+		}
+
+		name, labels := splitLabels(ts.GetLabels())
+		if name == "" {
+			return nil, errors.New("the series has no __name__ label")
+		}
+		isCounter := r.isCounter(name)
+
+		for _, sample := range ts.GetSamples() {
+			if IsStaleMarker(sample.GetValue()) {
+				continue
+			}
+
+			timestamp := time.UnixMilli(sample.GetTimestamp())
+			m := metricModel.Metric{ID: name, Labels: labels, Timestamp: &timestamp}
+
+			value := sample.GetValue()
+			if isCounter {
+				if value < 0 || value >= math.MaxInt64 || math.IsNaN(value) {
+					return nil, fmt.Errorf("invalid counter value %v of %s", value, m.Key())
+				}
+				delta := int64(math.Round(value))
+				m.MType = metricModel.MetricTypeCounter
+				m.Delta = &delta
+			} else {
+				m.MType = metricModel.MetricTypeGauge
+				m.Value = &value
+			}
+
+			batch.Metrics = append(batch.Metrics, m)
+		}
+	}
+
+	// Хранилище отклоняет отсчеты старше последнего обновления ряда
+	metricModel.SortByTimestamp(batch.Metrics)
+
+	return batch, nil
+}
+
+// Save сохраняет отсчеты рядов.
+// Если часть отсчетов старше последнего обновления своего ряда, остальные отсчеты сохраняются,
+// а возвращается ошибка storage.ErrOutOfOrder с количеством отклоненных отсчетов.
+func (r *Receiver) Save(batch *Batch) error {
+	if len(batch.Metrics) == 0 {
+		return nil
+	}
+
+	written, err := r.storage.Append(batch.Metrics)
+	if err != nil {
+		return fmt.Errorf("failed to save metrics: %w", err)
+	}
+
+	if rejected := len(batch.Metrics) - len(written); rejected > 0 {
+		return fmt.Errorf("%w: %d of %d samples rejected", storage.ErrOutOfOrder, rejected, len(batch.Metrics))
+	}
+
+	return nil
+}
+
+func (r *Receiver) isCounter(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if t, ok := r.types[name]; ok && t != pb.MetricMetadata_UNKNOWN {
+		return t == pb.MetricMetadata_COUNTER
+	}
+
+	for _, suffix := range []string{"_total", "_bucket", "_count"} {
+		family, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+
+		switch r.types[family] {
+		case pb.MetricMetadata_COUNTER:
+			return suffix == "_total"
+		case pb.MetricMetadata_HISTOGRAM, pb.MetricMetadata_SUMMARY:
+			return suffix != "_total"
+		}
+	}
+
+	_, hasMetadata := r.types[strings.TrimSuffix(name, "_total")]
+	return strings.HasSuffix(name, "_total") && !hasMetadata
+}
+
+// splitLabels возвращает значение метки __name__ и остальные непустые метки.
+func splitLabels(pbLabels []*pb.Label) (string, map[string]string) {
+	var (
+		name   string
+		labels map[string]string
+	)
+
+	for _, l := range pbLabels {
+		if l.GetName() == "__name__" {
+			name = l.GetValue()
+			continue
+		}
+
+		// В Prometheus метка с пустым значением равнозначна отсутствующей
+		if l.GetValue() == "" {
+			continue
+		}
+
+		if labels == nil {
+			labels = make(map[string]string, len(pbLabels))
+		}
+		labels[l.GetName()] = l.GetValue()
+	}
+
+	return name, labels
+}
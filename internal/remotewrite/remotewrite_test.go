@@ -0,0 +1,150 @@
+package remotewrite
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage"
+	memStorage "github.com/dip96/metrics/internal/storage/mem"
+	pb "github.com/dip96/metrics/protobuf/protos/prometheus/prompb"
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func series(name string, samples ...*pb.Sample) *pb.TimeSeries {
+	return &pb.TimeSeries{
+		Labels:  []*pb.Label{{Name: "__name__", Value: name}, {Name: "job", Value: "node"}, {Name: "empty", Value: ""}},
+		Samples: samples,
+	}
+}
+
+func TestDecode(t *testing.T) {
+	data, err := proto.Marshal(&pb.WriteRequest{Timeseries: []*pb.TimeSeries{series("up", &pb.Sample{Value: 1, Timestamp: 1000})}})
+	require.NoError(t, err)
+
+	req, err := Decode(snappy.Encode(nil, data))
+	require.NoError(t, err)
+	require.Len(t, req.GetTimeseries(), 1)
+	assert.Equal(t, 1.0, req.GetTimeseries()[0].GetSamples()[0].GetValue())
+
+	// Тело без сжатия snappy отклоняется
+	_, err = Decode(data)
+	assert.Error(t, err)
+}
+
+func TestConvert(t *testing.T) {
+	r := NewReceiver(memStorage.NewStorage())
+	labels := map[string]string{"job": "node"}
+
+	// Метаданные приходят отдельным запросом
+	_, err := r.Convert(&pb.WriteRequest{Metadata: []*pb.MetricMetadata{
+		{Type: pb.MetricMetadata_COUNTER, MetricFamilyName: "cpu_seconds"},
+		{Type: pb.MetricMetadata_HISTOGRAM, MetricFamilyName: "duration"},
+		{Type: pb.MetricMetadata_GAUGE, MetricFamilyName: "queue_total"},
+	}})
+	require.NoError(t, err)
+
+	batch, err := r.Convert(&pb.WriteRequest{Timeseries: []*pb.TimeSeries{
+		series("temperature", &pb.Sample{Value: 20, Timestamp: 2000}, &pb.Sample{Value: 21.5, Timestamp: 3000}, &pb.Sample{Value: 19, Timestamp: 1000}),
+		series("requests_total", &pb.Sample{Value: 7, Timestamp: 1000}),
+		series("cpu_seconds_total", &pb.Sample{Value: 12.4, Timestamp: 1000}),
+		series("duration_bucket", &pb.Sample{Value: 3, Timestamp: 1000}),
+		series("duration_sum", &pb.Sample{Value: 0.75, Timestamp: 1000}),
+		series("queue_total", &pb.Sample{Value: 4, Timestamp: 1000}),
+		series("gone", &pb.Sample{Value: 1, Timestamp: 1000}, &pb.Sample{Value: math.Float64frombits(staleNaN), Timestamp: 2000}),
+	}})
+	require.NoError(t, err)
+
+	// Каждый отсчет сохраняется отдельно в порядке времени, маркер устаревания пропускается
+	metrics := make(map[string][]metricModel.Metric)
+	for i, m := range batch.Metrics {
+		if i > 0 {
+			assert.False(t, m.Timestamp.Before(*batch.Metrics[i-1].Timestamp))
+		}
+		metrics[m.Key()] = append(metrics[m.Key()], m)
+	}
+	require.Len(t, batch.Metrics, 9)
+	require.Len(t, metrics, 7)
+	require.Len(t, metrics[metricModel.SeriesKey("gone", labels)], 1)
+
+	temperature := metrics[metricModel.SeriesKey("temperature", labels)]
+	require.Len(t, temperature, 3)
+	for i, want := range []float64{19, 20, 21.5} {
+		assert.Equal(t, metricModel.MetricTypeGauge, temperature[i].MType)
+		assert.Equal(t, want, *temperature[i].Value)
+		assert.Equal(t, time.UnixMilli(int64(i+1)*1000), *temperature[i].Timestamp)
+		assert.Equal(t, labels, temperature[i].Labels)
+	}
+
+	for name, want := range map[string]int64{"requests_total": 7, "cpu_seconds_total": 12, "duration_bucket": 3} {
+		m := metrics[metricModel.SeriesKey(name, labels)][0]
+		assert.Equal(t, metricModel.MetricTypeCounter, m.MType, name)
+		assert.Equal(t, want, *m.Delta, name)
+	}
+
+	for _, name := range []string{"duration_sum", "queue_total"} {
+		assert.Equal(t, metricModel.MetricTypeGauge, metrics[metricModel.SeriesKey(name, labels)][0].MType, name)
+	}
+
+	// Обычный NaN не является маркером устаревания
+	assert.False(t, IsStaleMarker(math.NaN()))
+
+	_, err = r.Convert(&pb.WriteRequest{Timeseries: []*pb.TimeSeries{{Samples: []*pb.Sample{{Value: 1}}}}})
+	assert.Error(t, err)
+
+	_, err = r.Convert(&pb.WriteRequest{Timeseries: []*pb.TimeSeries{series("errors_total", &pb.Sample{Value: -1})}})
+	assert.Error(t, err)
+}
+
+func TestSave(t *testing.T) {
+	store := memStorage.NewStorage()
+	r := NewReceiver(store)
+	key := metricModel.SeriesKey("up", map[string]string{"job": "node"})
+	now := time.Now()
+
+	batch, err := r.Convert(&pb.WriteRequest{Timeseries: []*pb.TimeSeries{series("up",
+		&pb.Sample{Value: 1, Timestamp: now.Add(-2 * time.Minute).UnixMilli()},
+		&pb.Sample{Value: 0, Timestamp: now.Add(-time.Minute).UnixMilli()},
+	)}})
+	require.NoError(t, err)
+	require.NoError(t, r.Save(batch))
+
+	// Все отсчеты записаны в историю со своим временем
+	up, err := store.Get(key)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, *up.Value)
+
+	history, err := store.GetRange(key, now.Add(-time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, now.Add(-2*time.Minute).UnixMilli(), history[0].Timestamp.UnixMilli())
+	assert.Equal(t, 1.0, *history[0].Value)
+
+	batch, err = r.Convert(&pb.WriteRequest{Timeseries: []*pb.TimeSeries{series("up", &pb.Sample{Value: math.Float64frombits(staleNaN), Timestamp: now.UnixMilli()})}})
+	require.NoError(t, err)
+	require.NoError(t, r.Save(batch))
+
+	// Маркер устаревания не удаляет ряд и его историю
+	up, err = store.Get(key)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, *up.Value)
+
+	// Отсчет старше последнего отсчета ряда отклоняется, остальные сохраняются
+	batch, err = r.Convert(&pb.WriteRequest{Timeseries: []*pb.TimeSeries{
+		series("up", &pb.Sample{Value: 1, Timestamp: now.Add(-90 * time.Second).UnixMilli()}),
+		series("down", &pb.Sample{Value: 1, Timestamp: now.UnixMilli()}),
+	}})
+	require.NoError(t, err)
+	assert.ErrorIs(t, r.Save(batch), storage.ErrOutOfOrder)
+
+	history, err = store.GetRange(key, now.Add(-time.Hour), now)
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	_, err = store.Get(metricModel.SeriesKey("down", map[string]string{"job": "node"}))
+	assert.NoError(t, err)
+}
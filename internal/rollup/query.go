@@ -0,0 +1,126 @@
+package rollup
+
+import (
+	"fmt"
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/query"
+	"time"
+)
+
+// Result - ответ на запрос истории по агрегатам.
+type Result struct {
+	// Resolution - длина окна уровня в секундах, по которому построен ответ.
+	// 0 - ответ построен по исходным отсчетам.
+	Resolution int64          `json:"resolution"`
+	Series     []query.Series `json:"series"`
+}
+
+// TierFor возвращает самый грубый уровень, длина окна которого не превышает шаг step.
+// Если такого уровня нет, возвращает false.
+func (r *Roller) TierFor(step time.Duration) (Tier, bool) {
+	for i := len(r.tiers) - 1; i >= 0; i-- {
+		if r.tiers[i].Resolution <= step {
+			return r.tiers[i], true
+		}
+	}
+
+	return Tier{}, false
+}
+
+// Query выполняет запрос истории по самому грубому уровню, подходящему к шагу запроса.
+// Если шаг меньше окна самого детального уровня, запрос выполняется по исходным отсчетам source.
+// Рост (rate и increase) для gauge считается как изменение значения, для counter - с учетом сбросов.
+func (r *Roller) Query(source query.Source, req query.Request) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return Result{}, err
+	}
+
+	tier, ok := r.TierFor(req.Step)
+	if !ok {
+		series, err := query.Execute(source, req)
+		if err != nil {
+			return Result{}, err
+		}
+		return Result{Series: series}, nil
+	}
+
+	agg, _ := query.ParseAggregation(string(req.Aggregation))
+
+	metrics, keys, err := query.SelectSeries(source, req.Name, req.Matchers)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Resolution: int64(tier.Resolution / time.Second), Series: make([]query.Series, 0, len(keys))}
+	for _, key := range keys {
+		m := metrics[key]
+
+		// Окно агрегата заканчивается в пределах шага, поэтому агрегаты читаются с запасом в шаг
+		rollups, err := r.store.GetRollups(key, tier.Resolution, req.Start.Add(-req.Step), req.End)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to get rollups of %s: %w", key, err)
+		}
+
+		result.Series = append(result.Series, query.Series{
+			Name:   m.ID,
+			Type:   m.MType,
+			Labels: metricModel.CopyLabels(m.Labels),
+			Points: evaluate(rollups, tier.Resolution, req.Start, req.End, req.Step, agg),
+		})
+	}
+
+	return result, nil
+}
+
+// evaluate вычисляет точки ряда по отсортированным по времени агрегатам rollups с длиной окна resolution.
+// Агрегат относится к шагу t, если его окно заканчивается в (t-step, t].
+func evaluate(rollups []metricModel.Rollup, resolution time.Duration, start, end time.Time, step time.Duration, agg query.Aggregation) []query.Point {
+	points := make([]query.Point, 0)
+
+	first := 0
+	for ts := start; !ts.After(end); ts = ts.Add(step) {
+		windowStart := ts.Add(-step)
+
+		for first < len(rollups) && !rollups[first].Start.Add(resolution).After(windowStart) {
+			first++
+		}
+
+		last := first
+		for last < len(rollups) && !rollups[last].Start.Add(resolution).After(ts) {
+			last++
+		}
+
+		if last == first {
+			continue
+		}
+
+		points = append(points, query.Point{Timestamp: ts, Value: aggregate(rollups[first:last], step, agg)})
+	}
+
+	return points
+}
+
+// aggregate агрегирует непустой набор агрегатов window, попавших в шаг step.
+func aggregate(window []metricModel.Rollup, step time.Duration, agg query.Aggregation) float64 {
+	total := window[0]
+	for _, rollup := range window[1:] {
+		total.Merge(rollup)
+	}
+
+	switch agg {
+	case query.AggregationAvg:
+		return total.Sum / float64(total.Count)
+	case query.AggregationMin:
+		return total.Min
+	case query.AggregationMax:
+		return total.Max
+	case query.AggregationSum:
+		return total.Sum
+	case query.AggregationIncrease:
+		return total.Increase
+	case query.AggregationRate:
+		return total.Increase / step.Seconds()
+	default:
+		return total.Last
+	}
+}
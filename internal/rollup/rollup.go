@@ -0,0 +1,295 @@
+// Package rollup содержит прореживание истории значений метрик.
+//
+// Каждое записанное значение учитывается в агрегатах фиксированных окон нескольких уровней
+// (по умолчанию 1m, 10m и 1h): min/max/sum/count для gauge и last/increase для counter.
+// Агрегаты считаются инкрементально в памяти и периодически дописываются в хранилище,
+// поэтому после перезапуска сервера теряются только не сохраненные изменения.
+// Уровни хранятся дольше исходных отсчетов и позволяют дешево читать историю за месяцы.
+package rollup
+
+import (
+	"fmt"
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FlushInterval - интервал сохранения накопленных агрегатов в хранилище.
+const FlushInterval = 10 * time.Second
+
+// Tier - уровень прореживания.
+type Tier struct {
+	// Resolution - длина окна агрегации.
+	Resolution time.Duration
+	// Retention - время хранения агрегатов уровня.
+	Retention time.Duration
+}
+
+// DefaultTiers - уровни прореживания по умолчанию, от самого детального к самому грубому.
+var DefaultTiers = []Tier{
+	{Resolution: time.Minute, Retention: 7 * 24 * time.Hour},
+	{Resolution: 10 * time.Minute, Retention: 30 * 24 * time.Hour},
+	{Resolution: time.Hour, Retention: 365 * 24 * time.Hour},
+}
+
+// Store - хранилище агрегатов.
+// Реализуется хранилищами mem и postgres.
+type Store interface {
+	// AddRollups дописывает агрегаты уровня resolution, объединяя их с уже сохраненными
+	// агрегатами тех же окон (см. metricModel.Rollup.Merge).
+	AddRollups(resolution time.Duration, rollups []metricModel.Rollup) error
+	// GetRollups возвращает агрегаты ряда key уровня resolution,
+	// окна которых начинаются в период [from, to], в порядке возрастания времени.
+	GetRollups(key string, resolution time.Duration, from, to time.Time) ([]metricModel.Rollup, error)
+	// DeleteRollups удаляет агрегаты уровня resolution, окна которых начались раньше before.
+	DeleteRollups(resolution time.Duration, before time.Time) error
+}
+
+// SampleStore - хранилище исходных отсчетов, которые Roller удаляет по истечении времени хранения.
+// Реализуется хранилищами mem и postgres.
+type SampleStore interface {
+	// DeleteSamples удаляет отсчеты истории, записанные раньше before.
+	DeleteSamples(before time.Time) error
+}
+
+// series - состояние ряда, агрегаты которого еще не сохранены.
+type series struct {
+	// prev - последнее значение ряда для расчета прироста.
+	prev *float64
+	// pending - агрегат текущего окна по длине окна уровня.
+	pending map[time.Duration]*metricModel.Rollup
+}
+
+// Roller считает агрегаты уровней по мере поступления значений.
+type Roller struct {
+	tiers []Tier
+	store Store
+	// sampleRetention - время хранения исходных отсчетов, 0 - отсчеты не удаляются.
+	sampleRetention time.Duration
+
+	mu     sync.Mutex
+	series map[string]*series
+	// closed - агрегаты закрытых окон, ожидающие сохранения, по длине окна уровня.
+	closed map[time.Duration][]metricModel.Rollup
+}
+
+// NewRoller создает Roller для уровней tiers с сохранением агрегатов в store.
+// Если store реализует SampleStore и sampleRetention больше нуля,
+// исходные отсчеты старше sampleRetention удаляются вместе с устаревшими агрегатами.
+func NewRoller(tiers []Tier, store Store, sampleRetention time.Duration) (*Roller, error) {
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("no rollup tiers")
+	}
+
+	sorted := append([]Tier(nil), tiers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Resolution < sorted[j].Resolution })
+
+	for _, tier := range sorted {
+		if tier.Resolution <= 0 {
+			return nil, fmt.Errorf("rollup resolution must be positive, got %s", tier.Resolution)
+		}
+	}
+
+	return &Roller{
+		tiers:           sorted,
+		store:           store,
+		sampleRetention: sampleRetention,
+		series:          make(map[string]*series),
+		closed:          make(map[time.Duration][]metricModel.Rollup),
+	}, nil
+}
+
+// Tiers возвращает уровни прореживания в порядке возрастания длины окна.
+func (r *Roller) Tiers() []Tier {
+	return append([]Tier(nil), r.tiers...)
+}
+
+// sampleValue возвращает значение метрики m, учитываемое в агрегатах.
+func sampleValue(m metricModel.Metric) (float64, bool) {
+	switch {
+	case m.Value != nil:
+		return *m.Value, true
+	case m.Delta != nil:
+		return float64(*m.Delta), true
+	default:
+		return 0, false
+	}
+}
+
+// Seed задает последнее значение ряда метрики m, от которого считается прирост следующего значения,
+// например для значений, сохраненных до перезапуска сервера. Само значение в агрегатах не учитывается.
+// Если значение ряда уже известно, Seed ничего не делает.
+func (r *Roller) Seed(m metricModel.Metric) {
+	value, ok := sampleValue(m)
+	if !ok {
+		return
+	}
+
+	key := m.Key()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.series[key]
+	if !ok {
+		s = &series{pending: make(map[time.Duration]*metricModel.Rollup)}
+		r.series[key] = s
+	}
+
+	if s.prev == nil {
+		s.prev = &value
+	}
+}
+
+// Add учитывает значение метрики m, записанное в момент ts.
+func (r *Roller) Add(m metricModel.Metric, ts time.Time) {
+	value, ok := sampleValue(m)
+	if !ok {
+		return
+	}
+
+	key := m.Key()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.series[key]
+	if !ok {
+		s = &series{pending: make(map[time.Duration]*metricModel.Rollup)}
+		r.series[key] = s
+	}
+
+	increase := 0.0
+	if s.prev != nil {
+		increase = value - *s.prev
+		// Уменьшение счетчика считается сбросом, прирост после сброса равен новому значению
+		if m.MType == metricModel.MetricTypeCounter && value < *s.prev {
+			increase = value
+		}
+	}
+	s.prev = &value
+
+	for _, tier := range r.tiers {
+		start := ts.Truncate(tier.Resolution)
+
+		pending := s.pending[tier.Resolution]
+		if pending != nil && !pending.Start.Equal(start) {
+			r.closed[tier.Resolution] = append(r.closed[tier.Resolution], *pending)
+			pending = nil
+		}
+
+		if pending == nil {
+			pending = &metricModel.Rollup{}
+			s.pending[tier.Resolution] = pending
+		}
+
+		pending.Merge(metricModel.Rollup{
+			Series:   key,
+			Start:    start,
+			Min:      value,
+			Max:      value,
+			Sum:      value,
+			Count:    1,
+			Last:     value,
+			Increase: increase,
+		})
+	}
+}
+
+// Forget удаляет состояние рядов keys, например после удаления устаревших рядов.
+// Не сохраненные агрегаты этих рядов теряются.
+func (r *Roller) Forget(keys []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	forgotten := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		delete(r.series, key)
+		forgotten[key] = true
+	}
+
+	for resolution, rollups := range r.closed {
+		kept := rollups[:0]
+		for _, rollup := range rollups {
+			if !forgotten[rollup.Series] {
+				kept = append(kept, rollup)
+			}
+		}
+		r.closed[resolution] = kept
+	}
+}
+
+// Flush сохраняет в хранилище накопленные агрегаты, включая агрегаты еще не закрытых окон.
+// Следующие значения тех же окон будут объединены с сохраненными агрегатами.
+func (r *Roller) Flush() error {
+	r.mu.Lock()
+	batches := r.closed
+	r.closed = make(map[time.Duration][]metricModel.Rollup)
+
+	for _, s := range r.series {
+		for resolution, pending := range s.pending {
+			batches[resolution] = append(batches[resolution], *pending)
+			delete(s.pending, resolution)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, tier := range r.tiers {
+		rollups := batches[tier.Resolution]
+		if len(rollups) == 0 {
+			continue
+		}
+
+		if err := r.store.AddRollups(tier.Resolution, rollups); err != nil {
+			return fmt.Errorf("failed to save %s rollups: %w", tier.Resolution, err)
+		}
+	}
+
+	return nil
+}
+
+// Prune удаляет агрегаты, вышедшие за время хранения своего уровня на момент now,
+// и исходные отсчеты старше времени их хранения.
+func (r *Roller) Prune(now time.Time) error {
+	if samples, ok := r.store.(SampleStore); ok && r.sampleRetention > 0 {
+		if err := samples.DeleteSamples(now.Add(-r.sampleRetention)); err != nil {
+			return fmt.Errorf("failed to prune samples: %w", err)
+		}
+	}
+
+	for _, tier := range r.tiers {
+		if tier.Retention <= 0 {
+			continue
+		}
+
+		if err := r.store.DeleteRollups(tier.Resolution, now.Add(-tier.Retention)); err != nil {
+			return fmt.Errorf("failed to prune %s rollups: %w", tier.Resolution, err)
+		}
+	}
+
+	return nil
+}
+
+// Run периодически сохраняет агрегаты и удаляет устаревшие до закрытия канала stop.
+// Агрегаты, накопленные после последнего сохранения, нужно сохранить вызовом Flush до закрытия хранилища.
+func (r *Roller) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if err := r.Flush(); err != nil {
+				log.Errorln(err)
+			}
+
+			if err := r.Prune(now); err != nil {
+				log.Errorln(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package rollup
+
+import (
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/query"
+	"github.com/dip96/metrics/internal/storage/mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testTiers = []Tier{
+	{Resolution: 10 * time.Minute, Retention: 30 * 24 * time.Hour},
+	{Resolution: time.Minute, Retention: time.Hour},
+}
+
+func gauge(value float64) metricModel.Metric {
+	return metricModel.Metric{ID: "Alloc", MType: metricModel.MetricTypeGauge, Value: &value, Labels: map[string]string{"host": "a"}}
+}
+
+func counter(delta int64) metricModel.Metric {
+	return metricModel.Metric{ID: "PollCount", MType: metricModel.MetricTypeCounter, Delta: &delta}
+}
+
+func TestRollerFlush(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := mem.NewStorage()
+
+	roller, err := NewRoller(testTiers, store, 0)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, roller.Tiers()[0].Resolution)
+
+	// Отсчеты каждые 20 секунд в течение двух минут
+	for i, v := range []float64{1, 5, 3, 2, 4, 6} {
+		roller.Add(gauge(v), start.Add(time.Duration(i)*20*time.Second))
+	}
+	require.NoError(t, roller.Flush())
+
+	rollups, err := store.GetRollups(gauge(0).Key(), time.Minute, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 2)
+	assert.Equal(t, metricModel.Rollup{Series: gauge(0).Key(), Start: start, Min: 1, Max: 5, Sum: 9, Count: 3, Last: 3, Increase: 2}, rollups[0])
+	assert.Equal(t, metricModel.Rollup{Series: gauge(0).Key(), Start: start.Add(time.Minute), Min: 2, Max: 6, Sum: 12, Count: 3, Last: 6, Increase: 3}, rollups[1])
+
+	// Значения того же окна после сохранения объединяются с сохраненным агрегатом
+	roller.Add(gauge(10), start.Add(110*time.Second))
+	require.NoError(t, roller.Flush())
+
+	rollups, err = store.GetRollups(gauge(0).Key(), 10*time.Minute, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.Equal(t, metricModel.Rollup{Series: gauge(0).Key(), Start: start, Min: 1, Max: 10, Sum: 31, Count: 7, Last: 10, Increase: 9}, rollups[0])
+
+	t.Run("counter reset", func(t *testing.T) {
+		for i, v := range []int64{5, 7, 2, 4} {
+			roller.Add(counter(v), start.Add(time.Duration(i)*20*time.Second))
+		}
+		require.NoError(t, roller.Flush())
+
+		rollups, err := store.GetRollups(counter(0).Key(), time.Minute, start, start.Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, rollups, 2)
+		// После сброса прирост равен новому значению: (7-5) + 2
+		assert.Equal(t, 4.0, rollups[0].Increase)
+		assert.Equal(t, 2.0, rollups[0].Last)
+		// Прирост учитывает последнее значение предыдущего окна
+		assert.Equal(t, 2.0, rollups[1].Increase)
+		assert.Equal(t, 4.0, rollups[1].Last)
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		require.NoError(t, roller.Prune(start.Add(2*time.Hour)))
+
+		rollups, err := store.GetRollups(gauge(0).Key(), time.Minute, start, start.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Empty(t, rollups)
+
+		rollups, err = store.GetRollups(gauge(0).Key(), 10*time.Minute, start, start.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Len(t, rollups, 1)
+	})
+}
+
+func TestRollerSeed(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := mem.NewStorage()
+
+	roller, err := NewRoller(testTiers, store, 0)
+	require.NoError(t, err)
+	rolled := NewStorage(store, roller)
+
+	// Значение из снимка задает начало отсчета прироста, но само не учитывается
+	restored := counter(10)
+	restored.UpdatedAt = &start
+	require.NoError(t, rolled.Set(restored))
+	roller.Seed(counter(3))
+
+	roller.Add(counter(15), start.Add(time.Minute))
+	require.NoError(t, roller.Flush())
+
+	rollups, err := store.GetRollups(counter(0).Key(), time.Minute, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.Equal(t, metricModel.Rollup{Series: counter(0).Key(), Start: start.Add(time.Minute), Min: 15, Max: 15, Sum: 15, Count: 1, Last: 15, Increase: 5}, rollups[0])
+}
+
+func TestRollerPruneSamples(t *testing.T) {
+	store := mem.NewStorage()
+	require.NoError(t, store.Set(gauge(1)))
+
+	roller, err := NewRoller(testTiers, store, time.Hour)
+	require.NoError(t, err)
+
+	history := func() []metricModel.Sample {
+		samples, err := store.GetRange(gauge(0).Key(), time.Time{}, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		return samples
+	}
+
+	// Отсчет младше времени хранения сохраняется
+	require.NoError(t, roller.Prune(time.Now()))
+	assert.Len(t, history(), 1)
+
+	require.NoError(t, roller.Prune(time.Now().Add(2*time.Hour)))
+	assert.Empty(t, history())
+
+	// Текущее значение ряда при этом не удаляется
+	_, err = store.Get(gauge(0).Key())
+	assert.NoError(t, err)
+}
+
+func TestRollerQuery(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := mem.NewStorage()
+	require.NoError(t, store.Set(gauge(0)))
+
+	roller, err := NewRoller(testTiers, store, 0)
+	require.NoError(t, err)
+
+	// Значение растет на 1 каждую минуту в течение часа
+	for i := 0; i < 60; i++ {
+		roller.Add(gauge(float64(i)), start.Add(time.Duration(i)*time.Minute))
+	}
+	require.NoError(t, roller.Flush())
+
+	tier, ok := roller.TierFor(15 * time.Minute)
+	require.True(t, ok)
+	assert.Equal(t, 10*time.Minute, tier.Resolution)
+
+	_, ok = roller.TierFor(30 * time.Second)
+	assert.False(t, ok)
+
+	request := func(agg query.Aggregation) query.Request {
+		return query.Request{
+			Name:        "Alloc",
+			Start:       start.Add(20 * time.Minute),
+			End:         start.Add(40 * time.Minute),
+			Step:        20 * time.Minute,
+			Aggregation: agg,
+		}
+	}
+
+	tests := []struct {
+		agg  query.Aggregation
+		want []float64
+	}{
+		// Окна 10m: [0, 10m) и [10m, 20m) попадают в первый шаг, [20m, 30m) и [30m, 40m) - во второй
+		{agg: query.AggregationAvg, want: []float64{9.5, 29.5}},
+		{agg: query.AggregationMin, want: []float64{0, 20}},
+		{agg: query.AggregationMax, want: []float64{19, 39}},
+		{agg: query.AggregationLast, want: []float64{19, 39}},
+		{agg: query.AggregationIncrease, want: []float64{19, 20}},
+		{agg: query.AggregationRate, want: []float64{19.0 / 1200, 20.0 / 1200}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.agg), func(t *testing.T) {
+			result, err := roller.Query(store, request(tt.agg))
+			require.NoError(t, err)
+			assert.Equal(t, int64(600), result.Resolution)
+			require.Len(t, result.Series, 1)
+			assert.Equal(t, map[string]string{"host": "a"}, result.Series[0].Labels)
+
+			points := result.Series[0].Points
+			require.Len(t, points, len(tt.want))
+			for i, want := range tt.want {
+				assert.Equal(t, start.Add(time.Duration(i+1)*20*time.Minute), points[i].Timestamp)
+				assert.InDelta(t, want, points[i].Value, 1e-9)
+			}
+		})
+	}
+
+	t.Run("raw samples for small step", func(t *testing.T) {
+		req := request(query.AggregationLast)
+		req.Step = 30 * time.Second
+		req.Start = time.Now().Add(-time.Minute)
+		req.End = time.Now()
+
+		result, err := roller.Query(store, req)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), result.Resolution)
+		require.Len(t, result.Series, 1)
+		assert.NotEmpty(t, result.Series[0].Points)
+	})
+}
+
+func TestStorage(t *testing.T) {
+	store := mem.NewStorage()
+	roller, err := NewRoller(testTiers, store, 0)
+	require.NoError(t, err)
+
+	rolled := NewStorage(store, roller)
+	require.NoError(t, rolled.Set(gauge(1)))
+	require.NoError(t, rolled.SetAll(map[string]metricModel.Metric{gauge(0).Key(): gauge(3)}))
+	_, err = rolled.Increment(counter(2))
+	require.NoError(t, err)
+	_, err = rolled.Increment(counter(2))
+	require.NoError(t, err)
+
+	// Восстановленные из снимка значения не учитываются
+	restored := gauge(100)
+	updatedAt := time.Now()
+	restored.UpdatedAt = &updatedAt
+	require.NoError(t, rolled.Set(restored))
+
+	require.NoError(t, roller.Flush())
+
+	from, to := time.Now().Add(-time.Hour), time.Now()
+	rollups, err := store.GetRollups(gauge(0).Key(), time.Minute, from, to)
+	require.NoError(t, err)
+	require.NotEmpty(t, rollups)
+	assert.Equal(t, 3.0, rollups[len(rollups)-1].Last)
+	assert.Equal(t, 1.0, rollups[0].Min)
+
+	rollups, err = store.GetRollups(counter(0).Key(), time.Minute, from, to)
+	require.NoError(t, err)
+	require.NotEmpty(t, rollups)
+	assert.Equal(t, 4.0, rollups[len(rollups)-1].Last)
+
+	// Удаление ряда удаляет и его агрегаты
+	_, _, err = rolled.Delete(map[string]time.Time{counter(0).Key(): time.Now().Add(time.Minute)})
+	require.NoError(t, err)
+	rollups, err = store.GetRollups(counter(0).Key(), time.Minute, from, to)
+	require.NoError(t, err)
+	assert.Empty(t, rollups)
+}
+
+// yieldingStorage уступает процессор после записи, чтобы параллельные записи
+// чаще успевали вклиниться между записью и передачей значения в Roller.
+type yieldingStorage struct {
+	*mem.Storage
+}
+
+func (s yieldingStorage) Increment(metric metricModel.Metric) (metricModel.Metric, error) {
+	result, err := s.Storage.Increment(metric)
+	runtime.Gosched()
+	return result, err
+}
+
+func TestStorageConcurrentIncrement(t *testing.T) {
+	store := mem.NewStorage()
+	roller, err := NewRoller(testTiers, store, 0)
+	require.NoError(t, err)
+	rolled := NewStorage(yieldingStorage{store}, roller)
+
+	const workers, increments = 8, 200
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				_, err := rolled.Increment(counter(1))
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, roller.Flush())
+
+	rollups, err := store.GetRollups(counter(0).Key(), time.Minute, time.Now().Add(-time.Hour), time.Now())
+	require.NoError(t, err)
+	require.NotEmpty(t, rollups)
+
+	// Значения попадают в Roller в порядке записи: ложных сбросов нет,
+	// и прирост от первого значения до последнего не теряется
+	increase := 0.0
+	for _, rollup := range rollups {
+		increase += rollup.Increase
+	}
+	assert.Equal(t, float64(workers*increments), rollups[len(rollups)-1].Last)
+	assert.Equal(t, float64(workers*increments-1), increase)
+}
@@ -0,0 +1,168 @@
+package rollup
+
+import (
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// lockStripes - количество блокировок, между которыми распределяются ряды.
+const lockStripes = 64
+
+// Storage - хранилище метрик, которое передает каждое записанное значение в Roller.
+// Остальные методы выполняются исходным хранилищем.
+// Запись ряда и передача значения в Roller выполняются под блокировкой ряда,
+// иначе при параллельной записи Roller может получить значения не в том порядке,
+// в котором они записаны, и посчитать ложный сброс счетчика.
+type Storage struct {
+	storage.StorageInterface
+	roller *Roller
+
+	locks [lockStripes]sync.Mutex
+}
+
+// NewStorage оборачивает хранилище store, чтобы записанные в него значения учитывались в roller.
+func NewStorage(store storage.StorageInterface, roller *Roller) *Storage {
+	return &Storage{StorageInterface: store, roller: roller}
+}
+
+// Set сохраняет метрику и учитывает ее значение в агрегатах.
+// Значения, восстановленные из снимка (с заполненным UpdatedAt), не являются новыми отсчетами:
+// они не учитываются в агрегатах, а только задают значение, от которого считается прирост.
+func (s *Storage) Set(metric metricModel.Metric) error {
+	unlock := s.lock(metric.Key())
+	defer unlock()
+
+	if err := s.StorageInterface.Set(metric); err != nil {
+		return err
+	}
+
+	s.add(metric, time.Now())
+	return nil
+}
+
+// Append сохраняет отсчеты и учитывает записанные значения в агрегатах.
+func (s *Storage) Append(metrics []metricModel.Metric) ([]metricModel.Metric, error) {
+	keys := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		keys = append(keys, metric.Key())
+	}
+	unlock := s.lock(keys...)
+	defer unlock()
+
+	written, err := s.StorageInterface.Append(metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, metric := range written {
+		s.add(metric, now)
+	}
+
+	return written, nil
+}
+
+// Increment увеличивает счетчик и учитывает его итоговое значение в агрегатах.
+func (s *Storage) Increment(metric metricModel.Metric) (metricModel.Metric, error) {
+	unlock := s.lock(metric.Key())
+	defer unlock()
+
+	result, err := s.StorageInterface.Increment(metric)
+	if err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	s.roller.Add(result, sampleTime(metric, time.Now()))
+	return result, nil
+}
+
+// SetAll сохраняет метрики и учитывает их значения в агрегатах.
+func (s *Storage) SetAll(metrics map[string]metricModel.Metric) error {
+	keys := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		keys = append(keys, metric.Key())
+	}
+	unlock := s.lock(keys...)
+	defer unlock()
+
+	if err := s.StorageInterface.SetAll(metrics); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, metric := range metrics {
+		s.add(metric, now)
+	}
+
+	return nil
+}
+
+// add учитывает записанное значение в агрегатах, а значение из снимка - только как начало отсчета прироста.
+func (s *Storage) add(metric metricModel.Metric, now time.Time) {
+	if metric.UpdatedAt != nil {
+		s.roller.Seed(metric)
+		return
+	}
+
+	s.roller.Add(metric, sampleTime(metric, now))
+}
+
+// sampleTime возвращает время отсчета метрики, а если оно не задано - now.
+func sampleTime(metric metricModel.Metric, now time.Time) time.Time {
+	if metric.Timestamp != nil {
+		return *metric.Timestamp
+	}
+
+	return now
+}
+
+// Delete удаляет ряды вместе с их еще не сохраненными агрегатами.
+func (s *Storage) Delete(stale map[string]time.Time) ([]string, int, error) {
+	keys := make([]string, 0, len(stale))
+	for key := range stale {
+		keys = append(keys, key)
+	}
+
+	unlock := s.lock(keys...)
+	defer unlock()
+
+	deleted, samples, err := s.StorageInterface.Delete(stale)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.roller.Forget(deleted)
+	return deleted, samples, nil
+}
+
+// lock захватывает блокировки рядов keys и возвращает функцию их освобождения.
+// Блокировки захватываются в порядке возрастания номера, чтобы параллельные
+// пакетные записи не блокировали друг друга взаимно.
+func (s *Storage) lock(keys ...string) func() {
+	stripes := make(map[int]bool, len(keys))
+	for _, key := range keys {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+		stripes[int(h.Sum32()%lockStripes)] = true
+	}
+
+	ordered := make([]int, 0, len(stripes))
+	for stripe := range stripes {
+		ordered = append(ordered, stripe)
+	}
+	sort.Ints(ordered)
+
+	for _, stripe := range ordered {
+		s.locks[stripe].Lock()
+	}
+
+	return func() {
+		for i := len(ordered) - 1; i >= 0; i-- {
+			s.locks[ordered[i]].Unlock()
+		}
+	}
+}
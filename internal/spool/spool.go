@@ -0,0 +1,236 @@
+// Package spool реализует ограниченную очередь пачек метрик на диске.
+//
+// Агент складывает в очередь пачки, которые не удалось отправить на сервер,
+// и отправляет их повторно в порядке поступления, когда сервер снова доступен.
+// Каждая пачка хранится в отдельном файле, поэтому очередь переживает перезапуск агента.
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fileExt - расширение файлов с пачками метрик.
+const fileExt = ".batch"
+
+// Queue - очередь пачек на диске с ограничением по суммарному размеру и возрасту.
+type Queue struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu  sync.Mutex
+	seq uint64
+
+	// replayMu не дает двум вызовам Replay отправить одну и ту же пачку дважды.
+	replayMu sync.Mutex
+
+	// dropped - количество пачек, удаленных из-за превышения лимитов.
+	dropped atomic.Int64
+}
+
+// entry - пачка, сохраненная на диске.
+type entry struct {
+	path    string
+	size    int64
+	created time.Time
+}
+
+// NewQueue создает очередь в каталоге dir.
+// Нулевые maxBytes и maxAge отключают соответствующие ограничения.
+func NewQueue(dir string, maxBytes int64, maxAge time.Duration) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Queue{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+	}, nil
+}
+
+// Push добавляет пачку в конец очереди.
+// Если после добавления превышен лимит размера, удаляются самые старые пачки.
+func (q *Queue) Push(data []byte) error {
+	if q.maxBytes > 0 && int64(len(data)) > q.maxBytes {
+		q.dropped.Add(1)
+		return errors.New("the batch exceeds the spool size limit")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	now := time.Now()
+	name := fmt.Sprintf("%020d-%010d%s", now.UnixNano(), q.seq, fileExt)
+
+	// Пишем во временный файл и переименовываем, чтобы при сбое в очереди не оказалась половина пачки
+	tmp, err := os.CreateTemp(q.dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(q.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return q.enforceLimits(now)
+}
+
+// Replay отправляет пачки из очереди в порядке поступления.
+// Отправленная пачка удаляется из очереди. На первой ошибке отправка прекращается,
+// а оставшиеся пачки остаются в очереди до следующего вызова.
+// Во время отправки очередь не блокируется, поэтому Push можно вызывать параллельно.
+// Возвращает количество отправленных пачек.
+func (q *Queue) Replay(send func(data []byte) error) (int, error) {
+	q.replayMu.Lock()
+	defer q.replayMu.Unlock()
+
+	q.mu.Lock()
+	err := q.enforceLimits(time.Now())
+	var entries []entry
+	if err == nil {
+		entries, err = q.entries()
+	}
+	q.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, e := range entries {
+		data, err := os.ReadFile(e.path)
+		if os.IsNotExist(err) {
+			// Пачку уже удалили из-за превышения лимитов
+			continue
+		}
+		if err != nil {
+			return sent, err
+		}
+
+		if err := send(data); err != nil {
+			return sent, err
+		}
+
+		if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// Len возвращает количество пачек в очереди.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries, err := q.entries()
+	if err != nil {
+		return 0
+	}
+
+	return len(entries)
+}
+
+// Dropped возвращает количество пачек, удаленных из-за превышения лимитов.
+func (q *Queue) Dropped() int64 {
+	return q.dropped.Load()
+}
+
+// enforceLimits удаляет устаревшие пачки и самые старые пачки сверх лимита размера.
+// Вызывается под блокировкой.
+func (q *Queue) enforceLimits(now time.Time) error {
+	entries, err := q.entries()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+
+	for _, e := range entries {
+		expired := q.maxAge > 0 && now.Sub(e.created) > q.maxAge
+		oversized := q.maxBytes > 0 && total > q.maxBytes
+		if !expired && !oversized {
+			break
+		}
+
+		if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		total -= e.size
+		q.dropped.Add(1)
+	}
+
+	return nil
+}
+
+// entries возвращает пачки из каталога очереди в порядке поступления.
+func (q *Queue) entries() ([]entry, error) {
+	files, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]entry, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), fileExt) {
+			continue
+		}
+
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, entry{
+			path:    filepath.Join(q.dir, f.Name()),
+			size:    info.Size(),
+			created: parseCreated(f.Name(), info.ModTime()),
+		})
+	}
+
+	// Имена файлов начинаются с времени создания с ведущими нулями,
+	// поэтому лексикографический порядок совпадает с порядком поступления
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].path < entries[j].path
+	})
+
+	return entries, nil
+}
+
+// parseCreated извлекает время создания пачки из имени файла.
+func parseCreated(name string, fallback time.Time) time.Time {
+	var nanos int64
+	if _, err := fmt.Sscanf(name, "%020d-", &nanos); err != nil {
+		return fallback
+	}
+
+	return time.Unix(0, nanos)
+}
@@ -0,0 +1,112 @@
+package spool_test
+
+import (
+	"errors"
+	"github.com/dip96/metrics/internal/spool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	t.Run("replay in order", func(t *testing.T) {
+		q, err := spool.NewQueue(t.TempDir(), 0, 0)
+		require.NoError(t, err)
+
+		for _, batch := range []string{"first", "second", "third"} {
+			require.NoError(t, q.Push([]byte(batch)))
+		}
+		assert.Equal(t, 3, q.Len())
+
+		var replayed []string
+		sent, err := q.Replay(func(data []byte) error {
+			replayed = append(replayed, string(data))
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, sent)
+		assert.Equal(t, []string{"first", "second", "third"}, replayed)
+		assert.Equal(t, 0, q.Len())
+	})
+
+	t.Run("stop on send error", func(t *testing.T) {
+		q, err := spool.NewQueue(t.TempDir(), 0, 0)
+		require.NoError(t, err)
+
+		require.NoError(t, q.Push([]byte("first")))
+		require.NoError(t, q.Push([]byte("second")))
+
+		sent, err := q.Replay(func(data []byte) error {
+			if string(data) == "second" {
+				return errors.New("server is down")
+			}
+			return nil
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, sent)
+		assert.Equal(t, 1, q.Len())
+
+		var replayed []string
+		_, err = q.Replay(func(data []byte) error {
+			replayed = append(replayed, string(data))
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"second"}, replayed)
+	})
+
+	t.Run("size limit drops oldest", func(t *testing.T) {
+		q, err := spool.NewQueue(t.TempDir(), 10, 0)
+		require.NoError(t, err)
+
+		require.NoError(t, q.Push([]byte("aaaa")))
+		require.NoError(t, q.Push([]byte("bbbb")))
+		require.NoError(t, q.Push([]byte("cccc")))
+
+		assert.Equal(t, 2, q.Len())
+		assert.Equal(t, int64(1), q.Dropped())
+
+		var replayed []string
+		_, err = q.Replay(func(data []byte) error {
+			replayed = append(replayed, string(data))
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bbbb", "cccc"}, replayed)
+
+		// Пачка больше лимита не помещается в очередь
+		assert.Error(t, q.Push([]byte("too large batch")))
+		assert.Equal(t, int64(2), q.Dropped())
+	})
+
+	t.Run("age limit", func(t *testing.T) {
+		q, err := spool.NewQueue(t.TempDir(), 0, 50*time.Millisecond)
+		require.NoError(t, err)
+
+		require.NoError(t, q.Push([]byte("old")))
+		time.Sleep(100 * time.Millisecond)
+		require.NoError(t, q.Push([]byte("new")))
+
+		var replayed []string
+		_, err = q.Replay(func(data []byte) error {
+			replayed = append(replayed, string(data))
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"new"}, replayed)
+		assert.Equal(t, int64(1), q.Dropped())
+	})
+
+	t.Run("survives restart", func(t *testing.T) {
+		dir := t.TempDir()
+
+		q, err := spool.NewQueue(dir, 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, q.Push([]byte("pending")))
+
+		restarted, err := spool.NewQueue(dir, 0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 1, restarted.Len())
+	})
+}
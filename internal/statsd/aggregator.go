@@ -0,0 +1,176 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage"
+)
+
+// series - ряд, в который агрегируются значения.
+type series struct {
+	name   string
+	labels map[string]string
+}
+
+// counter - приращение счетчика за интервал сброса.
+type counter struct {
+	series
+	value float64
+}
+
+// gauge - текущее значение gauge.
+type gauge struct {
+	series
+	value float64
+	dirty bool
+}
+
+// timer - значения таймера за интервал сброса.
+type timer struct {
+	series
+	count float64
+	min   float64
+	max   float64
+	sum   float64
+	n     int
+}
+
+// Aggregator накапливает значения StatsD между сбросами в хранилище.
+type Aggregator struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+	gauges   map[string]*gauge
+	timers   map[string]*timer
+	// remainders - дробные части приращений счетчиков, не записанные при округлении,
+	// по ключу записываемого ряда. Переносятся в следующий сброс.
+	remainders map[string]float64
+}
+
+// NewAggregator создает пустой агрегатор.
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		counters:   make(map[string]*counter),
+		gauges:     make(map[string]*gauge),
+		timers:     make(map[string]*timer),
+		remainders: make(map[string]float64),
+	}
+}
+
+// Add учитывает значение sample.
+func (a *Aggregator) Add(sample Sample) {
+	s := series{name: sample.Name, labels: sample.Labels}
+	key := metricModel.SeriesKey(sample.Name, sample.Labels)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch sample.Type {
+	case TypeCounter:
+		c, ok := a.counters[key]
+		if !ok {
+			c = &counter{series: s}
+			a.counters[key] = c
+		}
+		c.value += sample.Value / sample.Rate
+	case TypeGauge:
+		// Значения gauge сохраняются между сбросами, чтобы относительные изменения применялись к последнему значению
+		g, ok := a.gauges[key]
+		if !ok {
+			g = &gauge{series: s}
+			a.gauges[key] = g
+		}
+		if sample.Relative {
+			g.value += sample.Value
+		} else {
+			g.value = sample.Value
+		}
+		g.dirty = true
+	case TypeTimer, TypeHistogram:
+		t, ok := a.timers[key]
+		if !ok {
+			t = &timer{series: s, min: sample.Value, max: sample.Value}
+			a.timers[key] = t
+		}
+		t.count += 1 / sample.Rate
+		t.min = math.Min(t.min, sample.Value)
+		t.max = math.Max(t.max, sample.Value)
+		t.sum += sample.Value
+		t.n++
+	}
+}
+
+// Flush записывает накопленные за интервал значения в хранилище store.
+// Приращения счетчиков округляются до целого, а отброшенная дробная часть
+// учитывается в следующем сбросе, поэтому счетчики с частотой выборки не теряют события.
+func (a *Aggregator) Flush(store storage.StorageInterface) error {
+	a.mu.Lock()
+	counters, timers := a.counters, a.timers
+	a.counters = make(map[string]*counter)
+	a.timers = make(map[string]*timer)
+
+	gauges := make(map[string]metricModel.Metric)
+	for _, g := range a.gauges {
+		if g.dirty {
+			gauges[metricModel.SeriesKey(g.name, g.labels)] = gaugeMetric(g.series, "", g.value)
+			g.dirty = false
+		}
+	}
+
+	increments := make([]metricModel.Metric, 0, len(counters)+len(timers))
+	for _, c := range counters {
+		increments = append(increments, a.counterMetric(c.series, "", c.value))
+	}
+
+	for _, t := range timers {
+		increments = append(increments, a.counterMetric(t.series, ".count", t.count))
+		for suffix, value := range map[string]float64{
+			".min":  t.min,
+			".max":  t.max,
+			".sum":  t.sum,
+			".mean": t.sum / float64(t.n),
+		} {
+			m := gaugeMetric(t.series, suffix, value)
+			gauges[m.Key()] = m
+		}
+	}
+	a.mu.Unlock()
+
+	var errs []error
+	for _, m := range increments {
+		if _, err := store.Increment(m); err != nil {
+			errs = append(errs, fmt.Errorf("failed to increment %s: %w", m.Key(), err))
+		}
+	}
+
+	if len(gauges) > 0 {
+		if err := store.SetAll(gauges); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save gauges: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// counterMetric округляет приращение вместе с остатком предыдущих сбросов и запоминает новый остаток.
+// Вызывается под блокировкой агрегатора.
+func (a *Aggregator) counterMetric(s series, suffix string, value float64) metricModel.Metric {
+	key := metricModel.SeriesKey(s.name+suffix, s.labels)
+	value += a.remainders[key]
+
+	delta := int64(math.Round(value))
+	if remainder := value - float64(delta); remainder != 0 {
+		a.remainders[key] = remainder
+	} else {
+		delete(a.remainders, key)
+	}
+
+	return metricModel.Metric{ID: s.name + suffix, MType: metricModel.MetricTypeCounter, Delta: &delta, Labels: metricModel.CopyLabels(s.labels)}
+}
+
+func gaugeMetric(s series, suffix string, value float64) metricModel.Metric {
+	return metricModel.Metric{ID: s.name + suffix, MType: metricModel.MetricTypeGauge, Value: &value, Labels: metricModel.CopyLabels(s.labels)}
+}
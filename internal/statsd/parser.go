@@ -0,0 +1,129 @@
+// Package statsd принимает метрики по протоколу StatsD через UDP и TCP.
+//
+// Значения агрегируются в течение интервала сброса и записываются в хранилище:
+// счетчики (c) - приращением счетчика, gauge (g) - значением gauge,
+// таймеры (ms, h) - счетчиком name.count и gauge name.min, name.max, name.mean и name.sum.
+// Поддерживаются частота выборки (@rate) и теги DogStatsD (#tag:value), которые становятся метками ряда.
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Type - тип метрики StatsD.
+type Type string
+
+const (
+	// TypeCounter - счетчик.
+	TypeCounter Type = "c"
+	// TypeGauge - gauge.
+	TypeGauge Type = "g"
+	// TypeTimer - таймер в миллисекундах.
+	TypeTimer Type = "ms"
+	// TypeHistogram - гистограмма, обрабатывается как таймер.
+	TypeHistogram Type = "h"
+)
+
+// Sample - одно значение, разобранное из строки протокола.
+type Sample struct {
+	Name  string
+	Type  Type
+	Value float64
+	// Rate - частота выборки от 0 до 1. Счетчики и количество значений таймера делятся на Rate.
+	Rate float64
+	// Relative - значение gauge со знаком + или - изменяет текущее значение, а не заменяет его.
+	Relative bool
+	Labels   map[string]string
+}
+
+// ParseLine разбирает строку вида name:value|type[|@rate][|#tag:value,...].
+func ParseLine(line string) (Sample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return Sample{}, fmt.Errorf("invalid line %q: metric name is missing", line)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return Sample{}, fmt.Errorf("invalid line %q: metric type is missing", line)
+	}
+
+	sample := Sample{Name: name, Type: Type(parts[1]), Rate: 1}
+
+	switch sample.Type {
+	case TypeCounter, TypeGauge, TypeTimer, TypeHistogram:
+	default:
+		return Sample{}, fmt.Errorf("invalid line %q: unsupported metric type %q", line, parts[1])
+	}
+
+	value, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("invalid line %q: %w", line, err)
+	}
+	sample.Value = value
+	sample.Relative = sample.Type == TypeGauge && (strings.HasPrefix(parts[0], "+") || strings.HasPrefix(parts[0], "-"))
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return Sample{}, fmt.Errorf("invalid line %q: invalid sample rate %q", line, part[1:])
+			}
+			sample.Rate = rate
+		case strings.HasPrefix(part, "#"):
+			sample.Labels = parseTags(part[1:])
+		default:
+			return Sample{}, fmt.Errorf("invalid line %q: unknown field %q", line, part)
+		}
+	}
+
+	return sample, nil
+}
+
+// parseTags разбирает теги DogStatsD вида tag:value,tag2:value2.
+// Теги без значения пропускаются.
+func parseTags(s string) map[string]string {
+	labels := make(map[string]string)
+
+	for _, tag := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(tag, ":")
+		if !ok || name == "" || value == "" {
+			continue
+		}
+		labels[name] = value
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+
+	return labels
+}
+
+// ParsePacket разбирает пакет из нескольких строк, разделенных переводом строки.
+// Пустые строки пропускаются, ошибки разбора строк объединяются.
+func ParsePacket(packet string) ([]Sample, error) {
+	var samples []Sample
+	var errs []error
+
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		sample, err := ParseLine(line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		samples = append(samples, sample)
+	}
+
+	return samples, errors.Join(errs...)
+}
@@ -0,0 +1,218 @@
+package statsd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dip96/metrics/internal/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxPacketSize - максимальный размер UDP пакета и строки TCP.
+const maxPacketSize = 64 * 1024
+
+// Server принимает метрики StatsD и периодически сбрасывает их в хранилище.
+type Server struct {
+	store      storage.StorageInterface
+	aggregator *Aggregator
+	interval   time.Duration
+
+	udp net.PacketConn
+	tcp net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewServer создает сервер, который сбрасывает значения в store с интервалом interval.
+func NewServer(store storage.StorageInterface, interval time.Duration) *Server {
+	return &Server{
+		store:      store,
+		aggregator: NewAggregator(),
+		interval:   interval,
+		conns:      make(map[net.Conn]struct{}),
+		stop:       make(chan struct{}),
+	}
+}
+
+// Listen начинает прием метрик по UDP на адресе udpAddr и по TCP на адресе tcpAddr.
+// Пустой адрес отключает соответствующий протокол.
+func (s *Server) Listen(udpAddr, tcpAddr string) error {
+	if s.interval <= 0 {
+		return fmt.Errorf("statsd flush interval must be positive, got %s", s.interval)
+	}
+
+	if udpAddr != "" {
+		udp, err := net.ListenPacket("udp", udpAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen statsd udp: %w", err)
+		}
+		s.udp = udp
+	}
+
+	if tcpAddr != "" {
+		tcp, err := net.Listen("tcp", tcpAddr)
+		if err != nil {
+			if s.udp != nil {
+				s.udp.Close()
+			}
+			return fmt.Errorf("failed to listen statsd tcp: %w", err)
+		}
+		s.tcp = tcp
+	}
+
+	if s.udp != nil {
+		s.wg.Add(1)
+		go s.serveUDP()
+	}
+
+	if s.tcp != nil {
+		s.wg.Add(1)
+		go s.serveTCP()
+	}
+
+	s.wg.Add(1)
+	go s.runFlush()
+
+	return nil
+}
+
+// UDPAddr возвращает адрес UDP слушателя или nil, если UDP отключен.
+func (s *Server) UDPAddr() net.Addr {
+	if s.udp == nil {
+		return nil
+	}
+	return s.udp.LocalAddr()
+}
+
+// TCPAddr возвращает адрес TCP слушателя или nil, если TCP отключен.
+func (s *Server) TCPAddr() net.Addr {
+	if s.tcp == nil {
+		return nil
+	}
+	return s.tcp.Addr()
+}
+
+// Close прекращает прием метрик и сбрасывает накопленные значения в хранилище.
+func (s *Server) Close() error {
+	close(s.stop)
+
+	if s.udp != nil {
+		s.udp.Close()
+	}
+
+	if s.tcp != nil {
+		s.tcp.Close()
+	}
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return s.aggregator.Flush(s.store)
+}
+
+func (s *Server) runFlush() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.aggregator.Flush(s.store); err != nil {
+				log.Errorf("Failed to flush statsd metrics: %v", err)
+			}
+		}
+	}
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Errorf("Failed to read statsd packet: %v", err)
+			continue
+		}
+
+		s.handle(string(buf[:n]))
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Errorf("Failed to accept statsd connection: %v", err)
+			continue
+		}
+
+		// Соединение, принятое во время остановки, закрывается сразу, иначе Close не дождется его завершения
+		s.mu.Lock()
+		select {
+		case <-s.stop:
+			s.mu.Unlock()
+			conn.Close()
+			continue
+		default:
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxPacketSize)
+	for scanner.Scan() {
+		s.handle(scanner.Text())
+	}
+}
+
+// handle разбирает пакет и учитывает корректные строки.
+func (s *Server) handle(packet string) {
+	samples, err := ParsePacket(packet)
+	if err != nil {
+		log.Debugf("Invalid statsd lines: %v", err)
+	}
+
+	for _, sample := range samples {
+		s.aggregator.Add(sample)
+	}
+}
@@ -0,0 +1,139 @@
+package statsd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage/mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{line: "requests:1|c", want: Sample{Name: "requests", Type: TypeCounter, Value: 1, Rate: 1}},
+		{line: "requests:3|c|@0.5", want: Sample{Name: "requests", Type: TypeCounter, Value: 3, Rate: 0.5}},
+		{line: "temperature:2.5|g", want: Sample{Name: "temperature", Type: TypeGauge, Value: 2.5, Rate: 1}},
+		{line: "temperature:-1|g", want: Sample{Name: "temperature", Type: TypeGauge, Value: -1, Rate: 1, Relative: true}},
+		{line: "latency:320|ms|#host:a,env", want: Sample{Name: "latency", Type: TypeTimer, Value: 320, Rate: 1, Labels: map[string]string{"host": "a"}}},
+		{line: "requests", wantErr: true},
+		{line: "requests:1", wantErr: true},
+		{line: "requests:x|c", wantErr: true},
+		{line: "users:1|s", wantErr: true},
+		{line: "requests:1|c|@2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAggregatorFlush(t *testing.T) {
+	store := mem.NewStorage()
+	aggregator := NewAggregator()
+
+	samples, err := ParsePacket("requests:1|c\nrequests:2|c|@0.5\n\ntemperature:10|g\ntemperature:+5|g\nbad line\nlatency:100|ms\nlatency:300|ms")
+	assert.Error(t, err)
+	require.Len(t, samples, 6)
+
+	for _, sample := range samples {
+		aggregator.Add(sample)
+	}
+	require.NoError(t, aggregator.Flush(store))
+
+	get := func(key string) metricModel.Metric {
+		m, err := store.Get(key)
+		require.NoError(t, err)
+		return m
+	}
+
+	// С частотой выборки 0.5 значение 2 соответствует 4 событиям
+	assert.Equal(t, int64(5), *get("requests").Delta)
+	assert.Equal(t, 15.0, *get("temperature").Value)
+	assert.Equal(t, int64(2), *get("latency.count").Delta)
+	assert.Equal(t, 100.0, *get("latency.min").Value)
+	assert.Equal(t, 300.0, *get("latency.max").Value)
+	assert.Equal(t, 200.0, *get("latency.mean").Value)
+	assert.Equal(t, 400.0, *get("latency.sum").Value)
+
+	// Счетчики продолжают расти, относительное изменение gauge применяется к последнему значению
+	aggregator.Add(Sample{Name: "requests", Type: TypeCounter, Value: 1, Rate: 1})
+	aggregator.Add(Sample{Name: "temperature", Type: TypeGauge, Value: -3, Rate: 1, Relative: true})
+	require.NoError(t, aggregator.Flush(store))
+
+	assert.Equal(t, int64(6), *get("requests").Delta)
+	assert.Equal(t, 12.0, *get("temperature").Value)
+	assert.Equal(t, int64(2), *get("latency.count").Delta)
+}
+
+func TestAggregatorFlushSampledCounters(t *testing.T) {
+	store := mem.NewStorage()
+	aggregator := NewAggregator()
+
+	// Каждый сброс дает 1/0.3 = 3.33 события: без переноса остатка было бы записано по 3
+	for i := 0; i < 10; i++ {
+		samples, err := ParsePacket("requests:1|c|@0.3\nlatency:100|ms|@0.3")
+		require.NoError(t, err)
+		for _, sample := range samples {
+			aggregator.Add(sample)
+		}
+		require.NoError(t, aggregator.Flush(store))
+	}
+
+	for _, key := range []string{"requests", "latency.count"} {
+		m, err := store.Get(key)
+		require.NoError(t, err)
+		assert.Equal(t, int64(33), *m.Delta, key)
+	}
+}
+
+func TestServer(t *testing.T) {
+	store := mem.NewStorage()
+	server := NewServer(store, time.Hour)
+	require.NoError(t, server.Listen("127.0.0.1:0", "127.0.0.1:0"))
+
+	udp, err := net.Dial("udp", server.UDPAddr().String())
+	require.NoError(t, err)
+	defer udp.Close()
+	_, err = udp.Write([]byte("requests:1|c|#host:a\nrequests:1|c|#host:a"))
+	require.NoError(t, err)
+
+	tcp, err := net.Dial("tcp", server.TCPAddr().String())
+	require.NoError(t, err)
+	defer tcp.Close()
+	_, err = tcp.Write([]byte("temperature:21.5|g\n"))
+	require.NoError(t, err)
+
+	// Значения принимаются асинхронно, поэтому ждем, пока они попадут в агрегатор
+	require.Eventually(t, func() bool {
+		server.aggregator.mu.Lock()
+		defer server.aggregator.mu.Unlock()
+		return len(server.aggregator.counters) == 1 && len(server.aggregator.gauges) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// При остановке накопленные значения сохраняются в хранилище
+	require.NoError(t, server.Close())
+
+	requests, err := store.Get(metricModel.SeriesKey("requests", map[string]string{"host": "a"}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *requests.Delta)
+
+	temperature, err := store.Get("temperature")
+	require.NoError(t, err)
+	assert.Equal(t, 21.5, *temperature.Value)
+}
@@ -103,8 +103,20 @@ func NewConsumer(filename string) (*Consumer, error) {
 
 func SaveMetrics(producer ioModel.ProducerInterface) {
 	metrics, _ := storage.Storage.GetAll()
+
+	// Время обновления сохраняется в снимке, чтобы после восстановления ряды не считались свежими
+	updated, err := storage.Storage.Updated()
+	if err != nil {
+		log.Errorln(err)
+	}
+
 	for metric := range metrics {
-		if err := producer.WriteEvent(metrics[metric]); err != nil {
+		value := metrics[metric]
+		if ts, ok := updated[metric]; ok {
+			value.UpdatedAt = &ts
+		}
+
+		if err := producer.WriteEvent(value); err != nil {
 			log.Errorln(err)
 		}
 	}
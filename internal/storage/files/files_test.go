@@ -4,11 +4,14 @@ import (
 	"bufio"
 	"encoding/json"
 	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage"
+	"github.com/dip96/metrics/internal/storage/mem"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestProducer(t *testing.T) {
@@ -78,6 +81,38 @@ func TestConsumer(t *testing.T) {
 	})
 }
 
+func TestProducerConsumerLabels(t *testing.T) {
+	tempDir := t.TempDir()
+	tempFilePath := filepath.Join(tempDir, "test.txt")
+	file, err := os.Create(tempFilePath)
+	require.NoError(t, err)
+
+	producer := &Producer{
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}
+
+	metric := metricModel.Metric{
+		ID:     "test_metric",
+		MType:  metricModel.MetricTypeGauge,
+		Value:  Float64Ptr(42),
+		Labels: map[string]string{"host": "a"},
+	}
+
+	err = producer.WriteEvent(metric)
+	require.NoError(t, err)
+	file.Close()
+
+	consumer, err := NewConsumer(tempFilePath)
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	result, err := consumer.ReadEvent()
+	require.NoError(t, err)
+	assert.Equal(t, &metric, result)
+	assert.Equal(t, `test_metric{host="a"}`, result.Key())
+}
+
 func TestNewConsumer(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		tempDir := t.TempDir()
@@ -112,6 +147,21 @@ func (m *MockProducer) Close() error {
 	return nil
 }
 
+func TestSaveMetricsUpdatedAt(t *testing.T) {
+	storage.Storage = mem.NewStorage()
+
+	restored := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := storage.Storage.Set(metricModel.Metric{ID: "test_metric", MType: metricModel.MetricTypeGauge, Value: Float64Ptr(42), UpdatedAt: &restored})
+	require.NoError(t, err)
+
+	// Время обновления попадает в снимок, чтобы пережить восстановление
+	producer := &MockProducer{}
+	SaveMetrics(producer)
+	require.Len(t, producer.writtenMetrics, 1)
+	require.NotNil(t, producer.writtenMetrics[0].UpdatedAt)
+	assert.Equal(t, restored, *producer.writtenMetrics[0].UpdatedAt)
+}
+
 // MockConfig is a mock for the configuration
 type MockConfig struct {
 	DirStorageTmpPath string
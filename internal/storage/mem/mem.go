@@ -3,30 +3,139 @@ package mem
 import (
 	"errors"
 	"github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage"
 	log "github.com/sirupsen/logrus"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
 )
 
-type Storage struct {
+// DefaultRetention - время хранения истории значений метрик в памяти.
+const DefaultRetention = 24 * time.Hour
+
+// shardCount - количество сегментов хранилища.
+// Каждый сегмент защищен своей блокировкой, поэтому параллельные записи
+// разных метрик почти не конкурируют между собой.
+const shardCount = 32
+
+// shard - сегмент хранилища со своей блокировкой.
+type shard struct {
+	mu      sync.RWMutex
 	metrics map[string]metric.Metric
+	history map[string][]metric.Sample
+	// updated - время последнего обновления рядов.
+	updated map[string]time.Time
+	// rollups - агрегаты рядов по длине окна уровня, см. пакет rollup.
+	rollups map[string]map[time.Duration][]metric.Rollup
+}
+
+// Storage - потокобезопасное хранилище метрик в памяти.
+// Наружу всегда отдаются копии метрик, поэтому вызывающий код может
+// изменять полученные значения без блокировок.
+type Storage struct {
+	shards    [shardCount]*shard
+	retention time.Duration
 }
 
 func (m *Storage) Get(name string) (metric.Metric, error) {
-	value, ok := m.metrics[name]
+	s := m.shard(name)
+
+	s.mu.RLock()
+	value, ok := s.metrics[name]
+	s.mu.RUnlock()
 
 	if ok {
-		return value, nil
+		return copyMetric(value), nil
 	}
 
 	return metric.Metric{}, errors.New("the metric was not found")
 }
 
 func (m *Storage) Set(metric metric.Metric) error {
-	m.metrics[metric.ID] = metric
-	return nil
+	s := m.shard(metric.Key())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.set(metric, m.retention)
+}
+
+func (m *Storage) Increment(value metric.Metric) (metric.Metric, error) {
+	if value.Delta == nil && value.Value == nil && value.Histogram == nil && value.Summary == nil {
+		return metric.Metric{}, errors.New("the metric delta is empty")
+	}
+
+	key := value.Key()
+	s := m.shard(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := copyMetric(value)
+	stored, ok := s.metrics[key]
+	if ok && stored.MType != value.MType {
+		return metric.Metric{}, storage.ErrTypeMismatch
+	}
+
+	now := time.Now()
+	if value.Timestamp != nil {
+		if value.Timestamp.Before(s.updated[key]) {
+			return metric.Metric{}, storage.ErrOutOfOrder
+		}
+		now = *value.Timestamp
+	}
+
+	switch {
+	case value.Histogram != nil:
+		histogram := metric.Histogram{}
+		if ok && stored.Histogram != nil {
+			histogram = *stored.Histogram.Copy()
+		}
+		histogram.Merge(*value.Histogram)
+		current.Histogram = &histogram
+	case value.Summary != nil:
+		summary := metric.Summary{}
+		if ok && stored.Summary != nil {
+			summary = *stored.Summary.Copy()
+		}
+		summary.Merge(*value.Summary)
+		current.Summary = &summary
+	case value.Value != nil:
+		gauge := *value.Value
+		if ok && stored.Value != nil {
+			gauge += *stored.Value
+		}
+		current.Value = &gauge
+	default:
+		delta := *value.Delta
+		if ok && stored.Delta != nil {
+			delta += *stored.Delta
+		}
+		current.Delta = &delta
+	}
+	current.UpdatedAt = nil
+	current.Timestamp = nil
+
+	s.metrics[key] = current
+	s.updated[key] = now
+	s.appendSample(key, current, now, m.retention)
+
+	return copyMetric(current), nil
 }
 
 func (m *Storage) GetAll() (map[string]metric.Metric, error) {
-	return m.metrics, nil
+	metrics := make(map[string]metric.Metric)
+
+	for _, s := range m.shards {
+		s.mu.RLock()
+		for key, value := range s.metrics {
+			metrics[key] = copyMetric(value)
+		}
+		s.mu.RUnlock()
+	}
+
+	return metrics, nil
 }
 
 func (m *Storage) SetAll(metrics map[string]metric.Metric) error {
@@ -40,8 +149,176 @@ func (m *Storage) SetAll(metrics map[string]metric.Metric) error {
 	return nil
 }
 
+// Append записывает отсчеты по одному под блокировкой сегмента ряда.
+func (m *Storage) Append(metrics []metric.Metric) ([]metric.Metric, error) {
+	written := make([]metric.Metric, 0, len(metrics))
+
+	for _, value := range metrics {
+		s := m.shard(value.Key())
+
+		s.mu.Lock()
+		err := s.set(value, m.retention)
+		s.mu.Unlock()
+
+		if errors.Is(err, storage.ErrOutOfOrder) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		written = append(written, value)
+	}
+
+	return written, nil
+}
+
+// GetRange возвращает историю значений метрики за период [from, to].
+// Для неизвестного ряда, как и в postgres, возвращается пустая история без ошибки.
+func (m *Storage) GetRange(name string, from, to time.Time) ([]metric.Sample, error) {
+	s := m.shard(name)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]metric.Sample, 0)
+	for _, sample := range s.history[name] {
+		if sample.Timestamp.Before(from) || sample.Timestamp.After(to) {
+			continue
+		}
+
+		result = append(result, copySample(sample))
+	}
+
+	return result, nil
+}
+
+func (m *Storage) Updated() (map[string]time.Time, error) {
+	updated := make(map[string]time.Time)
+
+	for _, s := range m.shards {
+		s.mu.RLock()
+		for key, ts := range s.updated {
+			updated[key] = ts
+		}
+		s.mu.RUnlock()
+	}
+
+	return updated, nil
+}
+
+func (m *Storage) Delete(stale map[string]time.Time) ([]string, int, error) {
+	deleted, samples := make([]string, 0, len(stale)), 0
+
+	for key, cutoff := range stale {
+		s := m.shard(key)
+
+		s.mu.Lock()
+		if _, ok := s.metrics[key]; ok && s.updated[key].Before(cutoff) {
+			deleted = append(deleted, key)
+			samples += len(s.history[key])
+			delete(s.metrics, key)
+			delete(s.history, key)
+			delete(s.updated, key)
+			delete(s.rollups, key)
+		}
+		s.mu.Unlock()
+	}
+
+	return deleted, samples, nil
+}
+
+// AddRollups объединяет агрегаты с уже сохраненными агрегатами тех же окон.
+func (m *Storage) AddRollups(resolution time.Duration, rollups []metric.Rollup) error {
+	for _, rollup := range rollups {
+		s := m.shard(rollup.Series)
+
+		s.mu.Lock()
+		tiers, ok := s.rollups[rollup.Series]
+		if !ok {
+			tiers = make(map[time.Duration][]metric.Rollup)
+			s.rollups[rollup.Series] = tiers
+		}
+		tiers[resolution] = mergeRollup(tiers[resolution], rollup)
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (m *Storage) GetRollups(key string, resolution time.Duration, from, to time.Time) ([]metric.Rollup, error) {
+	s := m.shard(key)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]metric.Rollup, 0)
+	for _, rollup := range s.rollups[key][resolution] {
+		if rollup.Start.Before(from) || rollup.Start.After(to) {
+			continue
+		}
+
+		result = append(result, rollup)
+	}
+
+	return result, nil
+}
+
+func (m *Storage) DeleteRollups(resolution time.Duration, before time.Time) error {
+	for _, s := range m.shards {
+		s.mu.Lock()
+		for key, tiers := range s.rollups {
+			rollups := tiers[resolution]
+
+			expired := 0
+			for expired < len(rollups) && rollups[expired].Start.Before(before) {
+				expired++
+			}
+
+			if expired == len(rollups) {
+				delete(tiers, resolution)
+			} else {
+				tiers[resolution] = rollups[expired:]
+			}
+
+			if len(tiers) == 0 {
+				delete(s.rollups, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+// DeleteSamples удаляет отсчеты истории, записанные раньше before.
+// Независимо от этого история в памяти не хранится дольше DefaultRetention.
+func (m *Storage) DeleteSamples(before time.Time) error {
+	for _, s := range m.shards {
+		s.mu.Lock()
+		for key, samples := range s.history {
+			expired := 0
+			for expired < len(samples) && samples[expired].Timestamp.Before(before) {
+				expired++
+			}
+			s.history[key] = samples[expired:]
+		}
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
 func (m *Storage) Clear() error {
-	m.metrics = make(map[string]metric.Metric)
+	for _, s := range m.shards {
+		s.mu.Lock()
+		s.metrics = make(map[string]metric.Metric)
+		s.history = make(map[string][]metric.Sample)
+		s.updated = make(map[string]time.Time)
+		s.rollups = make(map[string]map[time.Duration][]metric.Rollup)
+		s.mu.Unlock()
+	}
+
 	return nil
 }
 
@@ -49,9 +326,118 @@ func (m *Storage) Close() {
 
 }
 
+// shard возвращает сегмент, в котором хранится ряд с указанным ключом.
+func (m *Storage) shard(key string) *shard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return m.shards[h.Sum32()%shardCount]
+}
+
+// set сохраняет значение ряда и добавляет отсчет в историю. Вызывается под блокировкой сегмента.
+func (s *shard) set(value metric.Metric, retention time.Duration) error {
+	key := value.Key()
+
+	ts := time.Now()
+	if value.Timestamp != nil {
+		if value.Timestamp.Before(s.updated[key]) {
+			return storage.ErrOutOfOrder
+		}
+		ts = *value.Timestamp
+	}
+
+	updated := ts
+	if value.UpdatedAt != nil {
+		updated = *value.UpdatedAt
+	}
+
+	stored := copyMetric(value)
+	stored.UpdatedAt = nil
+	stored.Timestamp = nil
+
+	s.metrics[key] = stored
+	s.updated[key] = updated
+	s.appendSample(key, stored, ts, retention)
+	return nil
+}
+
+// appendSample добавляет отсчет в историю метрики и удаляет отсчеты старше retention.
+// Вызывается под блокировкой сегмента.
+func (s *shard) appendSample(key string, value metric.Metric, ts time.Time, retention time.Duration) {
+	samples := append(s.history[key], metric.NewSample(value, ts))
+
+	border := ts.Add(-retention)
+	expired := 0
+	for expired < len(samples) && samples[expired].Timestamp.Before(border) {
+		expired++
+	}
+
+	s.history[key] = samples[expired:]
+}
+
+// mergeRollup объединяет агрегат с агрегатом того же окна в отсортированном по времени срезе
+// или вставляет его на свое место, если такого окна еще нет.
+func mergeRollup(rollups []metric.Rollup, rollup metric.Rollup) []metric.Rollup {
+	i := sort.Search(len(rollups), func(i int) bool { return !rollups[i].Start.Before(rollup.Start) })
+
+	if i < len(rollups) && rollups[i].Start.Equal(rollup.Start) {
+		rollups[i].Merge(rollup)
+		return rollups
+	}
+
+	rollups = append(rollups, metric.Rollup{})
+	copy(rollups[i+1:], rollups[i:])
+	rollups[i] = rollup
+
+	return rollups
+}
+
+// copyMetric возвращает копию метрики, не разделяющую указатели и метки с исходной.
+func copyMetric(m metric.Metric) metric.Metric {
+	if m.Delta != nil {
+		delta := *m.Delta
+		m.Delta = &delta
+	}
+
+	if m.Value != nil {
+		value := *m.Value
+		m.Value = &value
+	}
+
+	m.Histogram = m.Histogram.Copy()
+	m.Summary = m.Summary.Copy()
+	m.Labels = metric.CopyLabels(m.Labels)
+
+	return m
+}
+
+func copySample(s metric.Sample) metric.Sample {
+	if s.Delta != nil {
+		delta := *s.Delta
+		s.Delta = &delta
+	}
+
+	if s.Value != nil {
+		value := *s.Value
+		s.Value = &value
+	}
+
+	return s
+}
+
 // NewStorage - конструктор для создания нового экземпляра Storage
 func NewStorage() *Storage {
-	return &Storage{
-		metrics: make(map[string]metric.Metric),
+	storage := &Storage{
+		retention: DefaultRetention,
 	}
+
+	for i := range storage.shards {
+		storage.shards[i] = &shard{
+			metrics: make(map[string]metric.Metric),
+			history: make(map[string][]metric.Sample),
+			updated: make(map[string]time.Time),
+			rollups: make(map[string]map[time.Duration][]metric.Rollup),
+		}
+	}
+
+	return storage
 }
@@ -0,0 +1,156 @@
+package mem_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage/mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageReturnsCopies(t *testing.T) {
+	storage := mem.NewStorage()
+	m := metric.Metric{ID: "test", MType: metric.MetricTypeCounter, Delta: Int64Ptr(1), Labels: map[string]string{"host": "a"}}
+	require.NoError(t, storage.Set(m))
+
+	// Изменение исходной метрики после Set не влияет на хранилище
+	*m.Delta = 100
+
+	got, err := storage.Get(m.Key())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *got.Delta)
+
+	// Изменение полученных значений не влияет на хранилище
+	*got.Delta = 200
+	got.Labels["host"] = "b"
+
+	all, err := storage.GetAll()
+	require.NoError(t, err)
+	*all[m.Key()].Delta = 300
+	delete(all, m.Key())
+
+	got, err = storage.Get(m.Key())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *got.Delta)
+	assert.Equal(t, "a", got.Labels["host"])
+}
+
+// TestStorageConcurrentAccess имитирует параллельную работу HTTP-хендлеров,
+// gRPC-сервиса и сохранения снимка в файл. Запускать с флагом -race.
+func TestStorageConcurrentAccess(t *testing.T) {
+	storage := mem.NewStorage()
+
+	const writers = 8
+	const iterations = 200
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				name := fmt.Sprintf("metric%d", j%10)
+				value := float64(worker*iterations + j)
+				err := storage.Set(metric.Metric{ID: name, MType: metric.MetricTypeGauge, Value: &value})
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_, _ = storage.GetAll()
+				_, _ = storage.GetRange("metric1", time.Time{}, time.Now())
+			}
+		}
+	}()
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				if m, err := storage.Get("metric2"); err == nil {
+					_ = *m.Value
+				}
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	all, err := storage.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 10)
+
+	samples, err := storage.GetRange("metric0", time.Time{}, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, samples, writers*iterations/10)
+}
+
+func TestStorageConcurrentIncrement(t *testing.T) {
+	storage := mem.NewStorage()
+
+	const workers = 8
+	const iterations = 500
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				_, err := storage.Increment(metric.Metric{ID: "PollCount", MType: metric.MetricTypeCounter, Delta: Int64Ptr(1)})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := storage.Get("PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(workers*iterations), *got.Delta)
+}
+
+// BenchmarkStorageConcurrentIngest - параллельная запись метрик, как при отправке
+// агентами с несколькими воркерами RateLimit.
+func BenchmarkStorageConcurrentIngest(b *testing.B) {
+	storage := mem.NewStorage()
+
+	var worker int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		host := fmt.Sprintf("host%d", atomic.AddInt64(&worker, 1))
+		i := 0
+		for pb.Next() {
+			value := float64(i)
+			err := storage.Set(metric.Metric{
+				ID:     fmt.Sprintf("metric%d", i%30),
+				MType:  metric.MetricTypeGauge,
+				Value:  &value,
+				Labels: map[string]string{"host": host},
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
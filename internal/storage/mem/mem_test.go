@@ -2,6 +2,7 @@ package mem_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/dip96/metrics/internal/model/metric"
 	"github.com/dip96/metrics/internal/storage/mem"
@@ -38,6 +39,27 @@ func TestStorage(t *testing.T) {
 		assert.Equal(t, m, got)
 	})
 
+	t.Run("Increment", func(t *testing.T) {
+		storage := mem.NewStorage()
+		m := metric.Metric{ID: "test", MType: metric.MetricTypeCounter, Delta: Int64Ptr(5)}
+
+		got, err := storage.Increment(m)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), *got.Delta)
+
+		got, err = storage.Increment(m)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), *got.Delta)
+
+		stored, err := storage.Get("test")
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), *stored.Delta)
+
+		// Счетчик без значения не принимается
+		_, err = storage.Increment(metric.Metric{ID: "test", MType: metric.MetricTypeCounter})
+		assert.Error(t, err)
+	})
+
 	t.Run("GetAll", func(t *testing.T) {
 		storage := mem.NewStorage()
 		metrics := map[string]metric.Metric{
@@ -68,6 +90,128 @@ func TestStorage(t *testing.T) {
 		assert.Equal(t, metrics, got)
 	})
 
+	t.Run("GetRange", func(t *testing.T) {
+		storage := mem.NewStorage()
+		from := time.Now()
+
+		for _, value := range []float64{1, 2, 3} {
+			err := storage.Set(metric.Metric{ID: "test", MType: metric.MetricTypeGauge, Value: Float64Ptr(value)})
+			require.NoError(t, err)
+		}
+
+		samples, err := storage.GetRange("test", from, time.Now())
+		require.NoError(t, err)
+		require.Len(t, samples, 3)
+		assert.Equal(t, 1.0, *samples[0].Value)
+		assert.Equal(t, 3.0, *samples[2].Value)
+		assert.False(t, samples[1].Timestamp.Before(samples[0].Timestamp))
+
+		// Отсчеты вне периода не возвращаются
+		samples, err = storage.GetRange("test", from.Add(-time.Hour), from.Add(-time.Minute))
+		require.NoError(t, err)
+		assert.Empty(t, samples)
+
+		// История несуществующей метрики пустая
+		samples, err = storage.GetRange("nonexistent", from, time.Now())
+		require.NoError(t, err)
+		assert.Empty(t, samples)
+	})
+
+	t.Run("Labels", func(t *testing.T) {
+		storage := mem.NewStorage()
+		hostA := metric.Metric{ID: "test", MType: metric.MetricTypeGauge, Value: Float64Ptr(1), Labels: map[string]string{"host": "a"}}
+		hostB := metric.Metric{ID: "test", MType: metric.MetricTypeGauge, Value: Float64Ptr(2), Labels: map[string]string{"host": "b"}}
+		require.NoError(t, storage.Set(hostA))
+		require.NoError(t, storage.Set(hostB))
+
+		// Ряды с одинаковым именем и разными метками не перезаписывают друг друга
+		got, err := storage.Get(hostA.Key())
+		require.NoError(t, err)
+		assert.Equal(t, hostA, got)
+
+		got, err = storage.Get(hostB.Key())
+		require.NoError(t, err)
+		assert.Equal(t, hostB, got)
+
+		_, err = storage.Get("test")
+		assert.Error(t, err)
+	})
+
+	t.Run("Increment histogram", func(t *testing.T) {
+		storage := mem.NewStorage()
+		observe := metric.Metric{
+			ID:        "latency",
+			MType:     metric.MetricTypeHistogram,
+			Histogram: &metric.Histogram{Buckets: []metric.Bucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 1, Count: 2}}, Sum: 0.6, Count: 2},
+		}
+
+		_, err := storage.Increment(observe)
+		require.NoError(t, err)
+		got, err := storage.Increment(observe)
+		require.NoError(t, err)
+
+		// Наблюдения складываются по бакетам, переданная гистограмма не изменяется
+		assert.Equal(t, []metric.Bucket{{UpperBound: 0.1, Count: 2}, {UpperBound: 1, Count: 4}}, got.Histogram.Buckets)
+		assert.Equal(t, uint64(4), got.Histogram.Count)
+		assert.Equal(t, uint64(2), observe.Histogram.Count)
+
+		got.Histogram.Buckets[0].Count = 100
+		stored, err := storage.Get("latency")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), stored.Histogram.Buckets[0].Count)
+	})
+
+	t.Run("Updated", func(t *testing.T) {
+		storage := mem.NewStorage()
+		before := time.Now()
+		require.NoError(t, storage.Set(metric.Metric{ID: "fresh", MType: metric.MetricTypeGauge, Value: Float64Ptr(1)}))
+		_, err := storage.Increment(metric.Metric{ID: "count", MType: metric.MetricTypeCounter, Delta: Int64Ptr(1)})
+		require.NoError(t, err)
+
+		// Время обновления из снимка сохраняется, но не попадает в саму метрику
+		restored := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, storage.Set(metric.Metric{ID: "restored", MType: metric.MetricTypeGauge, Value: Float64Ptr(2), UpdatedAt: &restored}))
+
+		updated, err := storage.Updated()
+		require.NoError(t, err)
+		require.Len(t, updated, 3)
+		assert.False(t, updated["fresh"].Before(before))
+		assert.False(t, updated["count"].Before(before))
+		assert.Equal(t, restored, updated["restored"])
+
+		got, err := storage.Get("restored")
+		require.NoError(t, err)
+		assert.Nil(t, got.UpdatedAt)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		storage := mem.NewStorage()
+		require.NoError(t, storage.Set(metric.Metric{ID: "stale", MType: metric.MetricTypeGauge, Value: Float64Ptr(1)}))
+		require.NoError(t, storage.Set(metric.Metric{ID: "stale", MType: metric.MetricTypeGauge, Value: Float64Ptr(2)}))
+		require.NoError(t, storage.Set(metric.Metric{ID: "alive", MType: metric.MetricTypeGauge, Value: Float64Ptr(3)}))
+
+		cutoff := time.Now()
+		require.NoError(t, storage.Set(metric.Metric{ID: "refreshed", MType: metric.MetricTypeGauge, Value: Float64Ptr(4)}))
+
+		deleted, samples, err := storage.Delete(map[string]time.Time{"stale": cutoff, "nonexistent": cutoff, "refreshed": cutoff})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"stale"}, deleted)
+		assert.Equal(t, 2, samples)
+
+		_, err = storage.Get("stale")
+		assert.Error(t, err)
+		history, err := storage.GetRange("stale", time.Time{}, time.Now())
+		require.NoError(t, err)
+		assert.Empty(t, history)
+
+		// Ряд, обновленный после момента отсечения, не удаляется
+		updated, err := storage.Updated()
+		require.NoError(t, err)
+		assert.Len(t, updated, 2)
+		assert.Contains(t, updated, "alive")
+		assert.Contains(t, updated, "refreshed")
+	})
+
 	t.Run("Clear", func(t *testing.T) {
 		storage := mem.NewStorage()
 		m := metric.Metric{ID: "test", MType: metric.MetricTypeGauge, Value: Float64Ptr(42.0)}
@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"encoding/json"
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+)
+
+// encodeDistributions сериализует гистограмму и summary метрики в JSON для колонок histogram и summary.
+// Отсутствующее значение хранится как NULL.
+func encodeDistributions(m metricModel.Metric) (any, any, error) {
+	var histogram, summary any
+
+	if m.Histogram != nil {
+		data, err := json.Marshal(m.Histogram)
+		if err != nil {
+			return nil, nil, err
+		}
+		histogram = string(data)
+	}
+
+	if m.Summary != nil {
+		data, err := json.Marshal(m.Summary)
+		if err != nil {
+			return nil, nil, err
+		}
+		summary = string(data)
+	}
+
+	return histogram, summary, nil
+}
+
+// decodeDistributions разбирает значения колонок histogram и summary в метрику m.
+func decodeDistributions(m *metricModel.Metric, histogram, summary []byte) error {
+	if histogram != nil {
+		m.Histogram = &metricModel.Histogram{}
+		if err := json.Unmarshal(histogram, m.Histogram); err != nil {
+			return err
+		}
+	}
+
+	if summary != nil {
+		m.Summary = &metricModel.Summary{}
+		if err := json.Unmarshal(summary, m.Summary); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
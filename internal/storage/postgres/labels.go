@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"encoding/json"
+)
+
+// encodeLabels сериализует метки в JSON для колонки labels.
+// Пустой набор меток всегда хранится как {}, чтобы ряд без меток оставался уникальным.
+func encodeLabels(labels map[string]string) (string, error) {
+	if len(labels) == 0 {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// decodeLabels разбирает значение колонки labels.
+// Для пустого набора возвращает nil, как у метрики без меток.
+func decodeLabels(data []byte) (map[string]string, error) {
+	labels := make(map[string]string)
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return nil, err
+	}
+
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	return labels, nil
+}
@@ -2,12 +2,60 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"github.com/dip96/metrics/internal/config"
 	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/storage"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"time"
 )
 
+// upsertMetricSQL сохраняет текущее значение метрики и добавляет отсчет в историю одним запросом.
+// Отсчет записывается со временем $9, а если оно не передано - с текущим.
+// Время обновления ряда - $6, если передано, иначе время отсчета.
+// Отсчет старше последнего обновления ряда не записывается, и запрос не добавляет строк.
+// TODO использовать именованные параметры в запросе
+const upsertMetricSQL = "WITH upserted AS (" +
+	"INSERT INTO metrics (name_metric, labels, type, delta, value, updated_at, histogram, summary) " +
+	"VALUES ($1,$2,$3,$4,$5,COALESCE($6::timestamptz, $9::timestamptz, now()),$7,$8) " +
+	"ON CONFLICT (name_metric, labels) " +
+	"DO UPDATE SET type = excluded.type, delta = excluded.delta, value = excluded.value, updated_at = excluded.updated_at, " +
+	"histogram = excluded.histogram, summary = excluded.summary " +
+	"WHERE $9::timestamptz IS NULL OR metrics.updated_at <= $9::timestamptz " +
+	"RETURNING name_metric, labels, type, delta, value) " +
+	"INSERT INTO metric_samples (name_metric, labels, type, delta, value, created_at) " +
+	"SELECT name_metric, labels, type, delta, value, COALESCE($9::timestamptz, now()) FROM upserted"
+
+// incrementMetricSQL прибавляет delta счетчика или value gauge к сохраненному значению и добавляет отсчет
+// в историю одним запросом, поэтому параллельные обновления одного ряда не теряются.
+// Отсчет записывается со временем $6, а если оно не передано - с текущим.
+// Ряд другого типа и отсчет старше последнего обновления ряда не записываются, и запрос не возвращает строк.
+const incrementMetricSQL = "WITH upserted AS (" +
+	"INSERT INTO metrics (name_metric, labels, type, delta, value, updated_at) " +
+	"VALUES ($1,$2,$3,$4,$5,COALESCE($6::timestamptz, now())) " +
+	"ON CONFLICT (name_metric, labels) " +
+	"DO UPDATE SET delta = COALESCE(metrics.delta, 0) + excluded.delta, " +
+	"value = COALESCE(metrics.value, 0) + excluded.value, updated_at = excluded.updated_at " +
+	"WHERE metrics.type = excluded.type AND ($6::timestamptz IS NULL OR metrics.updated_at <= $6::timestamptz) " +
+	"RETURNING name_metric, labels, type, delta, value, updated_at), " +
+	"sample AS (" +
+	"INSERT INTO metric_samples (name_metric, labels, type, delta, value, created_at) " +
+	"SELECT name_metric, labels, type, delta, value, updated_at FROM upserted) " +
+	"SELECT name_metric, labels, type, delta, value FROM upserted"
+
+// addRollupSQL объединяет агрегат с сохраненным агрегатом того же окна (см. metricModel.Rollup.Merge).
+const addRollupSQL = "INSERT INTO metric_rollups " +
+	"(name_metric, labels, resolution, started_at, min, max, sum, count, last, increase) " +
+	"VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) " +
+	"ON CONFLICT (name_metric, labels, resolution, started_at) " +
+	"DO UPDATE SET min = LEAST(metric_rollups.min, excluded.min), " +
+	"max = GREATEST(metric_rollups.max, excluded.max), " +
+	"sum = metric_rollups.sum + excluded.sum, " +
+	"count = metric_rollups.count + excluded.count, " +
+	"last = excluded.last, " +
+	"increase = metric_rollups.increase + excluded.increase"
+
 type DB struct {
 	Pool *PoolWrapper
 }
@@ -28,33 +76,57 @@ func NewDB() (*DB, error) {
 	return &DB{Pool: wrappedPool}, nil
 }
 
+// Get возвращает метрику по идентификатору ряда (см. metricModel.SeriesKey).
 func (d *DB) Get(name string) (metricModel.Metric, error) {
 	err := d.Ping()
 	if err != nil {
 		return metricModel.Metric{}, err
 	}
 
-	sql := "SELECT name_metric, type, delta, value FROM metrics " +
-		"WHERE name_metric = $1"
+	nameMetric, labels, err := metricModel.ParseSeriesKey(name)
+	if err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	labelsJSON, err := encodeLabels(labels)
+	if err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	sql := "SELECT name_metric, labels, type, delta, value, histogram, summary FROM metrics " +
+		"WHERE name_metric = $1 AND labels = $2"
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	row := d.Pool.pool.QueryRow(ctx, sql, name)
+	row := d.Pool.pool.QueryRow(ctx, sql, nameMetric, labelsJSON)
 
 	var metrics metricModel.Metric
+	var rawLabels, rawHistogram, rawSummary []byte
 
 	err = row.Scan(
 		&metrics.ID,
+		&rawLabels,
 		&metrics.MType,
 		&metrics.Delta,
 		&metrics.Value,
+		&rawHistogram,
+		&rawSummary,
 	)
 
 	if err != nil {
 		return metricModel.Metric{}, err
 	}
 
+	metrics.Labels, err = decodeLabels(rawLabels)
+	if err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	if err = decodeDistributions(&metrics, rawHistogram, rawSummary); err != nil {
+		return metricModel.Metric{}, err
+	}
+
 	return metrics, nil
 }
 
@@ -64,28 +136,221 @@ func (d *DB) Set(metric metricModel.Metric) error {
 		return err
 	}
 
-	//TODO использовать именованные параметры в запросе
-	sql := "INSERT INTO metrics (name_metric, type, delta, value)" +
-		"VALUES ($1,$2,$3,$4)" +
-		"ON CONFLICT (name_metric)" +
-		"DO UPDATE SET delta = excluded.delta, value = excluded.value"
+	labelsJSON, err := encodeLabels(metric.Labels)
+	if err != nil {
+		return err
+	}
+
+	histogram, summary, err := encodeDistributions(metric)
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err = d.Pool.Exec(ctx, sql,
+	tag, err := d.Pool.Exec(ctx, upsertMetricSQL,
 		metric.ID,
+		labelsJSON,
 		metric.MType,
 		metric.Delta,
 		metric.Value,
+		metric.UpdatedAt,
+		histogram,
+		summary,
+		metric.Timestamp,
 	)
 
 	if err != nil {
 		return err
 	}
 
+	if tag.RowsAffected() == 0 {
+		return storage.ErrOutOfOrder
+	}
+
 	return nil
 }
 
+// Increment атомарно прибавляет delta к счетчику или value к gauge на стороне базы данных.
+// Гистограммы и summary объединяются с сохраненным значением, см. incrementDistribution.
+func (d *DB) Increment(metric metricModel.Metric) (metricModel.Metric, error) {
+	if metric.Histogram != nil || metric.Summary != nil {
+		return d.incrementDistribution(metric)
+	}
+
+	if metric.Delta == nil && metric.Value == nil {
+		return metricModel.Metric{}, errors.New("the metric delta is empty")
+	}
+
+	err := d.Ping()
+	if err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	labelsJSON, err := encodeLabels(metric.Labels)
+	if err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	row := d.Pool.pool.QueryRow(ctx, incrementMetricSQL,
+		metric.ID,
+		labelsJSON,
+		metric.MType,
+		metric.Delta,
+		metric.Value,
+		metric.Timestamp,
+	)
+
+	var result metricModel.Metric
+	var rawLabels []byte
+
+	err = row.Scan(
+		&result.ID,
+		&rawLabels,
+		&result.MType,
+		&result.Delta,
+		&result.Value,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return metricModel.Metric{}, d.rejectReason(metric, labelsJSON)
+	}
+
+	if err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	result.Labels, err = decodeLabels(rawLabels)
+	if err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	return result, nil
+}
+
+// rejectReason возвращает причину, по которой incrementMetricSQL не записал отсчет metric:
+// ErrTypeMismatch, если ряд сохранен с другим типом, иначе ErrOutOfOrder.
+func (d *DB) rejectReason(metric metricModel.Metric, labelsJSON string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var storedType metricModel.MetricType
+	err := d.Pool.pool.QueryRow(ctx, "SELECT type FROM metrics WHERE name_metric = $1 AND labels = $2",
+		metric.ID, labelsJSON).Scan(&storedType)
+	if err != nil {
+		return err
+	}
+
+	if storedType != metric.MType {
+		return storage.ErrTypeMismatch
+	}
+
+	return storage.ErrOutOfOrder
+}
+
+// incrementDistribution объединяет наблюдения гистограммы или summary с сохраненным значением.
+// Объединение выполняется в транзакции под рекомендательной блокировкой ряда,
+// поэтому параллельные обновления одного ряда не теряются, в том числе при создании ряда.
+func (d *DB) incrementDistribution(metric metricModel.Metric) (metricModel.Metric, error) {
+	err := d.Ping()
+	if err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	labelsJSON, err := encodeLabels(metric.Labels)
+	if err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return metricModel.Metric{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", metric.Key()); err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	var storedType metricModel.MetricType
+	var rawHistogram, rawSummary []byte
+	var updatedAt time.Time
+	err = tx.QueryRow(ctx, "SELECT type, histogram, summary, updated_at FROM metrics WHERE name_metric = $1 AND labels = $2",
+		metric.ID, labelsJSON).Scan(&storedType, &rawHistogram, &rawSummary, &updatedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return metricModel.Metric{}, err
+	}
+
+	if err == nil && storedType != metric.MType {
+		return metricModel.Metric{}, storage.ErrTypeMismatch
+	}
+
+	if err == nil && metric.Timestamp != nil && metric.Timestamp.Before(updatedAt) {
+		return metricModel.Metric{}, storage.ErrOutOfOrder
+	}
+
+	stored := metricModel.Metric{}
+	if err == nil {
+		if err = decodeDistributions(&stored, rawHistogram, rawSummary); err != nil {
+			return metricModel.Metric{}, err
+		}
+	}
+
+	result := metric
+	result.UpdatedAt = nil
+	result.Timestamp = nil
+	if metric.Histogram != nil {
+		histogram := metricModel.Histogram{}
+		if stored.Histogram != nil {
+			histogram = *stored.Histogram
+		}
+		histogram.Merge(*metric.Histogram)
+		result.Histogram = &histogram
+	}
+
+	if metric.Summary != nil {
+		summary := metricModel.Summary{}
+		if stored.Summary != nil {
+			summary = *stored.Summary
+		}
+		summary.Merge(*metric.Summary)
+		result.Summary = &summary
+	}
+
+	histogram, summary, err := encodeDistributions(result)
+	if err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	_, err = tx.Exec(ctx, upsertMetricSQL,
+		result.ID,
+		labelsJSON,
+		result.MType,
+		result.Delta,
+		result.Value,
+		nil,
+		histogram,
+		summary,
+		metric.Timestamp,
+	)
+	if err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return metricModel.Metric{}, err
+	}
+
+	return result, nil
+}
+
 func (d *DB) SetAll(metrics map[string]metricModel.Metric) error {
 	err := d.Ping()
 	if err != nil {
@@ -99,17 +364,27 @@ func (d *DB) SetAll(metrics map[string]metricModel.Metric) error {
 	}
 	defer tx.Rollback(ctx)
 
-	sql := "INSERT INTO metrics (name_metric, type, delta, value)" +
-		"VALUES ($1,$2,$3,$4)" +
-		"ON CONFLICT (name_metric)" +
-		"DO UPDATE SET delta = excluded.delta, value = excluded.value"
-
 	for _, metricValue := range metrics {
-		_, err = tx.Exec(context.Background(), sql,
+		labelsJSON, err := encodeLabels(metricValue.Labels)
+		if err != nil {
+			return err
+		}
+
+		histogram, summary, err := encodeDistributions(metricValue)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(context.Background(), upsertMetricSQL,
 			metricValue.ID,
+			labelsJSON,
 			metricValue.MType,
 			metricValue.Delta,
 			metricValue.Value,
+			metricValue.UpdatedAt,
+			histogram,
+			summary,
+			metricValue.Timestamp,
 		)
 		if err != nil {
 			return err
@@ -119,13 +394,69 @@ func (d *DB) SetAll(metrics map[string]metricModel.Metric) error {
 	return tx.Commit(ctx)
 }
 
+// Append записывает отсчеты в одной транзакции.
+func (d *DB) Append(metrics []metricModel.Metric) ([]metricModel.Metric, error) {
+	err := d.Ping()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	written := make([]metricModel.Metric, 0, len(metrics))
+	for _, metricValue := range metrics {
+		labelsJSON, err := encodeLabels(metricValue.Labels)
+		if err != nil {
+			return nil, err
+		}
+
+		histogram, summary, err := encodeDistributions(metricValue)
+		if err != nil {
+			return nil, err
+		}
+
+		tag, err := tx.Exec(ctx, upsertMetricSQL,
+			metricValue.ID,
+			labelsJSON,
+			metricValue.MType,
+			metricValue.Delta,
+			metricValue.Value,
+			metricValue.UpdatedAt,
+			histogram,
+			summary,
+			metricValue.Timestamp,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		// Отсчет старше последнего обновления ряда
+		if tag.RowsAffected() == 0 {
+			continue
+		}
+
+		written = append(written, metricValue)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return written, nil
+}
+
 func (d *DB) GetAll() (map[string]metricModel.Metric, error) {
 	err := d.Ping()
 	if err != nil {
 		return nil, err
 	}
 
-	sql := "SELECT name_metric, type, delta, value FROM metrics"
+	sql := "SELECT name_metric, labels, type, delta, value, histogram, summary FROM metrics"
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -140,28 +471,327 @@ func (d *DB) GetAll() (map[string]metricModel.Metric, error) {
 
 	for rows.Next() {
 		metric := metricModel.Metric{}
+		var rawLabels, rawHistogram, rawSummary []byte
 		err = rows.Scan(
 			&metric.ID,
+			&rawLabels,
 			&metric.MType,
 			&metric.Delta,
-			&metric.Value)
+			&metric.Value,
+			&rawHistogram,
+			&rawSummary)
+		if err != nil {
+			return nil, err
+		}
+
+		metric.Labels, err = decodeLabels(rawLabels)
 		if err != nil {
 			return nil, err
 		}
 
-		metrics[metric.ID] = metric
+		if err = decodeDistributions(&metric, rawHistogram, rawSummary); err != nil {
+			return nil, err
+		}
+
+		metrics[metric.Key()] = metric
 	}
 
 	return metrics, nil
 }
 
+// GetRange возвращает историю значений метрики за период [from, to].
+func (d *DB) GetRange(name string, from, to time.Time) ([]metricModel.Sample, error) {
+	err := d.Ping()
+	if err != nil {
+		return nil, err
+	}
+
+	nameMetric, labels, err := metricModel.ParseSeriesKey(name)
+	if err != nil {
+		return nil, err
+	}
+
+	labelsJSON, err := encodeLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	sql := "SELECT created_at, delta, value FROM metric_samples " +
+		"WHERE name_metric = $1 AND labels = $2 AND created_at BETWEEN $3 AND $4 " +
+		"ORDER BY created_at, id"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := d.Pool.Query(ctx, sql, nameMetric, labelsJSON, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([]metricModel.Sample, 0)
+
+	for rows.Next() {
+		sample := metricModel.Sample{}
+		err = rows.Scan(
+			&sample.Timestamp,
+			&sample.Delta,
+			&sample.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		samples = append(samples, sample)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// Updated возвращает время последнего обновления каждого ряда.
+func (d *DB) Updated() (map[string]time.Time, error) {
+	err := d.Ping()
+	if err != nil {
+		return nil, err
+	}
+
+	sql := "SELECT name_metric, labels, updated_at FROM metrics"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := d.Pool.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	updated := make(map[string]time.Time)
+
+	for rows.Next() {
+		var name string
+		var rawLabels []byte
+		var updatedAt time.Time
+		err = rows.Scan(&name, &rawLabels, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		labels, err := decodeLabels(rawLabels)
+		if err != nil {
+			return nil, err
+		}
+
+		updated[metricModel.SeriesKey(name, labels)] = updatedAt
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// Delete удаляет ряды вместе с историей в одной транзакции.
+// Ряд удаляется, только если время его обновления в момент удаления раньше заданного.
+func (d *DB) Delete(stale map[string]time.Time) ([]string, int, error) {
+	err := d.Ping()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx := context.Background()
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	deleted, samples := make([]string, 0, len(stale)), 0
+	for key, cutoff := range stale {
+		name, labels, err := metricModel.ParseSeriesKey(key)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		labelsJSON, err := encodeLabels(labels)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		tag, err := tx.Exec(ctx, "DELETE FROM metrics WHERE name_metric = $1 AND labels = $2 AND updated_at < $3", name, labelsJSON, cutoff)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// Ряд обновлен после чтения времени обновления
+		if tag.RowsAffected() == 0 {
+			continue
+		}
+		deleted = append(deleted, key)
+
+		tag, err = tx.Exec(ctx, "DELETE FROM metric_samples WHERE name_metric = $1 AND labels = $2", name, labelsJSON)
+		if err != nil {
+			return nil, 0, err
+		}
+		samples += int(tag.RowsAffected())
+
+		_, err = tx.Exec(ctx, "DELETE FROM metric_rollups WHERE name_metric = $1 AND labels = $2", name, labelsJSON)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	return deleted, samples, nil
+}
+
+// AddRollups объединяет агрегаты с сохраненными агрегатами тех же окон в одной транзакции.
+func (d *DB) AddRollups(resolution time.Duration, rollups []metricModel.Rollup) error {
+	err := d.Ping()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, rollup := range rollups {
+		name, labels, err := metricModel.ParseSeriesKey(rollup.Series)
+		if err != nil {
+			return err
+		}
+
+		labelsJSON, err := encodeLabels(labels)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, addRollupSQL,
+			name,
+			labelsJSON,
+			int64(resolution/time.Second),
+			rollup.Start,
+			rollup.Min,
+			rollup.Max,
+			rollup.Sum,
+			rollup.Count,
+			rollup.Last,
+			rollup.Increase,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetRollups возвращает агрегаты ряда, окна которых начинаются в период [from, to].
+func (d *DB) GetRollups(key string, resolution time.Duration, from, to time.Time) ([]metricModel.Rollup, error) {
+	err := d.Ping()
+	if err != nil {
+		return nil, err
+	}
+
+	name, labels, err := metricModel.ParseSeriesKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	labelsJSON, err := encodeLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	sql := "SELECT started_at, min, max, sum, count, last, increase FROM metric_rollups " +
+		"WHERE name_metric = $1 AND labels = $2 AND resolution = $3 AND started_at BETWEEN $4 AND $5 " +
+		"ORDER BY started_at"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := d.Pool.Query(ctx, sql, name, labelsJSON, int64(resolution/time.Second), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rollups := make([]metricModel.Rollup, 0)
+
+	for rows.Next() {
+		rollup := metricModel.Rollup{Series: key}
+		err = rows.Scan(
+			&rollup.Start,
+			&rollup.Min,
+			&rollup.Max,
+			&rollup.Sum,
+			&rollup.Count,
+			&rollup.Last,
+			&rollup.Increase)
+		if err != nil {
+			return nil, err
+		}
+
+		rollups = append(rollups, rollup)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rollups, nil
+}
+
+// DeleteRollups удаляет агрегаты уровня, окна которых начались раньше before.
+func (d *DB) DeleteRollups(resolution time.Duration, before time.Time) error {
+	err := d.Ping()
+	if err != nil {
+		return err
+	}
+
+	sql := "DELETE FROM metric_rollups WHERE resolution = $1 AND started_at < $2"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = d.Pool.Exec(ctx, sql, int64(resolution/time.Second), before)
+	return err
+}
+
+// DeleteSamples удаляет отсчеты истории, записанные раньше before.
+func (d *DB) DeleteSamples(before time.Time) error {
+	err := d.Ping()
+	if err != nil {
+		return err
+	}
+
+	sql := "DELETE FROM metric_samples WHERE created_at < $1"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = d.Pool.Exec(ctx, sql, before)
+	return err
+}
+
 func (d *DB) Clear() error {
 	err := d.Ping()
 	if err != nil {
 		return err
 	}
 
-	sql := "TRUNCATE TABLE metrics"
+	sql := "TRUNCATE TABLE metrics, metric_samples, metric_rollups"
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
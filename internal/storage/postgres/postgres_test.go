@@ -4,7 +4,9 @@ import (
 	metricModel "github.com/dip96/metrics/internal/model/metric"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewDB(t *testing.T) {
@@ -77,6 +79,102 @@ func TestSet(t *testing.T) {
 	})
 }
 
+func TestLabels(t *testing.T) {
+	db, err := NewDB()
+	require.NoError(t, err)
+	defer db.Pool.Close()
+
+	db.Clear()
+
+	t.Run("series with different labels", func(t *testing.T) {
+		hostA := metricModel.Metric{
+			ID:     "test_metric",
+			MType:  metricModel.MetricTypeGauge,
+			Value:  Float64Ptr(1),
+			Labels: map[string]string{"host": "a"},
+		}
+		hostB := metricModel.Metric{
+			ID:     "test_metric",
+			MType:  metricModel.MetricTypeGauge,
+			Value:  Float64Ptr(2),
+			Labels: map[string]string{"host": "b"},
+		}
+
+		require.NoError(t, db.Set(hostA))
+		require.NoError(t, db.Set(hostB))
+
+		result, err := db.Get(hostA.Key())
+		require.NoError(t, err)
+		assert.Equal(t, hostA, result)
+
+		all, err := db.GetAll()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]metricModel.Metric{
+			hostA.Key(): hostA,
+			hostB.Key(): hostB,
+		}, all)
+	})
+}
+
+func TestIncrement(t *testing.T) {
+	db, err := NewDB()
+	require.NoError(t, err)
+	defer db.Pool.Close()
+
+	db.Clear()
+
+	t.Run("concurrent increments", func(t *testing.T) {
+		const workers = 10
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := db.Increment(metricModel.Metric{
+					ID:    "test_counter",
+					MType: metricModel.MetricTypeCounter,
+					Delta: Int64Ptr(2),
+				})
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		result, err := db.Get("test_counter")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2*workers), *result.Delta)
+	})
+}
+
+func TestIncrementHistogram(t *testing.T) {
+	db, err := NewDB()
+	require.NoError(t, err)
+	defer db.Pool.Close()
+
+	db.Clear()
+
+	t.Run("merge buckets", func(t *testing.T) {
+		observe := metricModel.Metric{
+			ID:        "test_histogram",
+			MType:     metricModel.MetricTypeHistogram,
+			Histogram: &metricModel.Histogram{Buckets: []metricModel.Bucket{{UpperBound: 1, Count: 1}}, Sum: 0.5, Count: 2},
+		}
+
+		_, err := db.Increment(observe)
+		require.NoError(t, err)
+		_, err = db.Increment(observe)
+		require.NoError(t, err)
+
+		result, err := db.Get("test_histogram")
+		require.NoError(t, err)
+		require.NotNil(t, result.Histogram)
+		assert.Equal(t, []metricModel.Bucket{{UpperBound: 1, Count: 2}}, result.Histogram.Buckets)
+		assert.Equal(t, uint64(4), result.Histogram.Count)
+		assert.Equal(t, 1.0, result.Histogram.Sum)
+	})
+}
+
 func TestSetAll(t *testing.T) {
 	db, err := NewDB()
 	require.NoError(t, err)
@@ -142,6 +240,101 @@ func TestGetAll(t *testing.T) {
 	})
 }
 
+func TestGetRange(t *testing.T) {
+	db, err := NewDB()
+	require.NoError(t, err)
+	defer db.Pool.Close()
+
+	db.Clear()
+
+	t.Run("success", func(t *testing.T) {
+		from := time.Now().Add(-time.Minute)
+
+		for _, value := range []float64{1, 2} {
+			err = db.Set(metricModel.Metric{
+				ID:    "test_metric",
+				MType: metricModel.MetricTypeGauge,
+				Value: Float64Ptr(value),
+			})
+			require.NoError(t, err)
+		}
+
+		result, err := db.GetRange("test_metric", from, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.Len(t, result, 2)
+		assert.Equal(t, 1.0, *result[0].Value)
+		assert.Equal(t, 2.0, *result[1].Value)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		result, err := db.GetRange("non_existing_metric", time.Now().Add(-time.Minute), time.Now())
+		require.NoError(t, err)
+		assert.Empty(t, result)
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	db, err := NewDB()
+	require.NoError(t, err)
+	defer db.Pool.Close()
+
+	db.Clear()
+
+	t.Run("updated and delete", func(t *testing.T) {
+		restored := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		err = db.Set(metricModel.Metric{ID: "stale", MType: metricModel.MetricTypeGauge, Value: Float64Ptr(1), UpdatedAt: &restored})
+		require.NoError(t, err)
+		err = db.Set(metricModel.Metric{ID: "alive", MType: metricModel.MetricTypeGauge, Value: Float64Ptr(2)})
+		require.NoError(t, err)
+
+		updated, err := db.Updated()
+		require.NoError(t, err)
+		require.Len(t, updated, 2)
+		assert.True(t, restored.Equal(updated["stale"]))
+
+		cutoff := restored.Add(time.Second)
+		deleted, samples, err := db.Delete(map[string]time.Time{"stale": cutoff, "alive": cutoff})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"stale"}, deleted)
+		assert.Equal(t, 1, samples)
+
+		_, err = db.Get("stale")
+		assert.Error(t, err)
+		_, err = db.Get("alive")
+		assert.NoError(t, err)
+	})
+}
+
+func TestRollups(t *testing.T) {
+	db, err := NewDB()
+	require.NoError(t, err)
+	defer db.Pool.Close()
+
+	db.Clear()
+
+	t.Run("merge windows", func(t *testing.T) {
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		first := metricModel.Rollup{Series: "test_metric", Start: start, Min: 1, Max: 3, Sum: 4, Count: 2, Last: 3, Increase: 2}
+		second := metricModel.Rollup{Series: "test_metric", Start: start, Min: 0, Max: 2, Sum: 2, Count: 2, Last: 2, Increase: -1}
+
+		require.NoError(t, db.AddRollups(time.Minute, []metricModel.Rollup{first}))
+		require.NoError(t, db.AddRollups(time.Minute, []metricModel.Rollup{second}))
+
+		first.Merge(second)
+		result, err := db.GetRollups("test_metric", time.Minute, start, start.Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, result, 1)
+		assert.True(t, first.Start.Equal(result[0].Start))
+		result[0].Start = first.Start
+		assert.Equal(t, first, result[0])
+
+		require.NoError(t, db.DeleteRollups(time.Minute, start.Add(time.Minute)))
+		result, err = db.GetRollups("test_metric", time.Minute, start, start.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Empty(t, result)
+	})
+}
+
 func TestPing(t *testing.T) {
 	db, err := NewDB()
 	require.NoError(t, err)
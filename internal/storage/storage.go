@@ -1,15 +1,46 @@
 package storage
 
-import "github.com/dip96/metrics/internal/model/metric"
+import (
+	"errors"
+	"github.com/dip96/metrics/internal/model/metric"
+	"time"
+)
 
 var Storage StorageInterface
 
+// ErrTypeMismatch - ошибка Increment, если ряд уже сохранен с другим типом метрики.
+var ErrTypeMismatch = errors.New("the metric type differs from the stored one")
+
+// ErrOutOfOrder - ошибка записи отсчета, время которого (metric.Metric.Timestamp)
+// раньше последнего обновления ряда.
+var ErrOutOfOrder = errors.New("the sample is older than the last update of the series")
+
 // TODO имплеменить в файл storage/files
+//
+// Set, Increment и Append записывают отсчет со временем metric.Metric.Timestamp, если оно задано.
+// Такой отсчет не может быть старше последнего обновления ряда: Set и Increment
+// возвращают ErrOutOfOrder, а Append его пропускает. Ряд при этом не изменяется.
 type StorageInterface interface {
 	Get(name string) (metric.Metric, error)
 	Set(metric metric.Metric) error
+	// Increment атомарно прибавляет Delta метрики типа counter или Value метрики типа gauge
+	// к сохраненному значению, а наблюдения метрик типа histogram и summary объединяет с сохраненными (см. metric.Histogram.Merge),
+	// и возвращает метрику с итоговым значением. Если ряда нет, он создается.
+	// Если ряд сохранен с другим типом, возвращается ErrTypeMismatch, а ряд не изменяется.
+	Increment(metric metric.Metric) (metric.Metric, error)
 	GetAll() (map[string]metric.Metric, error)
 	SetAll(map[string]metric.Metric) error
+	// Append записывает отсчеты metrics как Set в порядке следования, поэтому в одном вызове
+	// может быть несколько отсчетов одного ряда. Возвращает записанные отсчеты.
+	Append(metrics []metric.Metric) ([]metric.Metric, error)
+	// GetRange возвращает историю значений метрики за период [from, to] в порядке возрастания времени.
+	GetRange(name string, from, to time.Time) ([]metric.Sample, error)
+	// Updated возвращает время последнего обновления каждого ряда по его ключу.
+	Updated() (map[string]time.Time, error)
+	// Delete удаляет вместе с историей ряды stale, не обновлявшиеся с момента, заданного для ключа ряда.
+	// Проверка времени обновления и удаление выполняются атомарно, поэтому ряд, обновленный
+	// после чтения Updated, не удаляется. Возвращает ключи удаленных рядов и количество отсчетов истории.
+	Delete(stale map[string]time.Time) ([]string, int, error)
 	Clear() error
 	Close()
 }
@@ -0,0 +1,148 @@
+package storage_test
+
+import (
+	"testing"
+	"time"
+
+	metricModel "github.com/dip96/metrics/internal/model/metric"
+	"github.com/dip96/metrics/internal/rollup"
+	"github.com/dip96/metrics/internal/storage"
+	memStorage "github.com/dip96/metrics/internal/storage/mem"
+	postgresStorage "github.com/dip96/metrics/internal/storage/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backends возвращает реализации хранилища для общих тестов.
+// Postgres проверяется, только если база данных доступна.
+func backends(t *testing.T) map[string]func(t *testing.T) storage.StorageInterface {
+	return map[string]func(t *testing.T) storage.StorageInterface{
+		"mem": func(t *testing.T) storage.StorageInterface {
+			return memStorage.NewStorage()
+		},
+		"postgres": func(t *testing.T) storage.StorageInterface {
+			db, err := postgresStorage.NewDB()
+			if err != nil || db.Ping() != nil {
+				t.Skip("database is not available")
+			}
+			t.Cleanup(db.Close)
+			return db
+		},
+	}
+}
+
+func TestGetRangeUnknownSeries(t *testing.T) {
+	for name, newStorage := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := newStorage(t)
+
+			samples, err := store.GetRange(`unknown_series{host="a"}`, time.Now().Add(-time.Hour), time.Now())
+			require.NoError(t, err)
+			assert.Empty(t, samples)
+		})
+	}
+}
+
+func TestDeleteSamples(t *testing.T) {
+	for name, newStorage := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := newStorage(t)
+			require.NoError(t, store.Clear())
+
+			value := 1.0
+			m := metricModel.Metric{ID: "retention_test", MType: metricModel.MetricTypeGauge, Value: &value, Labels: map[string]string{"host": "a"}}
+			require.NoError(t, store.Set(m))
+
+			samples, ok := store.(rollup.SampleStore)
+			require.True(t, ok)
+
+			history := func() []metricModel.Sample {
+				h, err := store.GetRange(m.Key(), time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+				require.NoError(t, err)
+				return h
+			}
+
+			require.NoError(t, samples.DeleteSamples(time.Now().Add(-time.Minute)))
+			assert.Len(t, history(), 1)
+
+			require.NoError(t, samples.DeleteSamples(time.Now().Add(time.Minute)))
+			assert.Empty(t, history())
+
+			_, err := store.Get(m.Key())
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestIncrementTypeMismatch(t *testing.T) {
+	for name, newStorage := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := newStorage(t)
+			require.NoError(t, store.Clear())
+
+			value := 1.5
+			require.NoError(t, store.Set(metricModel.Metric{ID: "mismatch", MType: metricModel.MetricTypeGauge, Value: &value}))
+
+			delta := int64(2)
+			_, err := store.Increment(metricModel.Metric{ID: "mismatch", MType: metricModel.MetricTypeCounter, Delta: &delta})
+			assert.ErrorIs(t, err, storage.ErrTypeMismatch)
+
+			_, err = store.Increment(metricModel.Metric{ID: "mismatch", MType: metricModel.MetricTypeHistogram,
+				Histogram: &metricModel.Histogram{Count: 1, Sum: 1}})
+			assert.ErrorIs(t, err, storage.ErrTypeMismatch)
+
+			// Ряд другого типа не изменяется
+			stored, err := store.Get("mismatch")
+			require.NoError(t, err)
+			assert.Equal(t, metricModel.MetricTypeGauge, stored.MType)
+			assert.Equal(t, 1.5, *stored.Value)
+		})
+	}
+}
+
+func TestAppendOutOfOrder(t *testing.T) {
+	for name, newStorage := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := newStorage(t)
+			require.NoError(t, store.Clear())
+
+			start := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+			sample := func(value float64, ts time.Time) metricModel.Metric {
+				return metricModel.Metric{ID: "append_test", MType: metricModel.MetricTypeGauge, Value: &value, Timestamp: &ts}
+			}
+
+			// Отсчеты одного ряда записываются в историю каждый со своим временем
+			written, err := store.Append([]metricModel.Metric{
+				sample(1, start),
+				sample(2, start.Add(time.Minute)),
+				sample(3, start.Add(30*time.Second)),
+			})
+			require.NoError(t, err)
+			assert.Len(t, written, 2)
+
+			history, err := store.GetRange("append_test", start, start.Add(time.Hour))
+			require.NoError(t, err)
+			require.Len(t, history, 2)
+			assert.True(t, start.Equal(history[0].Timestamp))
+			assert.True(t, start.Add(time.Minute).Equal(history[1].Timestamp))
+
+			stored, err := store.Get("append_test")
+			require.NoError(t, err)
+			assert.Equal(t, 2.0, *stored.Value)
+
+			// Set и Increment тоже отклоняют отсчет старше последнего обновления ряда
+			assert.ErrorIs(t, store.Set(sample(4, start)), storage.ErrOutOfOrder)
+
+			delta, ts := int64(1), start.Add(time.Minute)
+			_, err = store.Increment(metricModel.Metric{ID: "append_counter", MType: metricModel.MetricTypeCounter, Delta: &delta, Timestamp: &ts})
+			require.NoError(t, err)
+			old := start
+			_, err = store.Increment(metricModel.Metric{ID: "append_counter", MType: metricModel.MetricTypeCounter, Delta: &delta, Timestamp: &old})
+			assert.ErrorIs(t, err, storage.ErrOutOfOrder)
+
+			updated, err := store.Updated()
+			require.NoError(t, err)
+			assert.True(t, ts.Equal(updated["append_counter"]))
+		})
+	}
+}
@@ -50,5 +50,15 @@ func parsePublicKey(pemData []byte) (*rsa.PublicKey, error) {
 	if block == nil {
 		return nil, errors.New("failed to decode PEM block containing public key")
 	}
+
+	// generate.Generate сохраняет ключ в формате PKIX, поэтому сначала пробуем его
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("public key is not an RSA key")
+		}
+		return rsaKey, nil
+	}
+
 	return x509.ParsePKCS1PublicKey(block.Bytes)
 }
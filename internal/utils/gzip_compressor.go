@@ -3,6 +3,7 @@ package utils
 import (
 	"bytes"
 	"compress/gzip"
+	"strings"
 )
 
 func GzipCompress(data []byte) ([]byte, error) {
@@ -20,3 +21,23 @@ func GzipCompress(data []byte) ([]byte, error) {
 
 	return b.Bytes(), nil
 }
+
+// AcceptsGzip проверяет, разрешает ли заголовок Accept-Encoding ответ в формате gzip.
+func AcceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(params[0]) != "gzip" {
+			continue
+		}
+
+		for _, param := range params[1:] {
+			if q := strings.TrimSpace(param); q == "q=0" || q == "q=0.0" || q == "q=0.00" || q == "q=0.000" {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
@@ -58,3 +58,11 @@ func TestGzipCompress(t *testing.T) {
 		assert.Empty(t, decompressed)
 	})
 }
+
+func TestAcceptsGzip(t *testing.T) {
+	assert.True(t, utils.AcceptsGzip("gzip"))
+	assert.True(t, utils.AcceptsGzip("deflate, gzip;q=0.8"))
+	assert.False(t, utils.AcceptsGzip("gzip;q=0"))
+	assert.False(t, utils.AcceptsGzip("deflate"))
+	assert.False(t, utils.AcceptsGzip(""))
+}
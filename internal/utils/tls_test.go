@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA - тестовый удостоверяющий центр для выпуска сертификатов сервера и агентов.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "metrics-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key, dir: t.TempDir()}
+}
+
+// caFile сохраняет сертификат CA и возвращает путь до него.
+func (ca *testCA) caFile(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(ca.dir, "ca.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600))
+	return path
+}
+
+// issue выпускает сертификат с CN name и возвращает пути до сертификата и ключа.
+func (ca *testCA) issue(t *testing.T, name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(ca.dir, name+".pem")
+	keyPath := filepath.Join(ca.dir, name+"-key.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return certPath, keyPath
+}
+
+// handshake выполняет TLS рукопожатие через loopback и возвращает состояние соединения на стороне сервера.
+func handshake(serverConfig, clientConfig *tls.Config) (tls.ConnectionState, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer lis.Close()
+
+	clientErr := make(chan error, 1)
+	go func() {
+		conn, err := tls.Dial("tcp", lis.Addr().String(), clientConfig)
+		if err != nil {
+			clientErr <- err
+			return
+		}
+		defer conn.Close()
+
+		// При TLS 1.3 сервер проверяет сертификат клиента после завершения рукопожатия на стороне клиента,
+		// поэтому ошибка проверки приходит только при чтении
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		clientErr <- err
+	}()
+
+	conn, err := lis.Accept()
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+
+	server := tls.Server(conn, serverConfig)
+	err = server.Handshake()
+	if err == nil {
+		_, err = server.Write([]byte{1})
+	}
+	if cErr := <-clientErr; err == nil {
+		err = cErr
+	}
+
+	return server.ConnectionState(), err
+}
+
+func TestTLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+	caPath := ca.caFile(t)
+	serverCert, serverKey := ca.issue(t, "server", 2, x509.ExtKeyUsageServerAuth)
+	agentCert, agentKey := ca.issue(t, "agent-1", 3, x509.ExtKeyUsageClientAuth)
+
+	t.Run("disabled", func(t *testing.T) {
+		serverConfig, err := ServerTLSConfig("", "", "")
+		require.NoError(t, err)
+		assert.Nil(t, serverConfig)
+
+		clientConfig, err := ClientTLSConfig("", "", "", "")
+		require.NoError(t, err)
+		assert.Nil(t, clientConfig)
+
+		_, err = ServerTLSConfig("", "", caPath)
+		assert.Error(t, err)
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		serverConfig, err := ServerTLSConfig(serverCert, serverKey, "")
+		require.NoError(t, err)
+
+		clientConfig, err := ClientTLSConfig(caPath, "", "", "")
+		require.NoError(t, err)
+		clientConfig.ServerName = "127.0.0.1"
+
+		_, err = handshake(serverConfig, clientConfig)
+		assert.NoError(t, err)
+	})
+
+	t.Run("mutual tls", func(t *testing.T) {
+		serverConfig, err := ServerTLSConfig(serverCert, serverKey, caPath)
+		require.NoError(t, err)
+
+		clientConfig, err := ClientTLSConfig(caPath, agentCert, agentKey, "127.0.0.1")
+		require.NoError(t, err)
+
+		state, err := handshake(serverConfig, clientConfig)
+		require.NoError(t, err)
+		require.NotEmpty(t, state.VerifiedChains)
+		assert.Equal(t, "agent-1", state.VerifiedChains[0][0].Subject.CommonName)
+	})
+
+	t.Run("mutual tls without client certificate", func(t *testing.T) {
+		serverConfig, err := ServerTLSConfig(serverCert, serverKey, caPath)
+		require.NoError(t, err)
+
+		clientConfig, err := ClientTLSConfig(caPath, "", "", "127.0.0.1")
+		require.NoError(t, err)
+
+		_, err = handshake(serverConfig, clientConfig)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1 @@
+DROP TABLE metric_samples
\ No newline at end of file
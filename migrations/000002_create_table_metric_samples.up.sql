@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS metric_samples (
+    id bigserial PRIMARY KEY,
+    name_metric CHARACTER VARYING(100) NOT NULL,
+    type CHARACTER VARYING(30) NOT NULL,
+    delta bigint,
+    value double precision,
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS metric_samples_name_metric_created_at_idx ON metric_samples (name_metric, created_at)
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS metric_samples_name_metric_labels_created_at_idx;
+CREATE INDEX IF NOT EXISTS metric_samples_name_metric_created_at_idx ON metric_samples (name_metric, created_at);
+ALTER TABLE metric_samples DROP COLUMN IF EXISTS labels;
+
+ALTER TABLE metrics DROP CONSTRAINT IF EXISTS metrics_name_metric_labels_key;
+DELETE FROM metrics a USING metrics b WHERE a.name_metric = b.name_metric AND a.id > b.id;
+ALTER TABLE metrics ADD CONSTRAINT metrics_name_metric_key UNIQUE (name_metric);
+ALTER TABLE metrics DROP COLUMN IF EXISTS labels
@@ -0,0 +1,7 @@
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS labels jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE metrics DROP CONSTRAINT IF EXISTS metrics_name_metric_key;
+ALTER TABLE metrics ADD CONSTRAINT metrics_name_metric_labels_key UNIQUE (name_metric, labels);
+
+ALTER TABLE metric_samples ADD COLUMN IF NOT EXISTS labels jsonb NOT NULL DEFAULT '{}';
+DROP INDEX IF EXISTS metric_samples_name_metric_created_at_idx;
+CREATE INDEX IF NOT EXISTS metric_samples_name_metric_labels_created_at_idx ON metric_samples (name_metric, labels, created_at)
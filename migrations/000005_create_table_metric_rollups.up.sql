@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS metric_rollups (
+    name_metric CHARACTER VARYING(100) NOT NULL,
+    labels jsonb NOT NULL DEFAULT '{}',
+    resolution integer NOT NULL,
+    started_at timestamp with time zone NOT NULL,
+    min double precision NOT NULL,
+    max double precision NOT NULL,
+    sum double precision NOT NULL,
+    count bigint NOT NULL,
+    last double precision NOT NULL,
+    increase double precision NOT NULL,
+    PRIMARY KEY (name_metric, labels, resolution, started_at)
+);
+
+CREATE INDEX IF NOT EXISTS metric_rollups_resolution_started_at_idx ON metric_rollups (resolution, started_at)
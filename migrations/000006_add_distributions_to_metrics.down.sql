@@ -0,0 +1,2 @@
+ALTER TABLE metrics DROP COLUMN IF EXISTS summary;
+ALTER TABLE metrics DROP COLUMN IF EXISTS histogram
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS histogram jsonb;
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS summary jsonb
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS metric_samples_created_at_idx
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS metric_samples_created_at_idx ON metric_samples (created_at)
\ No newline at end of file
@@ -74,6 +74,9 @@ type AddMetricV2Response struct {
 	unknownFields protoimpl.UnknownFields
 
 	Metric *base.Metric `protobuf:"bytes,1,opt,name=metric,proto3" json:"metric,omitempty"`
+	// Скорость роста и прирост счетчика с учетом сбросов. Заполняются в ответе GetMetricV2 для counter.
+	Rate     float64 `protobuf:"fixed64,2,opt,name=rate,proto3" json:"rate,omitempty"`
+	Increase float64 `protobuf:"fixed64,3,opt,name=increase,proto3" json:"increase,omitempty"`
 }
 
 func (x *AddMetricV2Response) Reset() {
@@ -115,6 +118,20 @@ func (x *AddMetricV2Response) GetMetric() *base.Metric {
 	return nil
 }
 
+func (x *AddMetricV2Response) GetRate() float64 {
+	if x != nil {
+		return x.Rate
+	}
+	return 0
+}
+
+func (x *AddMetricV2Response) GetIncrease() float64 {
+	if x != nil {
+		return x.Increase
+	}
+	return 0
+}
+
 var File_protos_metric_v2_metric_service_proto protoreflect.FileDescriptor
 
 var file_protos_metric_v2_metric_service_proto_rawDesc = []byte{
@@ -127,11 +144,14 @@ var file_protos_metric_v2_metric_service_proto_rawDesc = []byte{
 	0x32, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2c, 0x0a, 0x06, 0x6d, 0x65, 0x74, 0x72,
 	0x69, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x6d, 0x65, 0x74, 0x72, 0x69,
 	0x63, 0x73, 0x2e, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x52, 0x06,
-	0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x22, 0x43, 0x0a, 0x13, 0x41, 0x64, 0x64, 0x4d, 0x65, 0x74,
+	0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x22, 0x73, 0x0a, 0x13, 0x41, 0x64, 0x64, 0x4d, 0x65, 0x74,
 	0x72, 0x69, 0x63, 0x56, 0x32, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2c, 0x0a,
 	0x06, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e,
 	0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x2e, 0x62, 0x61, 0x73, 0x65, 0x2e, 0x4d, 0x65, 0x74,
-	0x72, 0x69, 0x63, 0x52, 0x06, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x32, 0xaf, 0x01, 0x0a, 0x0d,
+	0x72, 0x69, 0x63, 0x52, 0x06, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x12, 0x12, 0x0a, 0x04, 0x72,
+	0x61, 0x74, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x72, 0x61, 0x74, 0x65, 0x12,
+	0x1a, 0x0a, 0x08, 0x69, 0x6e, 0x63, 0x72, 0x65, 0x61, 0x73, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x01, 0x52, 0x08, 0x69, 0x6e, 0x63, 0x72, 0x65, 0x61, 0x73, 0x65, 0x32, 0xaf, 0x01, 0x0a, 0x0d,
 	0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x4e, 0x0a,
 	0x0b, 0x41, 0x64, 0x64, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x56, 0x32, 0x12, 0x1e, 0x2e, 0x6d,
 	0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x2e, 0x76, 0x32, 0x2e, 0x41, 0x64, 0x64, 0x4d, 0x65, 0x74,
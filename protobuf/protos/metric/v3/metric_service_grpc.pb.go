@@ -0,0 +1,181 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             v3.12.4
+// source: protos/metric/v3/metric_service.proto
+
+package v3
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	MetricService_StreamMetrics_FullMethodName = "/metrics.v3.MetricService/StreamMetrics"
+	MetricService_QueryRange_FullMethodName    = "/metrics.v3.MetricService/QueryRange"
+)
+
+// MetricServiceClient is the client API for MetricService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MetricServiceClient interface {
+	StreamMetrics(ctx context.Context, opts ...grpc.CallOption) (MetricService_StreamMetricsClient, error)
+	QueryRange(ctx context.Context, in *QueryRangeRequest, opts ...grpc.CallOption) (*QueryRangeResponse, error)
+}
+
+type metricServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMetricServiceClient(cc grpc.ClientConnInterface) MetricServiceClient {
+	return &metricServiceClient{cc}
+}
+
+func (c *metricServiceClient) StreamMetrics(ctx context.Context, opts ...grpc.CallOption) (MetricService_StreamMetricsClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricService_ServiceDesc.Streams[0], MetricService_StreamMetrics_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricServiceStreamMetricsClient{ClientStream: stream}
+	return x, nil
+}
+
+type MetricService_StreamMetricsClient interface {
+	Send(*MetricsBatch) error
+	Recv() (*BatchAck, error)
+	grpc.ClientStream
+}
+
+type metricServiceStreamMetricsClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricServiceStreamMetricsClient) Send(m *MetricsBatch) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *metricServiceStreamMetricsClient) Recv() (*BatchAck, error) {
+	m := new(BatchAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *metricServiceClient) QueryRange(ctx context.Context, in *QueryRangeRequest, opts ...grpc.CallOption) (*QueryRangeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryRangeResponse)
+	err := c.cc.Invoke(ctx, MetricService_QueryRange_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MetricServiceServer is the server API for MetricService service.
+// All implementations must embed UnimplementedMetricServiceServer
+// for forward compatibility
+type MetricServiceServer interface {
+	StreamMetrics(MetricService_StreamMetricsServer) error
+	QueryRange(context.Context, *QueryRangeRequest) (*QueryRangeResponse, error)
+	mustEmbedUnimplementedMetricServiceServer()
+}
+
+// UnimplementedMetricServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedMetricServiceServer struct {
+}
+
+func (UnimplementedMetricServiceServer) StreamMetrics(MetricService_StreamMetricsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamMetrics not implemented")
+}
+func (UnimplementedMetricServiceServer) QueryRange(context.Context, *QueryRangeRequest) (*QueryRangeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryRange not implemented")
+}
+func (UnimplementedMetricServiceServer) mustEmbedUnimplementedMetricServiceServer() {}
+
+// UnsafeMetricServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MetricServiceServer will
+// result in compilation errors.
+type UnsafeMetricServiceServer interface {
+	mustEmbedUnimplementedMetricServiceServer()
+}
+
+func RegisterMetricServiceServer(s grpc.ServiceRegistrar, srv MetricServiceServer) {
+	s.RegisterService(&MetricService_ServiceDesc, srv)
+}
+
+func _MetricService_StreamMetrics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricServiceServer).StreamMetrics(&metricServiceStreamMetricsServer{ServerStream: stream})
+}
+
+type MetricService_StreamMetricsServer interface {
+	Send(*BatchAck) error
+	Recv() (*MetricsBatch, error)
+	grpc.ServerStream
+}
+
+type metricServiceStreamMetricsServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricServiceStreamMetricsServer) Send(m *BatchAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *metricServiceStreamMetricsServer) Recv() (*MetricsBatch, error) {
+	m := new(MetricsBatch)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _MetricService_QueryRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricServiceServer).QueryRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricService_QueryRange_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricServiceServer).QueryRange(ctx, req.(*QueryRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MetricService_ServiceDesc is the grpc.ServiceDesc for MetricService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MetricService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "metrics.v3.MetricService",
+	HandlerType: (*MetricServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "QueryRange",
+			Handler:    _MetricService_QueryRange_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamMetrics",
+			Handler:       _MetricService_StreamMetrics_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "protos/metric/v3/metric_service.proto",
+}